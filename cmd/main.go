@@ -15,6 +15,6 @@ func main() {
 
 	client, _ := prom.NewPrometheusClient(address, timeout, keepAlive, queryConcurrency, false, false, &prom.ClientAuth{})
 
-	fmt.Sprintf("client: %+v", client)
+	fmt.Printf("client: %+v\n", client)
 	return
 }
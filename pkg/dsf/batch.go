@@ -0,0 +1,243 @@
+package dsf
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/open-resource-management/metricsclient/pkg/prom"
+	"github.com/open-resource-management/metricsclient/pkg/prom/promql"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog"
+)
+
+const (
+	// nodeLabelName is the label identifying the node in node_exporter and cAdvisor metrics
+	nodeLabelName      = "instance"
+	namespaceLabelName = "namespace"
+	podLabelName       = "pod"
+	containerLabelName = "container"
+)
+
+// invalidLabelCharRE matches the characters kube-state-metrics replaces when exporting pod labels
+var invalidLabelCharRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// DataSourceSelector selects all the objects of the type matching the filters, the empty filters are ignored
+type DataSourceSelector struct {
+	DataSourceObjectType
+	NodeName  string
+	Namespace string
+	// LabelSelector selects the pods by labels, it is not supported for node
+	LabelSelector map[string]string
+}
+
+// groupLabelNames returns the labels identifying the object of the type in the query results
+func groupLabelNames(t DataSourceObjectType) ([]string, error) {
+	switch t {
+	case DataSourceObjectNode:
+		return []string{nodeLabelName}, nil
+	case DataSourceObjectPod:
+		return []string{namespaceLabelName, podLabelName}, nil
+	case DataSourceObjectContainer:
+		return []string{namespaceLabelName, podLabelName, containerLabelName}, nil
+	}
+	return nil, fmt.Errorf("the type of metric is only support (node, pod, container)")
+}
+
+// objectMatchers returns the label matchers selecting the single object
+func objectMatchers(name DataSourceObjectName) []promql.LabelMatcher {
+	switch name.DataSourceObjectType {
+	case DataSourceObjectNode:
+		return []promql.LabelMatcher{promql.Eq(nodeLabelName, name.NodeName)}
+	case DataSourceObjectPod:
+		return []promql.LabelMatcher{promql.Eq(podLabelName, name.PodName), promql.Eq(containerLabelName, ""), promql.Eq(namespaceLabelName, name.Namespace)}
+	}
+	return []promql.LabelMatcher{promql.Eq(podLabelName, name.PodName), promql.Eq(containerLabelName, name.ContainerName), promql.Eq(namespaceLabelName, name.Namespace)}
+}
+
+// containerMatchers returns the label matchers selecting the cAdvisor series of the pod cgroups or the
+// container cgroups, excluding the pause containers and the node cgroups such as the root and system.slice,
+// which have no pod label
+func containerMatchers(t DataSourceObjectType) []promql.LabelMatcher {
+	if t == DataSourceObjectPod {
+		return []promql.LabelMatcher{promql.Eq(containerLabelName, ""), promql.Neq(podLabelName, "")}
+	}
+	return []promql.LabelMatcher{promql.Neq(containerLabelName, ""), promql.Neq(containerLabelName, "POD")}
+}
+
+// nodeVector returns the selector of the node_exporter metric of the node
+func nodeVector(metric string, name DataSourceObjectName) *promql.VectorSelector {
+	return promql.Vector(metric, promql.Eq(nodeLabelName, name.NodeName))
+}
+
+// joinPodLabels filters the query by the kube_pod_labels selector, the query is returned as is if join is nil
+func joinPodLabels(query promql.Expr, join *promql.VectorSelector) promql.Expr {
+	if join == nil {
+		return query
+	}
+	return promql.And(query, join).On(namespaceLabelName, podLabelName)
+}
+
+// namesObjectType returns the type of the names, which must be the same
+func namesObjectType(names []DataSourceObjectName) (DataSourceObjectType, error) {
+	if len(names) == 0 {
+		return "", fmt.Errorf("names is empty")
+	}
+
+	t := names[0].DataSourceObjectType
+	for _, name := range names[1:] {
+		if name.DataSourceObjectType != t {
+			return "", fmt.Errorf("names must be the same type, found %s and %s", t, name.DataSourceObjectType)
+		}
+	}
+	return t, nil
+}
+
+// namesMatchers returns the label matchers selecting all the names. The matchers may select more
+// objects than the names, e.g. pods with the same name in other namespaces, which are filtered out
+// after query.
+func namesMatchers(t DataSourceObjectType, names []DataSourceObjectName) ([]promql.LabelMatcher, error) {
+	labelNames, err := groupLabelNames(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var matchers []promql.LabelMatcher
+	for _, labelName := range labelNames {
+		values := map[string]struct{}{}
+		for _, name := range names {
+			values[objectLabelValue(name, labelName)] = struct{}{}
+		}
+
+		var quoted []string
+		for v := range values {
+			quoted = append(quoted, regexp.QuoteMeta(v))
+		}
+		sort.Strings(quoted)
+
+		if len(quoted) == 1 {
+			matchers = append(matchers, promql.Eq(labelName, objectLabelValue(names[0], labelName)))
+		} else {
+			matchers = append(matchers, promql.Re(labelName, strings.Join(quoted, "|")))
+		}
+	}
+
+	return matchers, nil
+}
+
+// selectorMatchers returns the label matchers of the selector, and the kube_pod_labels selector to
+// join with if selecting by pod labels
+func selectorMatchers(selector DataSourceSelector) ([]promql.LabelMatcher, *promql.VectorSelector, error) {
+	var matchers []promql.LabelMatcher
+	if selector.NodeName != "" {
+		matchers = append(matchers, promql.Eq(nodeLabelName, selector.NodeName))
+	}
+	if selector.Namespace != "" {
+		if selector.DataSourceObjectType == DataSourceObjectNode {
+			return nil, nil, fmt.Errorf("namespace is not supported for node")
+		}
+		matchers = append(matchers, promql.Eq(namespaceLabelName, selector.Namespace))
+	}
+
+	if len(selector.LabelSelector) == 0 {
+		return matchers, nil, nil
+	}
+	if selector.DataSourceObjectType == DataSourceObjectNode {
+		return nil, nil, fmt.Errorf("label selector is not supported for node")
+	}
+
+	keys := make([]string, 0, len(selector.LabelSelector))
+	for k := range selector.LabelSelector {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	join := promql.Vector("kube_pod_labels")
+	for _, k := range keys {
+		join.Where(promql.Eq("label_"+invalidLabelCharRE.ReplaceAllString(k, "_"), selector.LabelSelector[k]))
+	}
+
+	return matchers, join, nil
+}
+
+// objectLabelValue returns the value of the object for the label in the query results
+func objectLabelValue(name DataSourceObjectName, labelName string) string {
+	switch labelName {
+	case nodeLabelName:
+		return name.NodeName
+	case namespaceLabelName:
+		return name.Namespace
+	case podLabelName:
+		return name.PodName
+	case containerLabelName:
+		return name.ContainerName
+	}
+	return ""
+}
+
+// resultObjectName returns the object the query result belongs to
+func resultObjectName(t DataSourceObjectType, result *prom.QueryResult) (DataSourceObjectName, error) {
+	labelNames, err := groupLabelNames(t)
+	if err != nil {
+		return DataSourceObjectName{}, err
+	}
+
+	values, err := result.GetStrings(labelNames...)
+	if err != nil {
+		return DataSourceObjectName{}, err
+	}
+
+	switch t {
+	case DataSourceObjectNode:
+		return NewNodeDataSourceObject(values[nodeLabelName]), nil
+	case DataSourceObjectPod:
+		return NewPodDataSourceObject(values[podLabelName], values[namespaceLabelName]), nil
+	default:
+		return NewContainerDataSourceObject(values[podLabelName], values[namespaceLabelName], values[containerLabelName]), nil
+	}
+}
+
+// Results2Samples matches the query results back to the objects by labels, the results without
+// the labels are ignored
+func Results2Samples(t DataSourceObjectType, results []*prom.QueryResult) map[DataSourceObjectName]DataSample {
+	samples := make(map[DataSourceObjectName]DataSample, len(results))
+	for _, result := range results {
+		name, err := resultObjectName(t, result)
+		if err != nil {
+			klog.Warningf("Results2Samples match result failed, err %s", err.Error())
+			continue
+		}
+
+		if len(result.Values) == 0 || result.Values[0] == nil {
+			continue
+		}
+		samples[name] = Vector2Sample(*result.Values[0])
+	}
+
+	return samples
+}
+
+// filterSamples keeps the samples of the names
+func filterSamples(samples map[DataSourceObjectName]DataSample, names []DataSourceObjectName) map[DataSourceObjectName]DataSample {
+	filtered := make(map[DataSourceObjectName]DataSample, len(names))
+	for _, name := range names {
+		if s, ok := samples[name]; ok {
+			filtered[name] = s
+		}
+	}
+	return filtered
+}
+
+// matchPodSelector returns true if the pod matches the pod or container selector
+func matchPodSelector(selector DataSourceSelector, pod *v1.Pod) bool {
+	if selector.NodeName != "" && pod.Spec.NodeName != selector.NodeName {
+		return false
+	}
+	if selector.Namespace != "" && pod.Namespace != selector.Namespace {
+		return false
+	}
+	return labels.SelectorFromSet(selector.LabelSelector).Matches(labels.Set(pod.Labels))
+}
@@ -0,0 +1,126 @@
+package dsf
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDataPromSource_GetCpuUsageSamples(t *testing.T) {
+	expectedQuery := `sum(rate(container_cpu_usage_seconds_total{container="",pod!="",namespace="ns1",pod=~"pod1|pod2"}[1m:1m])) by (namespace, pod)`
+
+	var queries int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form failed %s", err.Error())
+		}
+		if query := r.Form.Get("query"); query != expectedQuery {
+			t.Errorf("query: exp (%s); act (%s)", expectedQuery, query)
+		}
+
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[`+
+			`{"metric":{"namespace":"ns1","pod":"pod1"},"value":[1600000000,"0.5"]},`+
+			`{"metric":{"namespace":"ns1","pod":"pod2"},"value":[1600000000,"1.5"]},`+
+			`{"metric":{"namespace":"ns1","pod":"pod3"},"value":[1600000000,"2.5"]},`+
+			`{"metric":{"pod":"pod4"},"value":[1600000000,"3.5"]}]}}`)
+	}))
+	defer server.Close()
+
+	source := newTestPromSource(t, server.URL)
+
+	pod1 := NewPodDataSourceObject("pod1", "ns1")
+	pod2 := NewPodDataSourceObject("pod2", "ns1")
+	samples, err := source.GetCpuUsageSamples([]DataSourceObjectName{pod1, pod2})
+	if err != nil {
+		t.Fatalf("GetCpuUsageSamples failed %s", err.Error())
+	}
+
+	if queries != 1 {
+		t.Fatalf("GetCpuUsageSamples queries: exp (1); act (%d)", queries)
+	}
+	if len(samples) != 2 || samples[pod1].Value != 0.5 || samples[pod2].Value != 1.5 {
+		t.Fatalf("GetCpuUsageSamples unexpected result %+v", samples)
+	}
+
+	if _, err := source.GetCpuUsageSamples([]DataSourceObjectName{pod1, NewNodeDataSourceObject("node1")}); err == nil {
+		t.Fatalf("GetCpuUsageSamples expected error for names of different types")
+	}
+}
+
+func TestDataPromSource_GetMemoryUsageSamplesBySelector_Pod(t *testing.T) {
+	// pod!="" excludes the cAdvisor root and system.slice cgroups of the node, which have no pod label
+	expectedQuery := `sum(container_memory_working_set_bytes{container="",pod!="",instance="node1"}) by (namespace, pod)`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form failed %s", err.Error())
+		}
+		if query := r.Form.Get("query"); query != expectedQuery {
+			t.Errorf("query: exp (%s); act (%s)", expectedQuery, query)
+		}
+
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[`+
+			`{"metric":{"namespace":"ns1","pod":"pod1"},"value":[1600000000,"1024"]},`+
+			`{"metric":{},"value":[1600000000,"8192"]}]}}`)
+	}))
+	defer server.Close()
+
+	source := newTestPromSource(t, server.URL)
+
+	samples, err := source.GetMemoryUsageSamplesBySelector(DataSourceSelector{
+		DataSourceObjectType: DataSourceObjectPod,
+		NodeName:             "node1",
+	})
+	if err != nil {
+		t.Fatalf("GetMemoryUsageSamplesBySelector failed %s", err.Error())
+	}
+
+	if len(samples) != 1 || samples[NewPodDataSourceObject("pod1", "ns1")].Value != 1024 {
+		t.Fatalf("GetMemoryUsageSamplesBySelector unexpected result %+v", samples)
+	}
+}
+
+func TestDataPromSource_GetMemoryUsageSamplesBySelector(t *testing.T) {
+	expectedQuery := `sum(container_memory_working_set_bytes{container!="",container!="POD",instance="node1",namespace="ns1"}) by (namespace, pod, container)` +
+		` and on(namespace, pod) kube_pod_labels{label_app_kubernetes_io_name="web"}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form failed %s", err.Error())
+		}
+		if query := r.Form.Get("query"); query != expectedQuery {
+			t.Errorf("query: exp (%s); act (%s)", expectedQuery, query)
+		}
+
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[`+
+			`{"metric":{"namespace":"ns1","pod":"pod1","container":"c1"},"value":[1600000000,"1024"]},`+
+			`{"metric":{"namespace":"ns1","pod":"pod1","container":"c2"},"value":[1600000000,"2048"]}]}}`)
+	}))
+	defer server.Close()
+
+	source := newTestPromSource(t, server.URL)
+
+	samples, err := source.GetMemoryUsageSamplesBySelector(DataSourceSelector{
+		DataSourceObjectType: DataSourceObjectContainer,
+		NodeName:             "node1",
+		Namespace:            "ns1",
+		LabelSelector:        map[string]string{"app.kubernetes.io/name": "web"},
+	})
+	if err != nil {
+		t.Fatalf("GetMemoryUsageSamplesBySelector failed %s", err.Error())
+	}
+
+	if len(samples) != 2 || samples[NewContainerDataSourceObject("pod1", "ns1", "c2")].Value != 2048 {
+		t.Fatalf("GetMemoryUsageSamplesBySelector unexpected result %+v", samples)
+	}
+
+	if _, err := source.GetMemoryUsageSamplesBySelector(DataSourceSelector{
+		DataSourceObjectType: DataSourceObjectNode,
+		LabelSelector:        map[string]string{"app": "web"},
+	}); err == nil {
+		t.Fatalf("GetMemoryUsageSamplesBySelector expected error for node label selector")
+	}
+}
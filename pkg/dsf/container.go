@@ -0,0 +1,55 @@
+package dsf
+
+import (
+	"github.com/open-resource-management/metricsclient/pkg/stats"
+	"github.com/open-resource-management/metricsclient/pkg/types"
+)
+
+// GetContainerCpuUsage return cpu usage for pod or container, in cores
+func GetContainerCpuUsage(containerStats stats.ContainerStats) (DataSample, error) {
+	result, err := containerStats.GetResourceStats(types.CpuUsageMetrics)
+	if err != nil {
+		return DataSample{}, err
+	}
+	res := result.(*stats.ContainerCpu)
+	return DataSample{Value: res.CpuUsage, Timestamp: res.Timestamp}, nil
+}
+
+// GetContainerMemoryUsage return memory working set for pod or container, in bytes
+func GetContainerMemoryUsage(containerStats stats.ContainerStats) (DataSample, error) {
+	result, err := containerStats.GetResourceStats(types.MemoryUsageMetrics)
+	if err != nil {
+		return DataSample{}, err
+	}
+	res := result.(*stats.ContainerMemory)
+	return DataSample{Value: res.WorkingSet, Timestamp: res.Timestamp}, nil
+}
+
+// GetContainerMemoryBreakdown return rss and cache memory for pod or container, in bytes
+func GetContainerMemoryBreakdown(containerStats stats.ContainerStats) (DataMemoryBreakdown, error) {
+	result, err := containerStats.GetResourceStats(types.MemoryUsageMetrics)
+	if err != nil {
+		return DataMemoryBreakdown{}, err
+	}
+	res := result.(*stats.ContainerMemory)
+	return DataMemoryBreakdown{
+		Rss:   DataSample{Value: res.UsageRss, Timestamp: res.Timestamp},
+		Cache: DataSample{Value: res.UsageCache, Timestamp: res.Timestamp},
+	}, nil
+}
+
+// Stats2Sample converts the node or container stats to sample, the value of which is the same as the
+// instant sample, i.e. the busy ratio for node cpu, cores for container cpu and bytes for memory
+func Stats2Sample(value interface{}) DataSample {
+	switch v := value.(type) {
+	case *stats.NodeCpu:
+		return DataSample{Value: NodeCpuUsageRatio(v), Timestamp: v.Timestamp}
+	case *stats.NodeMemory:
+		return DataSample{Value: v.WorkingSet, Timestamp: v.Timestamp}
+	case *stats.ContainerCpu:
+		return DataSample{Value: v.CpuUsage, Timestamp: v.Timestamp}
+	case *stats.ContainerMemory:
+		return DataSample{Value: v.WorkingSet, Timestamp: v.Timestamp}
+	}
+	return DataSample{}
+}
@@ -5,12 +5,15 @@ import (
 	"github.com/open-resource-management/metricsclient/pkg/stats"
 	"github.com/open-resource-management/metricsclient/pkg/types"
 	"k8s.io/klog"
+	"time"
 
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/cache"
 )
 
 type DataNodeLocalSource struct {
-	rsi stats.ResourceStatsInterface
+	rsi         stats.ResourceStatsInterface
+	podInformer cache.SharedIndexInformer
 }
 
 func NewDataNodeLocalSource(config *DataSourceNodeLocalConfig, podInformer cache.SharedIndexInformer) (*DataNodeLocalSource, error) {
@@ -21,20 +24,200 @@ func NewDataNodeLocalSource(config *DataSourceNodeLocalConfig, podInformer cache
 		return nil, err
 	}
 
-	return &DataNodeLocalSource{rsi: rsi}, nil
+	return &DataNodeLocalSource{rsi: rsi, podInformer: podInformer}, nil
 }
 
 func (nl *DataNodeLocalSource) GetCpuUsageSample(name DataSourceObjectName) (DataSample, error) {
 	if IsNodeDataSourceObject(name) {
-		metricValues := GetNodeCpuUsage(nl.rsi.GetNodeStats())
-	} else if IsPodDataSourceObject(name) {
+		result, err := nl.rsi.GetNodeStats().GetResourceStats(types.CpuUsageMetrics)
+		if err != nil {
+			klog.Errorf("GetCpuUsageSample get node stats failed, err %s", err.Error())
+			return DataSample{}, err
+		}
 
-	} else if IsContainerDataSourceObject(name) {
+		res := result.(*stats.NodeCpu)
+		return DataSample{Value: NodeCpuUsageRatio(res), Timestamp: res.Timestamp}, nil
+	} else if IsPodDataSourceObject(name) || IsContainerDataSourceObject(name) {
+		containerStats, err := nl.getContainerStats(name)
+		if err != nil {
+			klog.Errorf("GetCpuUsageSample get container stats failed, err %s", err.Error())
+			return DataSample{}, err
+		}
 
+		return GetContainerCpuUsage(containerStats)
 	}
 	return DataSample{}, fmt.Errorf("the type of metric is only support (node, pod, container)")
 }
 
 func (nl *DataNodeLocalSource) GetMemoryUsageSample(name DataSourceObjectName) (DataSample, error) {
+	if IsNodeDataSourceObject(name) {
+		result, err := nl.rsi.GetNodeStats().GetResourceStats(types.MemoryUsageMetrics)
+		if err != nil {
+			klog.Errorf("GetMemoryUsageSample get node stats failed, err %s", err.Error())
+			return DataSample{}, err
+		}
+
+		res := result.(*stats.NodeMemory)
+		return DataSample{Value: res.WorkingSet, Timestamp: res.Timestamp}, nil
+	} else if IsPodDataSourceObject(name) || IsContainerDataSourceObject(name) {
+		containerStats, err := nl.getContainerStats(name)
+		if err != nil {
+			klog.Errorf("GetMemoryUsageSample get container stats failed, err %s", err.Error())
+			return DataSample{}, err
+		}
+
+		return GetContainerMemoryUsage(containerStats)
+	}
 	return DataSample{}, fmt.Errorf("the type of metric is only support (node, pod, container)")
 }
+
+func (nl *DataNodeLocalSource) GetMemoryBreakdownSample(name DataSourceObjectName) (DataMemoryBreakdown, error) {
+	if IsNodeDataSourceObject(name) {
+		result, err := nl.rsi.GetNodeStats().GetResourceStats(types.MemoryUsageMetrics)
+		if err != nil {
+			klog.Errorf("GetMemoryBreakdownSample get node stats failed, err %s", err.Error())
+			return DataMemoryBreakdown{}, err
+		}
+
+		res := result.(*stats.NodeMemory)
+		return DataMemoryBreakdown{
+			Rss:   DataSample{Value: res.UsageRss, Timestamp: res.Timestamp},
+			Cache: DataSample{Value: res.UsageCache, Timestamp: res.Timestamp},
+		}, nil
+	} else if IsPodDataSourceObject(name) || IsContainerDataSourceObject(name) {
+		containerStats, err := nl.getContainerStats(name)
+		if err != nil {
+			klog.Errorf("GetMemoryBreakdownSample get container stats failed, err %s", err.Error())
+			return DataMemoryBreakdown{}, err
+		}
+
+		return GetContainerMemoryBreakdown(containerStats)
+	}
+	return DataMemoryBreakdown{}, fmt.Errorf("the type of metric is only support (node, pod, container)")
+}
+
+// GetCpuUsageTimeSeries returns the cpu usage in [start, end] from the samples kept in memory
+func (nl *DataNodeLocalSource) GetCpuUsageTimeSeries(name DataSourceObjectName, start, end time.Time, step time.Duration) ([]DataTimeSeries, error) {
+	return nl.getTimeSeries(name, types.CpuUsageMetrics, start, end, step)
+}
+
+// GetMemoryUsageTimeSeries returns the memory usage in [start, end] from the samples kept in memory
+func (nl *DataNodeLocalSource) GetMemoryUsageTimeSeries(name DataSourceObjectName, start, end time.Time, step time.Duration) ([]DataTimeSeries, error) {
+	return nl.getTimeSeries(name, types.MemoryUsageMetrics, start, end, step)
+}
+
+func (nl *DataNodeLocalSource) getTimeSeries(name DataSourceObjectName, kind types.MetricKind, start, end time.Time, step time.Duration) ([]DataTimeSeries, error) {
+	var values []interface{}
+	var err error
+
+	if IsNodeDataSourceObject(name) {
+		values, err = nl.rsi.GetNodeStats().GetResourceStatsRange(kind, start, end)
+	} else if IsPodDataSourceObject(name) || IsContainerDataSourceObject(name) {
+		var containerStats stats.ContainerStats
+		containerStats, err = nl.getContainerStats(name)
+		if err == nil {
+			values, err = containerStats.GetResourceStatsRange(kind, start, end)
+		}
+	} else {
+		return nil, fmt.Errorf("the type of metric is only support (node, pod, container)")
+	}
+	if err != nil {
+		klog.Errorf("get %s time series failed, err %s", kind, err.Error())
+		return nil, err
+	}
+
+	samples := make([]DataSample, 0, len(values))
+	for _, v := range values {
+		samples = append(samples, Stats2Sample(v))
+	}
+
+	return []DataTimeSeries{{Labels: GetDataSourceObjectLabels(name), Samples: DownsampleSamples(samples, start, step)}}, nil
+}
+
+// GetCpuUsageSamples returns the cpu usage of the names, the names without samples are omitted
+func (nl *DataNodeLocalSource) GetCpuUsageSamples(names []DataSourceObjectName) (map[DataSourceObjectName]DataSample, error) {
+	return nl.getSamples(names, nl.GetCpuUsageSample)
+}
+
+// GetCpuUsageSamplesBySelector returns the cpu usage of the objects on the node matching the selector
+func (nl *DataNodeLocalSource) GetCpuUsageSamplesBySelector(selector DataSourceSelector) (map[DataSourceObjectName]DataSample, error) {
+	names, err := nl.selectNames(selector)
+	if err != nil {
+		return nil, err
+	}
+	return nl.getSamples(names, nl.GetCpuUsageSample)
+}
+
+// GetMemoryUsageSamples returns the memory usage of the names, the names without samples are omitted
+func (nl *DataNodeLocalSource) GetMemoryUsageSamples(names []DataSourceObjectName) (map[DataSourceObjectName]DataSample, error) {
+	return nl.getSamples(names, nl.GetMemoryUsageSample)
+}
+
+// GetMemoryUsageSamplesBySelector returns the memory usage of the objects on the node matching the selector
+func (nl *DataNodeLocalSource) GetMemoryUsageSamplesBySelector(selector DataSourceSelector) (map[DataSourceObjectName]DataSample, error) {
+	names, err := nl.selectNames(selector)
+	if err != nil {
+		return nil, err
+	}
+	return nl.getSamples(names, nl.GetMemoryUsageSample)
+}
+
+func (nl *DataNodeLocalSource) getSamples(names []DataSourceObjectName, get func(DataSourceObjectName) (DataSample, error)) (map[DataSourceObjectName]DataSample, error) {
+	if len(names) == 0 {
+		return map[DataSourceObjectName]DataSample{}, nil
+	}
+	if _, err := namesObjectType(names); err != nil {
+		return nil, err
+	}
+
+	samples := make(map[DataSourceObjectName]DataSample, len(names))
+	for _, name := range names {
+		sample, err := get(name)
+		if err != nil {
+			klog.V(4).Infof("get sample of %+v failed, err %s", name, err.Error())
+			continue
+		}
+		samples[name] = sample
+	}
+
+	return samples, nil
+}
+
+// selectNames returns the objects matching the selector, the pods are listed from the pod informer.
+// The node stats are always of the local node, so the node name of the selector is used as is.
+func (nl *DataNodeLocalSource) selectNames(selector DataSourceSelector) ([]DataSourceObjectName, error) {
+	if selector.DataSourceObjectType == DataSourceObjectNode {
+		return []DataSourceObjectName{NewNodeDataSourceObject(selector.NodeName)}, nil
+	}
+	if selector.DataSourceObjectType != DataSourceObjectPod && selector.DataSourceObjectType != DataSourceObjectContainer {
+		return nil, fmt.Errorf("the type of metric is only support (node, pod, container)")
+	}
+	if nl.podInformer == nil {
+		return nil, fmt.Errorf("pod informer is nil")
+	}
+
+	var names []DataSourceObjectName
+	for _, obj := range nl.podInformer.GetStore().List() {
+		pod, ok := obj.(*v1.Pod)
+		if !ok || !matchPodSelector(selector, pod) {
+			continue
+		}
+
+		if selector.DataSourceObjectType == DataSourceObjectPod {
+			names = append(names, NewPodDataSourceObject(pod.Name, pod.Namespace))
+			continue
+		}
+		for _, container := range pod.Spec.Containers {
+			names = append(names, NewContainerDataSourceObject(pod.Name, pod.Namespace, container.Name))
+		}
+	}
+
+	return names, nil
+}
+
+func (nl *DataNodeLocalSource) getContainerStats(name DataSourceObjectName) (stats.ContainerStats, error) {
+	if IsPodDataSourceObject(name) {
+		return nl.rsi.GetPodStats(name.Namespace, name.PodName)
+	}
+	return nl.rsi.GetContainerStats(name.Namespace, name.PodName, name.ContainerName)
+}
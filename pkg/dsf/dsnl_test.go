@@ -0,0 +1,108 @@
+package dsf
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/stats"
+	"github.com/open-resource-management/metricsclient/pkg/types"
+)
+
+// fakeResourceStats serves the same node stats samples for any range, and has no pod
+type fakeResourceStats struct {
+	cpu    []*stats.NodeCpu
+	memory []*stats.NodeMemory
+}
+
+func (f *fakeResourceStats) GetNodeStats() stats.NodeStats { return f }
+
+func (f *fakeResourceStats) GetPodStats(namespace, podName string) (stats.ContainerStats, error) {
+	return nil, fmt.Errorf("pod %s/%s not found", namespace, podName)
+}
+
+func (f *fakeResourceStats) GetContainerStats(namespace, podName, containerName string) (stats.ContainerStats, error) {
+	return nil, fmt.Errorf("container %s/%s/%s not found", namespace, podName, containerName)
+}
+
+func (f *fakeResourceStats) Stop() {}
+
+func (f *fakeResourceStats) GetResourceStats(kind types.MetricKind) (interface{}, error) {
+	values, err := f.GetResourceStatsRange(kind, time.Time{}, time.Time{})
+	if err != nil || len(values) == 0 {
+		return nil, fmt.Errorf("no %s sample", kind)
+	}
+	return values[len(values)-1], nil
+}
+
+func (f *fakeResourceStats) GetResourceStatsRange(kind types.MetricKind, start, end time.Time) ([]interface{}, error) {
+	var values []interface{}
+	switch kind {
+	case types.CpuUsageMetrics:
+		for _, v := range f.cpu {
+			values = append(values, v)
+		}
+	case types.MemoryUsageMetrics:
+		for _, v := range f.memory {
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+func TestDataNodeLocalSource_NodeCpuUsage(t *testing.T) {
+	ts := time.Unix(1600000000, 0)
+	nl := &DataNodeLocalSource{rsi: &fakeResourceStats{
+		cpu: []*stats.NodeCpu{{CpuTotal: 3, CpuPerCore: []float64{1, 1, 0.5, 0.5}, Timestamp: ts}},
+	}}
+	name := NewNodeDataSourceObject("node1")
+
+	// the node cpu usage is the busy ratio as for the prometheus data sources, not cores
+	sample, err := nl.GetCpuUsageSample(name)
+	if err != nil {
+		t.Fatalf("GetCpuUsageSample failed %s", err.Error())
+	}
+	if expected := (DataSample{Value: 0.75, Timestamp: ts}); sample != expected {
+		t.Errorf("expected %v, got %v", expected, sample)
+	}
+
+	series, err := nl.GetCpuUsageTimeSeries(name, ts, ts, 0)
+	if err != nil {
+		t.Fatalf("GetCpuUsageTimeSeries failed %s", err.Error())
+	}
+	if len(series) != 1 || !reflect.DeepEqual(series[0].Samples, []DataSample{{Value: 0.75, Timestamp: ts}}) {
+		t.Errorf("expected the 0.75 busy ratio, got %v", series)
+	}
+}
+
+func TestDataNodeLocalSource_NodeMemoryUsage(t *testing.T) {
+	ts := time.Unix(1600000000, 0)
+	nl := &DataNodeLocalSource{rsi: &fakeResourceStats{
+		memory: []*stats.NodeMemory{{UsageTotal: 8192, UsageRss: 2048, UsageCache: 6144, WorkingSet: 4096, Timestamp: ts}},
+	}}
+	name := NewNodeDataSourceObject("node1")
+
+	// the node memory usage is MemTotal - MemAvailable as for the prometheus data sources
+	sample, err := nl.GetMemoryUsageSample(name)
+	if err != nil {
+		t.Fatalf("GetMemoryUsageSample failed %s", err.Error())
+	}
+	if expected := (DataSample{Value: 4096, Timestamp: ts}); sample != expected {
+		t.Errorf("expected %v, got %v", expected, sample)
+	}
+
+	series, err := nl.GetMemoryUsageTimeSeries(name, ts, ts, 0)
+	if err != nil {
+		t.Fatalf("GetMemoryUsageTimeSeries failed %s", err.Error())
+	}
+	if len(series) != 1 || !reflect.DeepEqual(series[0].Samples, []DataSample{{Value: 4096, Timestamp: ts}}) {
+		t.Errorf("expected the 4096 bytes working set, got %v", series)
+	}
+
+	// the node memory usage values are in bytes as the samples
+	sample, err = MetricValues2Sample(GetNodeMemoryUsage(nl.rsi.GetNodeStats()), "working_set")
+	if err != nil || sample.Value != 4096 {
+		t.Errorf("expected the 4096 bytes working set, got %v, %v", sample, err)
+	}
+}
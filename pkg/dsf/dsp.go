@@ -1,10 +1,14 @@
 package dsf
 
 import (
+	"context"
 	"fmt"
 	"github.com/open-resource-management/metricsclient/pkg/prom"
+	"github.com/open-resource-management/metricsclient/pkg/prom/promql"
 	"github.com/open-resource-management/metricsclient/pkg/util"
+	prometheusapi "github.com/prometheus/client_golang/api"
 	"k8s.io/klog"
+	"strings"
 	"time"
 )
 
@@ -13,6 +17,9 @@ const (
 	defaultDuration         = time.Second * 60
 )
 
+// defaultTargetJobs are the jobs of the exporters the queries depend on
+var defaultTargetJobs = []string{"node-exporter", "kubelet"}
+
 type DataPromSource struct {
 	ctx              *prom.Context
 	minPerResolution time.Duration
@@ -22,83 +29,381 @@ type DataPromSource struct {
 func NewDataPromSource(config *DataSourcePromConfig) (*DataPromSource, error) {
 	klog.Infof("NewDataPromSource")
 
-	client, err := prom.NewPrometheusClient(config.address, config.timeout, config.keepAlive,
-		config.queryConcurrency, config.insecureSkipVerify, config.bRateLimit, config.auth)
+	var opts []prom.ClientOption
+	if config.TLS != nil {
+		opts = append(opts, prom.WithTLSConfig(config.TLS))
+	}
+	if config.AuthProvider != nil {
+		opts = append(opts, prom.WithAuthProvider(config.AuthProvider))
+	}
+	if config.RetryPolicy != nil {
+		opts = append(opts, prom.WithRetryPolicy(config.RetryPolicy))
+	}
+	if config.QPSLimit != nil {
+		opts = append(opts, prom.WithQPSLimit(config.QPSLimit))
+	}
+	if config.CircuitBreaker != nil {
+		opts = append(opts, prom.WithCircuitBreaker(config.CircuitBreaker))
+	}
+	if len(config.Headers) > 0 {
+		opts = append(opts, prom.WithHeaders(config.Headers))
+	}
+	if len(config.Tenants) > 0 {
+		opts = append(opts, prom.WithTenant(config.Tenants...))
+	}
+	if config.QueryParamsDecorator != nil {
+		opts = append(opts, prom.WithQueryParamsDecorator(config.QueryParamsDecorator))
+	}
+	for name, decorator := range config.ContextDecorators {
+		opts = append(opts, prom.WithContextQueryParamsDecorator(name, decorator))
+	}
+
+	var client prometheusapi.Client
+	var err error
+	if len(config.ReplicaAddresses) > 0 {
+		addresses := append([]string{config.Address}, config.ReplicaAddresses...)
+		client, err = prom.NewFailoverPrometheusClient(addresses, config.Timeout, config.KeepAlive,
+			config.QueryConcurrency, config.InsecureSkipVerify, config.RateLimit, config.Auth, config.Failover, opts...)
+	} else {
+		client, err = prom.NewPrometheusClient(config.Address, config.Timeout, config.KeepAlive,
+			config.QueryConcurrency, config.InsecureSkipVerify, config.RateLimit, config.Auth, opts...)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	ctx := prom.NewNamedContext(client, prom.ClusterContextName)
+	if config.TimestampPrecision != nil {
+		ctx.SetTimestampPrecision(*config.TimestampPrecision)
+	}
 
-	return &DataPromSource{ctx: ctx, minPerResolution: defaultMinPerResolution, duration: defaultDuration}, nil
-}
+	source := &DataPromSource{ctx: ctx, minPerResolution: defaultMinPerResolution, duration: defaultDuration}
+	if config.StartupCheck {
+		jobs := config.TargetJobs
+		if len(jobs) == 0 {
+			jobs = defaultTargetJobs
+		}
 
-func (c *DataPromSource) GetCpuUsageSample(name DataSourceObjectName) (DataSample, error) {
-	if IsNodeDataSourceObject(name) {
-		durationStr := fmt.Sprintf("%ds", int64(c.duration.Seconds()))
-		minPerResolutionStr := fmt.Sprintf("%ds", int64(c.minPerResolution.Seconds()))
-		queryNodeCPUUsage := fmt.Sprintf(`1-avg(rate(node_cpu_seconds_total{mode="idle",instance="%s"}[%s:%s])) by (instance)`, name.NodeName, durationStr, minPerResolutionStr)
-
-		results, err := c.ctx.QuerySync(queryNodeCPUUsage)
-		if err != nil {
-			klog.Errorf("GetCpuUsageSample Query failed, err %s", err.Error())
-			return DataSample{}, err
+		reqCtx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+		defer cancel()
+		if err := source.CheckPrometheus(reqCtx, jobs...); err != nil {
+			closeClient(client)
+			return nil, err
 		}
+	}
+
+	return source, nil
+}
 
-		v, err := GetVectorFromResults(results)
-		if err != nil {
-			klog.Errorf("GetCpuUsageSample get vector failed, err %s", err.Error())
-			return DataSample{}, err
+// closeClient closes the client if it supports closing, e.g. to stop the workers and health checks
+// of the client of a source which fails to be created
+func closeClient(client prometheusapi.Client) {
+	if closer, ok := client.(interface{ Close() error }); ok {
+		if err := closer.Close(); err != nil {
+			klog.Errorf("close prometheus client failed, err %s", err.Error())
 		}
+	}
+}
 
-		return Vector2Sample(v), nil
+// CheckPrometheus returns an error if prometheus does not support the subqueries of the cpu usage
+// queries, or if none of the targets of a job is up. The targets which are down are only logged.
+func (c *DataPromSource) CheckPrometheus(reqCtx context.Context, jobs ...string) error {
+	ok, err := c.ctx.SupportsSubqueries(reqCtx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("prometheus does not support subqueries, the minimum version is %s", prom.SubqueryMinVersion)
+	}
 
-	} else if IsPodDataSourceObject(name) {
-		durationStr := fmt.Sprintf("%ds", int64(c.duration.Seconds()))
-		minPerResolutionStr := fmt.Sprintf("%ds", int64(c.minPerResolution.Seconds()))
+	if len(jobs) == 0 {
+		return nil
+	}
 
-		queryPodCPUUsage := fmt.Sprintf(`rate(container_cpu_usage_seconds_total{pod="%s",container="",namespace="%s"}[%s:%s])`, name.PodName, name.Namespace, durationStr, minPerResolutionStr)
+	targets, err := c.ctx.Targets(reqCtx, prom.TargetStateActive)
+	if err != nil {
+		return err
+	}
 
-		results, err := c.ctx.QuerySync(queryPodCPUUsage)
-		if err != nil {
-			klog.Errorf("GetCpuUsageSample Query failed, err %s", err.Error())
-			return DataSample{}, err
+	var missing []string
+	for _, job := range jobs {
+		up, down := targets.Healthy(job)
+		for _, target := range down {
+			klog.Warningf("CheckPrometheus target %s of job %s is %s: %s", target.ScrapeURL, job, target.Health, target.LastError)
 		}
-
-		v, err := GetVectorFromResults(results)
-		if err != nil {
-			klog.Errorf("GetCpuUsageSample get vector failed, err %s", err.Error())
-			return DataSample{}, err
+		if len(up) == 0 {
+			missing = append(missing, job)
 		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("prometheus has no healthy targets of the jobs %s", strings.Join(missing, ", "))
+	}
 
-		return Vector2Sample(v), nil
+	return nil
+}
 
-	} else if IsContainerDataSourceObject(name) {
-		durationStr := fmt.Sprintf("%ds", int64(c.duration.Seconds()))
-		minPerResolutionStr := fmt.Sprintf("%ds", int64(c.minPerResolution.Seconds()))
+func (c *DataPromSource) GetCpuUsageSample(name DataSourceObjectName) (DataSample, error) {
+	query, err := c.cpuUsageQuery(name)
+	if err != nil {
+		return DataSample{}, err
+	}
 
-		queryContainerCPUUsage := fmt.Sprintf(`rate(container_cpu_usage_seconds_total{pod="%s",container="%s",namespace="%s"}[%s:%s])`, name.PodName, name.ContainerName, name.Namespace, durationStr, minPerResolutionStr)
+	return c.querySample("GetCpuUsageSample", query)
+}
 
-		results, err := c.ctx.QuerySync(queryContainerCPUUsage)
-		if err != nil {
-			klog.Errorf("GetCpuUsageSample Query failed, err %s", err.Error())
-			return DataSample{}, err
-		}
+// GetMemoryUsageSample returns the memory usage in bytes, which is MemTotal - MemAvailable for node,
+// and the working set for pod and container
+func (c *DataPromSource) GetMemoryUsageSample(name DataSourceObjectName) (DataSample, error) {
+	query, err := c.memoryUsageQuery(name)
+	if err != nil {
+		return DataSample{}, err
+	}
 
-		v, err := GetVectorFromResults(results)
-		if err != nil {
-			klog.Errorf("GetCpuUsageSample get vector failed, err %s", err.Error())
-			return DataSample{}, err
-		}
+	return c.querySample("GetMemoryUsageSample", query)
+}
+
+// GetCpuUsageTimeSeries returns the cpu usage in [start, end] by query_range
+func (c *DataPromSource) GetCpuUsageTimeSeries(name DataSourceObjectName, start, end time.Time, step time.Duration) ([]DataTimeSeries, error) {
+	query, err := c.cpuUsageQuery(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.queryTimeSeries("GetCpuUsageTimeSeries", query, start, end, step)
+}
+
+// GetMemoryUsageTimeSeries returns the memory usage in [start, end] by query_range
+func (c *DataPromSource) GetMemoryUsageTimeSeries(name DataSourceObjectName, start, end time.Time, step time.Duration) ([]DataTimeSeries, error) {
+	query, err := c.memoryUsageQuery(name)
+	if err != nil {
+		return nil, err
+	}
 
-		return Vector2Sample(v), nil
+	return c.queryTimeSeries("GetMemoryUsageTimeSeries", query, start, end, step)
+}
 
+func (c *DataPromSource) cpuUsageQuery(name DataSourceObjectName) (string, error) {
+	if IsNodeDataSourceObject(name) {
+		idle := promql.Vector("node_cpu_seconds_total", promql.Eq("mode", "idle"), promql.Eq(nodeLabelName, name.NodeName))
+		return promql.Build(promql.Sub(promql.Number(1), promql.Avg(promql.Rate(promql.Subquery(idle, c.duration, c.minPerResolution))).By(nodeLabelName)))
+	} else if IsPodDataSourceObject(name) || IsContainerDataSourceObject(name) {
+		usage := promql.Vector("container_cpu_usage_seconds_total", objectMatchers(name)...)
+		return promql.Build(promql.Rate(promql.Subquery(usage, c.duration, c.minPerResolution)))
 	}
-	return DataSample{}, fmt.Errorf("the type of metric is only support (node, pod, container)")
+	return "", fmt.Errorf("the type of metric is only support (node, pod, container)")
 }
 
-func (c *DataPromSource) GetMemoryUsageSample(name DataSourceObjectName) (DataSample, error) {
-	return DataSample{}, fmt.Errorf("the type of metric is only support (node, pod, container)")
+func (c *DataPromSource) memoryUsageQuery(name DataSourceObjectName) (string, error) {
+	if IsNodeDataSourceObject(name) {
+		return promql.Sub(nodeVector("node_memory_MemTotal_bytes", name), nodeVector("node_memory_MemAvailable_bytes", name)).String(), nil
+	} else if IsPodDataSourceObject(name) || IsContainerDataSourceObject(name) {
+		return promql.Vector("container_memory_working_set_bytes", objectMatchers(name)...).String(), nil
+	}
+	return "", fmt.Errorf("the type of metric is only support (node, pod, container)")
+}
+
+// GetCpuUsageSamples returns the cpu usage of the names by one query, the names must be the same type
+func (c *DataPromSource) GetCpuUsageSamples(names []DataSourceObjectName) (map[DataSourceObjectName]DataSample, error) {
+	if len(names) == 0 {
+		return map[DataSourceObjectName]DataSample{}, nil
+	}
+
+	t, err := namesObjectType(names)
+	if err != nil {
+		return nil, err
+	}
+
+	matchers, err := namesMatchers(t, names)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := c.cpuUsageBatchQuery(t, matchers, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	samples, err := c.queryBatchSamples("GetCpuUsageSamples", t, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterSamples(samples, names), nil
+}
+
+// GetCpuUsageSamplesBySelector returns the cpu usage of the objects matching the selector by one query
+func (c *DataPromSource) GetCpuUsageSamplesBySelector(selector DataSourceSelector) (map[DataSourceObjectName]DataSample, error) {
+	matchers, join, err := selectorMatchers(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := c.cpuUsageBatchQuery(selector.DataSourceObjectType, matchers, join)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.queryBatchSamples("GetCpuUsageSamplesBySelector", selector.DataSourceObjectType, query)
+}
+
+// GetMemoryUsageSamples returns the memory usage of the names by one query, the names must be the same type
+func (c *DataPromSource) GetMemoryUsageSamples(names []DataSourceObjectName) (map[DataSourceObjectName]DataSample, error) {
+	if len(names) == 0 {
+		return map[DataSourceObjectName]DataSample{}, nil
+	}
+
+	t, err := namesObjectType(names)
+	if err != nil {
+		return nil, err
+	}
+
+	matchers, err := namesMatchers(t, names)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := c.memoryUsageBatchQuery(t, matchers, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	samples, err := c.queryBatchSamples("GetMemoryUsageSamples", t, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterSamples(samples, names), nil
+}
+
+// GetMemoryUsageSamplesBySelector returns the memory usage of the objects matching the selector by one query
+func (c *DataPromSource) GetMemoryUsageSamplesBySelector(selector DataSourceSelector) (map[DataSourceObjectName]DataSample, error) {
+	matchers, join, err := selectorMatchers(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := c.memoryUsageBatchQuery(selector.DataSourceObjectType, matchers, join)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.queryBatchSamples("GetMemoryUsageSamplesBySelector", selector.DataSourceObjectType, query)
+}
+
+// GetMemoryBreakdownSample returns the rss and cache memory usage in bytes
+func (c *DataPromSource) GetMemoryBreakdownSample(name DataSourceObjectName) (DataMemoryBreakdown, error) {
+	var queryRss, queryCache promql.Expr
+
+	if IsNodeDataSourceObject(name) {
+		buffers, cached := nodeVector("node_memory_Buffers_bytes", name), nodeVector("node_memory_Cached_bytes", name)
+		queryRss = promql.Sub(promql.Sub(promql.Sub(nodeVector("node_memory_MemTotal_bytes", name), nodeVector("node_memory_MemFree_bytes", name)), buffers), cached)
+		queryCache = promql.Add(buffers, cached)
+	} else if IsPodDataSourceObject(name) || IsContainerDataSourceObject(name) {
+		queryRss = promql.Vector("container_memory_rss", objectMatchers(name)...)
+		queryCache = promql.Vector("container_memory_cache", objectMatchers(name)...)
+	} else {
+		return DataMemoryBreakdown{}, fmt.Errorf("the type of metric is only support (node, pod, container)")
+	}
+
+	resChs := c.ctx.QueryAll(queryRss.String(), queryCache.String())
+
+	rss, err := awaitSample("GetMemoryBreakdownSample", resChs[0])
+	cache, cacheErr := awaitSample("GetMemoryBreakdownSample", resChs[1])
+	if err != nil {
+		return DataMemoryBreakdown{}, err
+	}
+	if cacheErr != nil {
+		return DataMemoryBreakdown{}, cacheErr
+	}
+
+	return DataMemoryBreakdown{Rss: rss, Cache: cache}, nil
+}
+
+// cpuUsageBatchQuery returns the query of the cpu usage grouped by the objects of the type, join is
+// the kube_pod_labels selector to filter the pods by labels
+func (c *DataPromSource) cpuUsageBatchQuery(t DataSourceObjectType, matchers []promql.LabelMatcher, join *promql.VectorSelector) (string, error) {
+	var query promql.Expr
+	switch t {
+	case DataSourceObjectNode:
+		idle := promql.Vector("node_cpu_seconds_total", promql.Eq("mode", "idle")).Where(matchers...)
+		query = promql.Sub(promql.Number(1), promql.Avg(promql.Rate(promql.Subquery(idle, c.duration, c.minPerResolution))).By(nodeLabelName))
+	case DataSourceObjectPod, DataSourceObjectContainer:
+		usage := promql.Vector("container_cpu_usage_seconds_total", containerMatchers(t)...).Where(matchers...)
+		labelNames, _ := groupLabelNames(t)
+		query = promql.Sum(promql.Rate(promql.Subquery(usage, c.duration, c.minPerResolution))).By(labelNames...)
+	default:
+		return "", fmt.Errorf("the type of metric is only support (node, pod, container)")
+	}
+
+	return promql.Build(joinPodLabels(query, join))
+}
+
+// memoryUsageBatchQuery returns the query of the memory usage grouped by the objects of the type, join is
+// the kube_pod_labels selector to filter the pods by labels
+func (c *DataPromSource) memoryUsageBatchQuery(t DataSourceObjectType, matchers []promql.LabelMatcher, join *promql.VectorSelector) (string, error) {
+	var query promql.Expr
+	switch t {
+	case DataSourceObjectNode:
+		query = promql.Sum(promql.Sub(promql.Vector("node_memory_MemTotal_bytes", matchers...),
+			promql.Vector("node_memory_MemAvailable_bytes", matchers...))).By(nodeLabelName)
+	case DataSourceObjectPod, DataSourceObjectContainer:
+		usage := promql.Vector("container_memory_working_set_bytes", containerMatchers(t)...).Where(matchers...)
+		labelNames, _ := groupLabelNames(t)
+		query = promql.Sum(usage).By(labelNames...)
+	default:
+		return "", fmt.Errorf("the type of metric is only support (node, pod, container)")
+	}
+
+	return joinPodLabels(query, join).String(), nil
+}
+
+// queryBatchSamples runs the instant query and matches the results back to the objects of the type
+func (c *DataPromSource) queryBatchSamples(caller string, t DataSourceObjectType, query string) (map[DataSourceObjectName]DataSample, error) {
+	results, err := c.ctx.QuerySync(query)
+	if err != nil {
+		klog.Errorf("%s Query failed, err %s", caller, err.Error())
+		return nil, err
+	}
+
+	return Results2Samples(t, results), nil
+}
+
+// querySample runs the instant query and returns the single sample of the result
+func (c *DataPromSource) querySample(caller string, query string) (DataSample, error) {
+	results, err := c.ctx.QuerySync(query)
+	return resultsToSample(caller, results, err)
+}
+
+// queryTimeSeries runs the range query and returns all the series of the result
+func (c *DataPromSource) queryTimeSeries(caller string, query string, start, end time.Time, step time.Duration) ([]DataTimeSeries, error) {
+	results, err := c.ctx.QueryRangeSync(query, start, end, step)
+	if err != nil {
+		klog.Errorf("%s QueryRange failed, err %s", caller, err.Error())
+		return nil, err
+	}
+
+	return Results2TimeSeries(results), nil
+}
+
+// awaitSample waits for the query results and returns the single sample of the result
+func awaitSample(caller string, resCh prom.QueryResultsChan) (DataSample, error) {
+	results, err := resCh.Await()
+	return resultsToSample(caller, results, err)
+}
+
+func resultsToSample(caller string, results []*prom.QueryResult, err error) (DataSample, error) {
+	if err != nil {
+		klog.Errorf("%s Query failed, err %s", caller, err.Error())
+		return DataSample{}, err
+	}
+
+	v, err := GetVectorFromResults(results)
+	if err != nil {
+		klog.Errorf("%s get vector failed, err %s", caller, err.Error())
+		return DataSample{}, err
+	}
+
+	return Vector2Sample(v), nil
 }
 
 func GetVectorFromResults(results []*prom.QueryResult) (util.Vector, error) {
@@ -0,0 +1,295 @@
+package dsf
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/prom"
+)
+
+// newTestPromServer starts a fake prometheus which answers queries with the value returned by values,
+// queries without a value get an empty result. Range queries get the value at 1600000000 and 1600000060.
+func newTestPromServer(t *testing.T, values func(query string) (float64, bool)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form failed %s", err.Error())
+		}
+
+		isRange := strings.HasSuffix(r.URL.Path, "/query_range")
+		resultType := "vector"
+		if isRange {
+			resultType = "matrix"
+		}
+
+		query := r.Form.Get("query")
+		v, ok := values(query)
+		if !ok {
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"%s","result":[]}}`, resultType)
+			return
+		}
+
+		if isRange {
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"pod":"pod1"},"values":[[1600000000,"%g"],[1600000060,"%g"]]}]}}`, v, v)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1600000000,"%g"]}]}}`, v)
+	}))
+}
+
+func newTestPromSource(t *testing.T, address string) *DataPromSource {
+	source, err := NewDataPromSource(&DataSourcePromConfig{
+		Address:   address,
+		Timeout:   10 * time.Second,
+		KeepAlive: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewDataPromSource failed %s", err.Error())
+	}
+
+	return source
+}
+
+func TestDataPromSource_GetMemoryUsageSample(t *testing.T) {
+	queries := map[string]float64{
+		`node_memory_MemTotal_bytes{instance="node1"} - node_memory_MemAvailable_bytes{instance="node1"}`: 1024,
+		`container_memory_working_set_bytes{pod="pod1",container="",namespace="ns1"}`:                     2048,
+		`container_memory_working_set_bytes{pod="pod1",container="c1",namespace="ns1"}`:                   4096,
+	}
+
+	server := newTestPromServer(t, func(query string) (float64, bool) {
+		v, ok := queries[query]
+		return v, ok
+	})
+	defer server.Close()
+
+	source := newTestPromSource(t, server.URL)
+
+	testCases := map[string]struct {
+		name     DataSourceObjectName
+		expected float64
+	}{
+		"node": {
+			name:     NewNodeDataSourceObject("node1"),
+			expected: 1024,
+		},
+		"pod": {
+			name:     NewPodDataSourceObject("pod1", "ns1"),
+			expected: 2048,
+		},
+		"container": {
+			name:     NewContainerDataSourceObject("pod1", "ns1", "c1"),
+			expected: 4096,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sample, err := source.GetMemoryUsageSample(test.name)
+			if err != nil {
+				t.Fatalf("GetMemoryUsageSample failed %s", err.Error())
+			}
+			if sample.Value != test.expected {
+				t.Fatalf("GetMemoryUsageSample: exp (%f); act (%f)", test.expected, sample.Value)
+			}
+		})
+	}
+}
+
+func TestDataPromSource_GetMemoryBreakdownSample(t *testing.T) {
+	queries := map[string]float64{
+		`container_memory_rss{pod="pod1",container="c1",namespace="ns1"}`:   100,
+		`container_memory_cache{pod="pod1",container="c1",namespace="ns1"}`: 200,
+	}
+
+	server := newTestPromServer(t, func(query string) (float64, bool) {
+		v, ok := queries[query]
+		return v, ok
+	})
+	defer server.Close()
+
+	source := newTestPromSource(t, server.URL)
+
+	breakdown, err := source.GetMemoryBreakdownSample(NewContainerDataSourceObject("pod1", "ns1", "c1"))
+	if err != nil {
+		t.Fatalf("GetMemoryBreakdownSample failed %s", err.Error())
+	}
+	if breakdown.Rss.Value != 100 || breakdown.Cache.Value != 200 {
+		t.Fatalf("GetMemoryBreakdownSample: exp (100, 200); act (%f, %f)", breakdown.Rss.Value, breakdown.Cache.Value)
+	}
+
+	if _, err := source.GetMemoryBreakdownSample(NewContainerDataSourceObject("pod2", "ns1", "c1")); err == nil {
+		t.Fatalf("GetMemoryBreakdownSample expected error for empty result")
+	}
+}
+
+func TestDataPromSource_GetMemoryUsageTimeSeries(t *testing.T) {
+	server := newTestPromServer(t, func(query string) (float64, bool) {
+		return 2048, query == `container_memory_working_set_bytes{pod="pod1",container="",namespace="ns1"}`
+	})
+	defer server.Close()
+
+	source := newTestPromSource(t, server.URL)
+
+	end := time.Unix(1600000060, 0)
+	series, err := source.GetMemoryUsageTimeSeries(NewPodDataSourceObject("pod1", "ns1"), end.Add(-time.Minute), end, time.Minute)
+	if err != nil {
+		t.Fatalf("GetMemoryUsageTimeSeries failed %s", err.Error())
+	}
+
+	if len(series) != 1 || len(series[0].Samples) != 2 {
+		t.Fatalf("GetMemoryUsageTimeSeries unexpected result %+v", series)
+	}
+	if series[0].Labels["pod"] != "pod1" {
+		t.Fatalf("GetMemoryUsageTimeSeries labels: exp (pod1); act (%s)", series[0].Labels["pod"])
+	}
+	if series[0].Samples[1].Value != 2048 || !series[0].Samples[1].Timestamp.Equal(end) {
+		t.Fatalf("GetMemoryUsageTimeSeries unexpected sample %+v", series[0].Samples[1])
+	}
+}
+
+func TestGetVectorFromResults_Scalar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"scalar","result":[1600000000,"4"]}}`)
+	}))
+	defer server.Close()
+
+	source := newTestPromSource(t, server.URL)
+	results, err := source.ctx.QuerySync("scalar(count(kube_node_info))")
+	if err != nil {
+		t.Fatalf("QuerySync failed %s", err.Error())
+	}
+
+	v, err := GetVectorFromResults(results)
+	if err != nil || v.Value != 4 || v.Timestamp != 1600000000 {
+		t.Errorf("expected the scalar vector, got %v %v", v, err)
+	}
+}
+
+func TestDownsampleSamples(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+
+	var samples []DataSample
+	for i := 0; i < 6; i++ {
+		samples = append(samples, DataSample{Value: float64(i), Timestamp: start.Add(time.Duration(i) * 20 * time.Second)})
+	}
+
+	result := DownsampleSamples(samples, start, time.Minute)
+
+	expected := []float64{2, 5}
+	if len(result) != len(expected) {
+		t.Fatalf("DownsampleSamples length: exp (%d); act (%d)", len(expected), len(result))
+	}
+	for i, v := range expected {
+		if result[i].Value != v {
+			t.Fatalf("DownsampleSamples[%d]: exp (%f); act (%f)", i, v, result[i].Value)
+		}
+	}
+
+	if len(DownsampleSamples(samples, start, 0)) != len(samples) {
+		t.Fatalf("DownsampleSamples expected all the samples without step")
+	}
+}
+
+func TestDataPromSource_EscapeLabelValues(t *testing.T) {
+	name := NewContainerDataSourceObject(`pod1"} or vector(1) #`, `ns\1`, "c1")
+
+	testCases := map[string]struct {
+		query    func() (string, error)
+		expected string
+	}{
+		"cpu": {
+			query: func() (string, error) {
+				return (&DataPromSource{duration: time.Minute, minPerResolution: time.Minute}).cpuUsageQuery(name)
+			},
+			expected: `rate(container_cpu_usage_seconds_total{pod="pod1\"} or vector(1) #",container="c1",namespace="ns\\1"}[1m:1m])`,
+		},
+		"memory": {
+			query: func() (string, error) {
+				return (&DataPromSource{}).memoryUsageQuery(name)
+			},
+			expected: `container_memory_working_set_bytes{pod="pod1\"} or vector(1) #",container="c1",namespace="ns\\1"}`,
+		},
+		"batch": {
+			query: func() (string, error) {
+				matchers, err := namesMatchers(DataSourceObjectContainer, []DataSourceObjectName{name, NewContainerDataSourceObject("pod.2", `ns\1`, "c1")})
+				if err != nil {
+					return "", err
+				}
+				return (&DataPromSource{}).memoryUsageBatchQuery(DataSourceObjectContainer, matchers, nil)
+			},
+			expected: `sum(container_memory_working_set_bytes{container!="",container!="POD",namespace="ns\\1",pod=~"pod1\"\\} or vector\\(1\\) #|pod\\.2",container="c1"}) by (namespace, pod, container)`,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			query, err := test.query()
+			if err != nil {
+				t.Fatalf("query failed %s", err.Error())
+			}
+			if query != test.expected {
+				t.Fatalf("query: exp (%s); act (%s)", test.expected, query)
+			}
+		})
+	}
+}
+
+func TestDataPromSource_CheckPrometheus(t *testing.T) {
+	var healthChecks int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/query":
+			atomic.AddInt32(&healthChecks, 1)
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		case "/api/v1/status/buildinfo":
+			fmt.Fprint(w, `{"status":"success","data":{"version":"2.30.3"}}`)
+		case "/api/v1/targets":
+			fmt.Fprint(w, `{"status":"success","data":{"activeTargets":[
+				{"labels":{"job":"node-exporter"},"health":"up"},
+				{"labels":{"job":"kubelet"},"health":"down","lastError":"connection refused"}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	source := newTestPromSource(t, server.URL)
+	reqCtx := context.Background()
+
+	if err := source.CheckPrometheus(reqCtx, "node-exporter"); err != nil {
+		t.Errorf("expected the node-exporter healthy, got %v", err)
+	}
+	if err := source.CheckPrometheus(reqCtx, defaultTargetJobs...); err == nil || !strings.Contains(err.Error(), "kubelet") {
+		t.Errorf("expected the kubelet targets unhealthy, got %v", err)
+	}
+
+	for _, sourceType := range []DataSourceType{DataSourcePromType, DataSourcePromRemoteReadType} {
+		_, err := DataSourceFactory(sourceType, DataSourceConfig{DataSourcePromConfig: &DataSourcePromConfig{
+			Address:          server.URL,
+			Timeout:          10 * time.Second,
+			KeepAlive:        10 * time.Second,
+			StartupCheck:     true,
+			RateLimit:        true,
+			QueryConcurrency: 1,
+			ReplicaAddresses: []string{server.URL},
+			Failover:         &prom.FailoverConfig{HealthCheckInterval: 10 * time.Millisecond},
+		}}, nil)
+		if err == nil {
+			t.Errorf("%s: expected the startup check to fail", sourceType)
+		}
+
+		// the client of the failed source is closed, so its health checks are stopped
+		checks := atomic.LoadInt32(&healthChecks)
+		time.Sleep(100 * time.Millisecond)
+		if atomic.LoadInt32(&healthChecks) != checks {
+			t.Errorf("%s: expected the client closed after the failed startup check", sourceType)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package dsf
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/prom"
+	"github.com/open-resource-management/metricsclient/pkg/prom/prompb"
+	"github.com/open-resource-management/metricsclient/pkg/prom/promql"
+	"github.com/open-resource-management/metricsclient/pkg/util"
+
+	"k8s.io/klog"
+)
+
+// metricNameLabel is the label of the metric name, which is dropped from the series computed from
+// the raw samples as by PromQL
+const metricNameLabel = "__name__"
+
+// DataPromRemoteReadSource reads the time series from the raw samples of the prometheus remote read,
+// so PromQL is not evaluated by the server for the long windows. The samples are queried as by
+// DataPromSource.
+type DataPromRemoteReadSource struct {
+	*DataPromSource
+
+	// reader is the context of the remote reads, a clone of the context of the queries so the remote
+	// reads are sent and reported as the queries, but its timestamps are not rounded by default
+	reader *prom.Context
+}
+
+func NewDataPromRemoteReadSource(config *DataSourcePromConfig) (*DataPromRemoteReadSource, error) {
+	klog.Infof("NewDataPromRemoteReadSource")
+
+	source, err := NewDataPromSource(config)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := source.ctx.Clone()
+	reader.SetTimestampPrecision(0)
+	if config.TimestampPrecision != nil {
+		reader.SetTimestampPrecision(*config.TimestampPrecision)
+	}
+	if config.RemoteRead != nil {
+		reader.SetRemoteReadConfig(config.RemoteRead)
+	}
+
+	return &DataPromRemoteReadSource{DataPromSource: source, reader: reader}, nil
+}
+
+// GetCpuUsageTimeSeries returns the cpu usage in [start, end], the rate of the cpu counters is computed
+// over the duration of DataPromSource from the raw samples, and the last sample of each step is kept.
+// The series has a point for each step as the rate of DataPromSource, but at the time of the last
+// sample of the step instead of the step boundary, unless the samples are scraped at the boundaries.
+func (c *DataPromRemoteReadSource) GetCpuUsageTimeSeries(name DataSourceObjectName, start, end time.Time, step time.Duration) ([]DataTimeSeries, error) {
+	var query *prompb.Query
+	if IsNodeDataSourceObject(name) {
+		query = remoteReadQuery("node_cpu_seconds_total", start.Add(-c.duration), end, promql.Eq("mode", "idle"), promql.Eq(nodeLabelName, name.NodeName))
+	} else if IsPodDataSourceObject(name) || IsContainerDataSourceObject(name) {
+		query = remoteReadQuery("container_cpu_usage_seconds_total", start.Add(-c.duration), end, objectMatchers(name)...)
+	} else {
+		return nil, fmt.Errorf("the type of metric is only support (node, pod, container)")
+	}
+
+	results, err := c.remoteRead("GetCpuUsageTimeSeries", query)
+	if err != nil {
+		return nil, err
+	}
+
+	series := Results2TimeSeries(results[0])
+	for i := range series {
+		delete(series[i].Labels, metricNameLabel)
+		series[i].Samples = CounterRate(series[i].Samples, c.duration)
+	}
+
+	// the node usage is 1 - the average idle rate of its cpus
+	if IsNodeDataSourceObject(name) && len(series) > 0 {
+		idle := averageSamples(series)
+		for i := range idle {
+			idle[i].Value = 1 - idle[i].Value
+		}
+		series = []DataTimeSeries{{Labels: map[string]string{nodeLabelName: name.NodeName}, Samples: idle}}
+	}
+
+	return stepTimeSeries(series, start, step), nil
+}
+
+// GetMemoryUsageTimeSeries returns the memory usage in [start, end] from the raw samples, the last
+// sample of each step is kept
+func (c *DataPromRemoteReadSource) GetMemoryUsageTimeSeries(name DataSourceObjectName, start, end time.Time, step time.Duration) ([]DataTimeSeries, error) {
+	if IsNodeDataSourceObject(name) {
+		results, err := c.remoteRead("GetMemoryUsageTimeSeries",
+			remoteReadQuery("node_memory_MemTotal_bytes", start, end, promql.Eq(nodeLabelName, name.NodeName)),
+			remoteReadQuery("node_memory_MemAvailable_bytes", start, end, promql.Eq(nodeLabelName, name.NodeName)))
+		if err != nil {
+			return nil, err
+		}
+
+		return stepTimeSeries(subtractResults(results[0], results[1]), start, step), nil
+	} else if IsPodDataSourceObject(name) || IsContainerDataSourceObject(name) {
+		results, err := c.remoteRead("GetMemoryUsageTimeSeries",
+			remoteReadQuery("container_memory_working_set_bytes", start, end, objectMatchers(name)...))
+		if err != nil {
+			return nil, err
+		}
+
+		series := Results2TimeSeries(results[0])
+		for i := range series {
+			delete(series[i].Labels, metricNameLabel)
+		}
+		return stepTimeSeries(series, start, step), nil
+	}
+
+	return nil, fmt.Errorf("the type of metric is only support (node, pod, container)")
+}
+
+// remoteRead reads the raw samples of the queries
+func (c *DataPromRemoteReadSource) remoteRead(caller string, queries ...*prompb.Query) ([][]*prom.QueryResult, error) {
+	results, err := c.reader.RemoteRead(context.Background(), queries...)
+	if err != nil {
+		klog.Errorf("%s RemoteRead failed, err %s", caller, err.Error())
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// remoteReadQuery returns the remote read query of the series of the metric matching the matchers
+func remoteReadQuery(metric string, start, end time.Time, matchers ...promql.LabelMatcher) *prompb.Query {
+	remoteMatchers := []*prompb.LabelMatcher{{Type: prompb.MatchEqual, Name: metricNameLabel, Value: metric}}
+	for _, m := range matchers {
+		remoteMatchers = append(remoteMatchers, &prompb.LabelMatcher{Type: remoteMatchType(m.Type), Name: m.Name, Value: m.Value})
+	}
+
+	return prom.NewRemoteReadQuery(start, end, remoteMatchers...)
+}
+
+func remoteMatchType(t promql.MatchType) prompb.MatchType {
+	switch t {
+	case promql.MatchNotEqual:
+		return prompb.MatchNotEqual
+	case promql.MatchRegexp:
+		return prompb.MatchRegexp
+	case promql.MatchNotRegexp:
+		return prompb.MatchNotRegexp
+	}
+	return prompb.MatchEqual
+}
+
+// subtractResults returns the series of x - y, the series are matched by their labels without the
+// metric name, and the samples by their timestamps
+func subtractResults(xs, ys []*prom.QueryResult) []DataTimeSeries {
+	subtract := func(result *util.Vector, x *float64, y *float64) bool {
+		if x == nil || y == nil {
+			return false
+		}
+		result.Value = *x - *y
+		return true
+	}
+
+	ySeries := map[string]*prom.QueryResult{}
+	for _, y := range ys {
+		ySeries[seriesKey(y.Metric)] = y
+	}
+
+	var series []DataTimeSeries
+	for _, x := range xs {
+		y, ok := ySeries[seriesKey(x.Metric)]
+		if !ok {
+			continue
+		}
+
+		result := &prom.QueryResult{Metric: x.Metric, Values: util.ApplyVectorOpWithPrecision(x.Values, y.Values, subtract, 0)}
+		s := Results2TimeSeries([]*prom.QueryResult{result})[0]
+		delete(s.Labels, metricNameLabel)
+		series = append(series, s)
+	}
+
+	return series
+}
+
+// seriesKey returns the key of the labels of the metric without the metric name
+func seriesKey(metric map[string]interface{}) string {
+	labels := make(map[string]string, len(metric))
+	for k, v := range metric {
+		if s, ok := v.(string); ok && k != metricNameLabel {
+			labels[k] = s
+		}
+	}
+
+	return fmt.Sprint(labels)
+}
+
+// CounterRate returns the per-second rate of the counter samples over the window ending at each
+// sample, from the first sample in the window. The window includes its start as the range of a
+// subquery, so the samples scraped every window have a rate. The counter resets are handled as by
+// the rate of PromQL, without its extrapolation to the window boundaries. The samples must be
+// ordered by time.
+func CounterRate(samples []DataSample, window time.Duration) []DataSample {
+	// increases[i] is the increase of the counter from the first sample to the i-th one
+	increases := make([]float64, len(samples))
+	for i := 1; i < len(samples); i++ {
+		delta := samples[i].Value - samples[i-1].Value
+		if delta < 0 {
+			delta = samples[i].Value
+		}
+		increases[i] = increases[i-1] + delta
+	}
+
+	var result []DataSample
+	first := 0
+	for i := range samples {
+		for samples[i].Timestamp.Sub(samples[first].Timestamp) > window {
+			first++
+		}
+		if first == i {
+			continue
+		}
+
+		elapsed := samples[i].Timestamp.Sub(samples[first].Timestamp).Seconds()
+		result = append(result, DataSample{Timestamp: samples[i].Timestamp, Value: (increases[i] - increases[first]) / elapsed})
+	}
+
+	return result
+}
+
+// averageSamples returns the average of the samples of the series at each timestamp
+func averageSamples(series []DataTimeSeries) []DataSample {
+	sums := map[time.Time]float64{}
+	counts := map[time.Time]int{}
+	for _, s := range series {
+		for _, sample := range s.Samples {
+			sums[sample.Timestamp] += sample.Value
+			counts[sample.Timestamp]++
+		}
+	}
+
+	result := make([]DataSample, 0, len(sums))
+	for ts, sum := range sums {
+		result = append(result, DataSample{Timestamp: ts, Value: sum / float64(counts[ts])})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Timestamp.Before(result[j].Timestamp) })
+
+	return result
+}
+
+// stepTimeSeries drops the samples before start, and keeps the last sample of each step
+func stepTimeSeries(series []DataTimeSeries, start time.Time, step time.Duration) []DataTimeSeries {
+	for i := range series {
+		samples := series[i].Samples
+		first := sort.Search(len(samples), func(j int) bool { return !samples[j].Timestamp.Before(start) })
+		series[i].Samples = DownsampleSamples(samples[first:], start, step)
+	}
+
+	return series
+}
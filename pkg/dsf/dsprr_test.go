@@ -0,0 +1,277 @@
+package dsf
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/prom"
+	"github.com/open-resource-management/metricsclient/pkg/prom/prompb"
+
+	"github.com/golang/snappy"
+)
+
+// newTestRemoteReadServer starts a fake prometheus which answers the remote reads with the sampled
+// response of the series of the metric of each query, the other matchers are checked by matchers.
+func newTestRemoteReadServer(t *testing.T, series map[string][]*prompb.TimeSeries, matchers map[string][]*prompb.LabelMatcher) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, _ := ioutil.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("snappy Decode failed %s", err.Error())
+		}
+		var req prompb.ReadRequest
+		if err := req.Unmarshal(data); err != nil {
+			t.Errorf("Unmarshal failed %s", err.Error())
+		}
+
+		var resp prompb.ReadResponse
+		for _, q := range req.Queries {
+			metric := q.Matchers[0].Value
+			if !reflect.DeepEqual(q.Matchers[1:], matchers[metric]) {
+				t.Errorf("unexpected matchers of %s: %v", metric, q.Matchers[1:])
+			}
+			resp.Results = append(resp.Results, &prompb.QueryResult{Timeseries: series[metric]})
+		}
+
+		b, err := resp.Marshal()
+		if err != nil {
+			t.Errorf("Marshal failed %s", err.Error())
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Header().Set("Content-Encoding", "snappy")
+		_, _ = w.Write(snappy.Encode(nil, b))
+	}))
+}
+
+func newTestRemoteReadSource(t *testing.T, address string) DataSource {
+	config := DataSourceConfig{DataSourcePromConfig: &DataSourcePromConfig{
+		Address:    address,
+		Timeout:    10 * time.Second,
+		KeepAlive:  10 * time.Second,
+		RemoteRead: &prom.RemoteReadConfig{Path: "/api/v1/read", ResponseTypes: []prompb.ResponseType{prompb.ResponseTypeSamples}},
+	}}
+
+	source, err := DataSourceFactory(DataSourcePromRemoteReadType, config, nil)
+	if err != nil {
+		t.Fatalf("DataSourceFactory failed %s", err.Error())
+	}
+
+	return source
+}
+
+func TestDataPromRemoteReadSource_GetCpuUsageTimeSeries(t *testing.T) {
+	labels := func(cpu string) []prompb.Label {
+		return []prompb.Label{{Name: "__name__", Value: "node_cpu_seconds_total"}, {Name: "cpu", Value: cpu}, {Name: "instance", Value: "node1"}, {Name: "mode", Value: "idle"}}
+	}
+	samples := func(values ...float64) []prompb.Sample {
+		var samples []prompb.Sample
+		for i, v := range values {
+			samples = append(samples, prompb.Sample{Timestamp: 1600000000000 + int64(i)*30000, Value: v})
+		}
+		return samples
+	}
+
+	// the idle rate of cpu 0 is 0.5, the one of cpu 1 is 0.25 across its counter reset
+	server := newTestRemoteReadServer(t, map[string][]*prompb.TimeSeries{
+		"node_cpu_seconds_total": {
+			{Labels: labels("0"), Samples: samples(0, 15, 30, 45, 60)},
+			{Labels: labels("1"), Samples: samples(100, 7.5, 15, 22.5, 30)},
+		},
+	}, map[string][]*prompb.LabelMatcher{
+		"node_cpu_seconds_total": {
+			{Type: prompb.MatchEqual, Name: "mode", Value: "idle"},
+			{Type: prompb.MatchEqual, Name: "instance", Value: "node1"},
+		},
+	})
+	defer server.Close()
+
+	source := newTestRemoteReadSource(t, server.URL)
+
+	start := time.Unix(1600000060, 0)
+	series, err := source.GetCpuUsageTimeSeries(NewNodeDataSourceObject("node1"), start, start.Add(time.Minute), 0)
+	if err != nil {
+		t.Fatalf("GetCpuUsageTimeSeries failed %s", err.Error())
+	}
+
+	expected := []DataTimeSeries{{
+		Labels: map[string]string{"instance": "node1"},
+		Samples: []DataSample{
+			{Timestamp: time.Unix(1600000060, 0), Value: 0.625},
+			{Timestamp: time.Unix(1600000090, 0), Value: 0.625},
+			{Timestamp: time.Unix(1600000120, 0), Value: 0.625},
+		},
+	}}
+	if !reflect.DeepEqual(series, expected) {
+		t.Errorf("expected %v, got %v", expected, series)
+	}
+}
+
+func TestDataPromRemoteReadSource_GetMemoryUsageTimeSeries(t *testing.T) {
+	nodeLabels := func(metric string) []prompb.Label {
+		return []prompb.Label{{Name: "__name__", Value: metric}, {Name: "instance", Value: "node1"}}
+	}
+	podLabels := []prompb.Label{{Name: "__name__", Value: "container_memory_working_set_bytes"}, {Name: "namespace", Value: "ns1"}, {Name: "pod", Value: "pod1"}}
+
+	server := newTestRemoteReadServer(t, map[string][]*prompb.TimeSeries{
+		"node_memory_MemTotal_bytes": {{
+			Labels:  nodeLabels("node_memory_MemTotal_bytes"),
+			Samples: []prompb.Sample{{Timestamp: 1600000000000, Value: 8192}, {Timestamp: 1600000015000, Value: 8192}, {Timestamp: 1600000030000, Value: 8192}},
+		}},
+		"node_memory_MemAvailable_bytes": {{
+			Labels:  nodeLabels("node_memory_MemAvailable_bytes"),
+			Samples: []prompb.Sample{{Timestamp: 1600000000000, Value: 6144}, {Timestamp: 1600000030000, Value: 4096}},
+		}},
+		"container_memory_working_set_bytes": {{
+			Labels:  podLabels,
+			Samples: []prompb.Sample{{Timestamp: 1600000000250, Value: 1024}, {Timestamp: 1600000010500, Value: 2048}, {Timestamp: 1600000030750, Value: 3072}},
+		}},
+	}, map[string][]*prompb.LabelMatcher{
+		"node_memory_MemTotal_bytes":     {{Type: prompb.MatchEqual, Name: "instance", Value: "node1"}},
+		"node_memory_MemAvailable_bytes": {{Type: prompb.MatchEqual, Name: "instance", Value: "node1"}},
+		"container_memory_working_set_bytes": {
+			{Type: prompb.MatchEqual, Name: "pod", Value: "pod1"},
+			{Type: prompb.MatchEqual, Name: "container", Value: ""},
+			{Type: prompb.MatchEqual, Name: "namespace", Value: "ns1"},
+		},
+	})
+	defer server.Close()
+
+	source := newTestRemoteReadSource(t, server.URL)
+	start := time.Unix(1600000000, 0)
+
+	testCases := map[string]struct {
+		name     DataSourceObjectName
+		step     time.Duration
+		expected []DataTimeSeries
+	}{
+		"node": {
+			name: NewNodeDataSourceObject("node1"),
+			expected: []DataTimeSeries{{
+				Labels: map[string]string{"instance": "node1"},
+				Samples: []DataSample{
+					{Timestamp: time.Unix(1600000000, 0), Value: 2048},
+					{Timestamp: time.Unix(1600000030, 0), Value: 4096},
+				},
+			}},
+		},
+		"pod": {
+			name: NewPodDataSourceObject("pod1", "ns1"),
+			step: 30 * time.Second,
+			expected: []DataTimeSeries{{
+				Labels: map[string]string{"namespace": "ns1", "pod": "pod1"},
+				Samples: []DataSample{
+					{Timestamp: time.Unix(1600000010, 500*int64(time.Millisecond)), Value: 2048},
+					{Timestamp: time.Unix(1600000030, 750*int64(time.Millisecond)), Value: 3072},
+				},
+			}},
+		},
+	}
+
+	for name, tc := range testCases {
+		series, err := source.GetMemoryUsageTimeSeries(tc.name, start, start.Add(time.Minute), tc.step)
+		if err != nil {
+			t.Fatalf("%s: GetMemoryUsageTimeSeries failed %s", name, err.Error())
+		}
+		if !reflect.DeepEqual(series, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, series)
+		}
+	}
+}
+
+func TestCounterRate(t *testing.T) {
+	samples := []DataSample{
+		{Timestamp: time.Unix(0, 0), Value: 10},
+		{Timestamp: time.Unix(10, 0), Value: 20},
+		{Timestamp: time.Unix(20, 0), Value: 5},
+		{Timestamp: time.Unix(30, 0), Value: 15},
+	}
+
+	expected := []DataSample{
+		{Timestamp: time.Unix(10, 0), Value: 1},
+		{Timestamp: time.Unix(20, 0), Value: 0.75},
+		{Timestamp: time.Unix(30, 0), Value: 25.0 / 30},
+	}
+	if rate := CounterRate(samples, 30*time.Second); !reflect.DeepEqual(rate, expected) {
+		t.Errorf("expected %v, got %v", expected, rate)
+	}
+}
+
+func TestDataPromRemoteReadSource_CpuUsageStepBoundaries(t *testing.T) {
+	// the counter is scraped at the step boundaries from start - duration, every duration
+	start := time.Unix(1600000200, 0)
+	var samples []prompb.Sample
+	for ts := start.Add(-defaultDuration); !ts.After(start.Add(5 * time.Minute)); ts = ts.Add(time.Minute) {
+		samples = append(samples, prompb.Sample{Timestamp: ts.UnixNano() / int64(time.Millisecond), Value: float64(ts.Unix()-start.Unix()) * 0.5})
+	}
+	server := newTestRemoteReadServer(t, map[string][]*prompb.TimeSeries{
+		"container_cpu_usage_seconds_total": {{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "container_cpu_usage_seconds_total"}, {Name: "namespace", Value: "ns1"}, {Name: "pod", Value: "pod1"}},
+			Samples: samples,
+		}},
+	}, map[string][]*prompb.LabelMatcher{
+		"container_cpu_usage_seconds_total": {
+			{Type: prompb.MatchEqual, Name: "pod", Value: "pod1"},
+			{Type: prompb.MatchEqual, Name: "container", Value: ""},
+			{Type: prompb.MatchEqual, Name: "namespace", Value: "ns1"},
+		},
+	})
+	defer server.Close()
+
+	source := newTestRemoteReadSource(t, server.URL)
+	series, err := source.GetCpuUsageTimeSeries(NewPodDataSourceObject("pod1", "ns1"), start, start.Add(5*time.Minute), time.Minute)
+	if err != nil {
+		t.Fatalf("GetCpuUsageTimeSeries failed %s", err.Error())
+	}
+
+	// the range query of the rate of DataPromSource has a point at each step boundary in [start, end]
+	var expected []DataSample
+	for ts := start; !ts.After(start.Add(5 * time.Minute)); ts = ts.Add(time.Minute) {
+		expected = append(expected, DataSample{Timestamp: ts, Value: 0.5})
+	}
+	if len(series) != 1 || !reflect.DeepEqual(series[0].Samples, expected) {
+		t.Errorf("expected %v, got %v", expected, series)
+	}
+}
+
+func TestDataPromRemoteReadSource_ErrorCollector(t *testing.T) {
+	// the first remote read is retried, then it gets no series
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := (&prompb.ReadResponse{Results: []*prompb.QueryResult{{}}}).Marshal()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = w.Write(snappy.Encode(nil, b))
+	}))
+	defer server.Close()
+
+	policy := prom.DefaultRetryPolicy()
+	policy.BaseBackoff = time.Millisecond
+	source, err := NewDataPromRemoteReadSource(&DataSourcePromConfig{
+		Address:     server.URL,
+		Timeout:     10 * time.Second,
+		KeepAlive:   10 * time.Second,
+		RetryPolicy: policy,
+	})
+	if err != nil {
+		t.Fatalf("NewDataPromRemoteReadSource failed %s", err.Error())
+	}
+
+	start := time.Unix(1600000000, 0)
+	if _, err := source.GetMemoryUsageTimeSeries(NewPodDataSourceObject("pod1", "ns1"), start, start.Add(time.Minute), 0); err != nil {
+		t.Fatalf("GetMemoryUsageTimeSeries failed %s", err.Error())
+	}
+
+	// the retry of the remote read is reported with the warnings of the queries
+	warnings := source.ctx.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].String(), "attempt 1/3 failed") {
+		t.Errorf("expected the retry warning of the remote read, got %v", warnings)
+	}
+}
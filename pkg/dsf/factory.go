@@ -16,15 +16,41 @@ type DataSourceConfig struct {
 	*DataSourceNodeLocalConfig
 }
 
+// DataSourcePromConfig is the configuration of the prometheus data sources, the fields which are
+// nil or empty fall back to the defaults of the prom package
 type DataSourcePromConfig struct {
-	address            string
-	timeout            time.Duration
-	keepAlive          time.Duration
-	insecureSkipVerify bool
-	auth               *prom.ClientAuth
-
-	queryConcurrency int
-	bRateLimit       bool
+	Address            string           `json:"address"`
+	Timeout            time.Duration    `json:"timeout"`
+	KeepAlive          time.Duration    `json:"keep_alive"`
+	InsecureSkipVerify bool             `json:"insecure_skip_verify"`
+	TLS                *prom.TLSConfig  `json:"tls,omitempty"`
+	Auth               *prom.ClientAuth `json:"auth,omitempty"`
+	// AuthProvider authenticates the requests instead of Auth, e.g. with refreshed tokens
+	AuthProvider   prom.AuthProvider          `json:"-"`
+	RetryPolicy    *prom.RetryPolicy          `json:"retry_policy,omitempty"`
+	QPSLimit       *prom.QPSLimit             `json:"qps_limit,omitempty"`
+	CircuitBreaker *prom.CircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+	// Tenants are sent in the X-Scope-OrgID header, Headers are sent with every request
+	Tenants []string          `json:"tenants,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// QueryParamsDecorator decorates all the queries, ContextDecorators the ones of the named contexts
+	QueryParamsDecorator prom.QueryParamsDecorator            `json:"-"`
+	ContextDecorators    map[string]prom.QueryParamsDecorator `json:"-"`
+	// TimestampPrecision is the precision the timestamps are rounded to, 0 for no rounding
+	TimestampPrecision *time.Duration `json:"timestamp_precision,omitempty"`
+	// StartupCheck checks the subqueries and the targets of the TargetJobs when the source is
+	// created, see DataPromSource.CheckPrometheus
+	StartupCheck bool     `json:"startup_check"`
+	TargetJobs   []string `json:"target_jobs,omitempty"`
+
+	QueryConcurrency int  `json:"query_concurrency"`
+	RateLimit        bool `json:"rate_limit"`
+
+	// ReplicaAddresses are the other prometheus replicas of Address, which are failed over to
+	ReplicaAddresses []string             `json:"replica_addresses,omitempty"`
+	Failover         *prom.FailoverConfig `json:"failover,omitempty"`
+	// RemoteRead is the configuration of the remote reads of DataSourcePromRemoteReadType
+	RemoteRead *prom.RemoteReadConfig `json:"remote_read,omitempty"`
 }
 
 type DataSourceNodeLocalConfig struct {
@@ -44,6 +70,13 @@ func DataSourceFactory(t DataSourceType, config DataSourceConfig, podInformer ca
 			}
 			return NewDataPromSource(config.DataSourcePromConfig)
 		}
+	case DataSourcePromRemoteReadType:
+		{
+			if config.DataSourcePromConfig == nil {
+				return nil, fmt.Errorf("DataSourcePromConfig is nil")
+			}
+			return NewDataPromRemoteReadSource(config.DataSourcePromConfig)
+		}
 	case DataSourceNodeLocaleType:
 		{
 			if config.DataSourceNodeLocalConfig == nil {
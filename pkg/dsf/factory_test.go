@@ -0,0 +1,57 @@
+package dsf_test
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/dsf"
+	"github.com/open-resource-management/metricsclient/pkg/prom"
+)
+
+// TestDataSourceFactory_TLS configures the prometheus data source from outside the package
+func TestDataSourceFactory_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(prom.TenantHeader) != "team-a" {
+			t.Errorf("unexpected tenant %q", r.Header.Get(prom.TenantHeader))
+		}
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1600000000,"0.5"]}]}}`))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "dsf")
+	if err != nil {
+		t.Fatalf("create temp dir failed %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatalf("write %s failed %s", caFile, err.Error())
+	}
+
+	source, err := dsf.DataSourceFactory(dsf.DataSourcePromType, dsf.DataSourceConfig{DataSourcePromConfig: &dsf.DataSourcePromConfig{
+		Address:   server.URL,
+		Timeout:   10 * time.Second,
+		KeepAlive: 10 * time.Second,
+		TLS:       &prom.TLSConfig{CAFile: caFile, ServerName: "example.com"},
+		Tenants:   []string{"team-a"},
+	}}, nil)
+	if err != nil {
+		t.Fatalf("DataSourceFactory failed %s", err.Error())
+	}
+
+	sample, err := source.GetCpuUsageSample(dsf.NewNodeDataSourceObject("node1"))
+	if err != nil {
+		t.Fatalf("GetCpuUsageSample failed %s", err.Error())
+	}
+	if sample.Value != 0.5 {
+		t.Errorf("expected 0.5, got %v", sample.Value)
+	}
+}
@@ -1,6 +1,28 @@
 package dsf
 
+import (
+	"time"
+)
+
+// DataSource reads the resource usage of the nodes, pods and containers. All the data sources return
+// the same units: the node cpu usage is the busy ratio of the node in the range [0, 1], the pod and
+// container cpu usage is in cores, and the memory usage is in bytes.
 type DataSource interface {
 	GetCpuUsageSample(name DataSourceObjectName) (DataSample, error)
 	GetMemoryUsageSample(name DataSourceObjectName) (DataSample, error)
+	GetMemoryBreakdownSample(name DataSourceObjectName) (DataMemoryBreakdown, error)
+
+	// GetCpuUsageTimeSeries returns the cpu usage in [start, end] with the given step
+	GetCpuUsageTimeSeries(name DataSourceObjectName, start, end time.Time, step time.Duration) ([]DataTimeSeries, error)
+	// GetMemoryUsageTimeSeries returns the memory usage in [start, end] with the given step
+	GetMemoryUsageTimeSeries(name DataSourceObjectName, start, end time.Time, step time.Duration) ([]DataTimeSeries, error)
+
+	// GetCpuUsageSamples returns the cpu usage of the names, which must be the same type
+	GetCpuUsageSamples(names []DataSourceObjectName) (map[DataSourceObjectName]DataSample, error)
+	// GetCpuUsageSamplesBySelector returns the cpu usage of the objects matching the selector
+	GetCpuUsageSamplesBySelector(selector DataSourceSelector) (map[DataSourceObjectName]DataSample, error)
+	// GetMemoryUsageSamples returns the memory usage of the names, which must be the same type
+	GetMemoryUsageSamples(names []DataSourceObjectName) (map[DataSourceObjectName]DataSample, error)
+	// GetMemoryUsageSamplesBySelector returns the memory usage of the objects matching the selector
+	GetMemoryUsageSamplesBySelector(selector DataSourceSelector) (map[DataSourceObjectName]DataSample, error)
 }
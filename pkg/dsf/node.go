@@ -2,13 +2,13 @@ package dsf
 
 import (
 	"fmt"
-	"time"
 
 	"github.com/open-resource-management/metricsclient/pkg/stats"
 	"github.com/open-resource-management/metricsclient/pkg/types"
 )
 
-// nodeCpuUsage return cpu usage for node
+// GetNodeCpuUsage return cpu usage for node, the total is in cores and the usage of each core is in
+// the range [0, 1]
 func GetNodeCpuUsage(nodeStats stats.NodeStats) types.MetricValues {
 	result, err := nodeStats.GetResourceStats(types.CpuUsageMetrics)
 	if err != nil {
@@ -32,7 +32,17 @@ func GetNodeCpuUsage(nodeStats stats.NodeStats) types.MetricValues {
 	return values
 }
 
-// nodeMemoryUsage return memory usage for node
+// NodeCpuUsageRatio returns the busy ratio of the node in the range [0, 1], which is the node cpu
+// usage of all the data sources, the same as 1 - avg(rate(node_cpu_seconds_total{mode="idle"}))
+func NodeCpuUsageRatio(nodeCpu *stats.NodeCpu) float64 {
+	if len(nodeCpu.CpuPerCore) == 0 {
+		return 0
+	}
+	return nodeCpu.CpuTotal / float64(len(nodeCpu.CpuPerCore))
+}
+
+// GetNodeMemoryUsage return memory usage for node in bytes, the working set is the node memory usage
+// of the data sources
 func GetNodeMemoryUsage(nodeStats stats.NodeStats) types.MetricValues {
 	result, err := nodeStats.GetResourceStats(types.MemoryUsageMetrics)
 	if err != nil {
@@ -41,24 +51,24 @@ func GetNodeMemoryUsage(nodeStats stats.NodeStats) types.MetricValues {
 	res := result.(*stats.NodeMemory)
 	return types.MetricValues{
 		{
-			Value:     bytesToGi(res.UsageTotal),
+			Value:     res.UsageTotal,
 			Timestamp: res.Timestamp,
 			Labels:    []string{"total"},
 		},
 		{
-			Value:     bytesToGi(res.UsageRss),
+			Value:     res.WorkingSet,
+			Timestamp: res.Timestamp,
+			Labels:    []string{"working_set"},
+		},
+		{
+			Value:     res.UsageRss,
 			Timestamp: res.Timestamp,
 			Labels:    []string{"rss"},
 		},
 		{
-			Value:     bytesToGi(res.UsageCache),
+			Value:     res.UsageCache,
 			Timestamp: res.Timestamp,
 			Labels:    []string{"cache"},
 		},
 	}
 }
-
-// bytesToGi translates bytes to Gi, and also keep three digital.
-func bytesToGi(mBytes float64) float64 {
-	return float64(int64(float64(int64(mBytes/1024/1024+0.5))/1024*1000)) / 1000
-}
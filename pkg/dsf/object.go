@@ -39,3 +39,21 @@ func IsPodDataSourceObject(name DataSourceObjectName) bool {
 func IsContainerDataSourceObject(name DataSourceObjectName) bool {
 	return name.DataSourceObjectType == DataSourceObjectContainer
 }
+
+// GetDataSourceObjectLabels returns the labels identifying the object
+func GetDataSourceObjectLabels(name DataSourceObjectName) map[string]string {
+	labels := map[string]string{}
+	if name.NodeName != "" {
+		labels["node"] = name.NodeName
+	}
+	if name.Namespace != "" {
+		labels["namespace"] = name.Namespace
+	}
+	if name.PodName != "" {
+		labels["pod"] = name.PodName
+	}
+	if name.ContainerName != "" {
+		labels["container"] = name.ContainerName
+	}
+	return labels
+}
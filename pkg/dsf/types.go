@@ -1,15 +1,20 @@
 package dsf
 
 import (
+	"fmt"
+	"github.com/open-resource-management/metricsclient/pkg/prom"
+	"github.com/open-resource-management/metricsclient/pkg/types"
 	"github.com/open-resource-management/metricsclient/pkg/util"
+	"math"
 	"time"
 )
 
 type DataSourceType string
 
 const (
-	DataSourcePromType       DataSourceType = "prom"
-	DataSourceNodeLocaleType DataSourceType = "node-local"
+	DataSourcePromType           DataSourceType = "prom"
+	DataSourcePromRemoteReadType DataSourceType = "prom-remote-read"
+	DataSourceNodeLocaleType     DataSourceType = "node-local"
 )
 
 // Sample is a single timestamped value of the metric.
@@ -18,12 +23,80 @@ type DataSample struct {
 	Timestamp time.Time
 }
 
+// DataMemoryBreakdown is the memory usage split into rss and cache, in bytes
+type DataMemoryBreakdown struct {
+	Rss   DataSample
+	Cache DataSample
+}
+
 // TimeSeries represents a metric with given labels, with its values possibly changing in time.
 type DataTimeSeries struct {
 	Labels  map[string]string
 	Samples []DataSample
 }
 
+// Vector2Sample converts the vector to a sample, the timestamp is kept to the millisecond as the
+// timestamps of the raw samples
 func Vector2Sample(v util.Vector) DataSample {
-	return DataSample{Timestamp: time.Unix(int64(v.Timestamp), 0), Value: v.Value}
+	sec, frac := math.Modf(v.Timestamp)
+	return DataSample{Timestamp: time.Unix(int64(sec), int64(math.Round(frac*1e3))*int64(time.Millisecond)), Value: v.Value}
+}
+
+// Results2TimeSeries converts the query results to time series, the labels of the metric which are
+// not string are dropped
+func Results2TimeSeries(results []*prom.QueryResult) []DataTimeSeries {
+	series := make([]DataTimeSeries, 0, len(results))
+	for _, result := range results {
+		labels := make(map[string]string, len(result.Metric))
+		for k, v := range result.Metric {
+			if s, ok := v.(string); ok {
+				labels[k] = s
+			}
+		}
+
+		samples := make([]DataSample, 0, len(result.Values))
+		for _, v := range result.Values {
+			if v != nil {
+				samples = append(samples, Vector2Sample(*v))
+			}
+		}
+
+		series = append(series, DataTimeSeries{Labels: labels, Samples: samples})
+	}
+
+	return series
+}
+
+// DownsampleSamples keeps the last sample in each step from start, the samples must be ordered
+// by time. All the samples are kept if step is not positive.
+func DownsampleSamples(samples []DataSample, start time.Time, step time.Duration) []DataSample {
+	if step <= 0 {
+		return samples
+	}
+
+	var result []DataSample
+	lastBucket := int64(-1)
+	for _, s := range samples {
+		bucket := int64(s.Timestamp.Sub(start) / step)
+		if bucket == lastBucket {
+			result[len(result)-1] = s
+			continue
+		}
+
+		result = append(result, s)
+		lastBucket = bucket
+	}
+
+	return result
+}
+
+// MetricValues2Sample returns the sample of the metric value with the given label
+func MetricValues2Sample(values types.MetricValues, label string) (DataSample, error) {
+	for _, v := range values {
+		if len(v.Labels) > 0 && v.Labels[0] == label {
+			return DataSample{Timestamp: v.Timestamp, Value: v.Value}, nil
+		}
+	}
+
+	return DataSample{}, fmt.Errorf("metric value with label %s not found", label)
 }
@@ -0,0 +1,263 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	prometheusapi "github.com/prometheus/client_golang/api"
+	"k8s.io/klog"
+)
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerCooldown         = 30 * time.Second
+	defaultBreakerHalfOpenRequests = 1
+)
+
+// CircuitState is the state of a CircuitBreakerClient
+type CircuitState int
+
+const (
+	// CircuitClosed lets all the requests through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails all the requests fast until the cooldown is over
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe requests through, which close the circuit on success
+	CircuitHalfOpen
+)
+
+// String returns the name of the state
+func (cs CircuitState) String() string {
+	switch cs {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return fmt.Sprintf("CircuitState(%d)", int(cs))
+}
+
+// CircuitBreakerConfig configures a CircuitBreakerClient
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures which opens the circuit
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before letting probe requests through
+	Cooldown time.Duration
+	// HalfOpenRequests is the number of concurrent probe requests allowed while half-open
+	HalfOpenRequests int
+}
+
+// DefaultCircuitBreakerConfig returns a CircuitBreakerConfig which opens after 5 consecutive failures
+// for 30 seconds.
+func DefaultCircuitBreakerConfig() *CircuitBreakerConfig {
+	return &CircuitBreakerConfig{
+		FailureThreshold: defaultBreakerFailureThreshold,
+		Cooldown:         defaultBreakerCooldown,
+		HalfOpenRequests: defaultBreakerHalfOpenRequests,
+	}
+}
+
+//--------------------------------------------------------------------------
+//  CircuitBreakerClient
+//--------------------------------------------------------------------------
+
+// CircuitBreakerClient is a prometheus client which stops sending requests to the wrapped client
+// after consecutive failures, a failure is a transport error or a 5xx response. Requests fail fast
+// with a CircuitOpenError while the circuit is open.
+type CircuitBreakerClient struct {
+	client prometheusapi.Client
+	config CircuitBreakerConfig
+
+	m        sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+// NewCircuitBreakerClient wraps the client with a circuit breaker, the DefaultCircuitBreakerConfig is
+// used if config is nil.
+func NewCircuitBreakerClient(client prometheusapi.Client, config *CircuitBreakerConfig) *CircuitBreakerClient {
+	if config == nil {
+		config = DefaultCircuitBreakerConfig()
+	}
+
+	c := *config
+	if c.FailureThreshold < 1 {
+		c.FailureThreshold = 1
+	}
+	if c.HalfOpenRequests < 1 {
+		c.HalfOpenRequests = 1
+	}
+
+	return &CircuitBreakerClient{
+		client: client,
+		config: c,
+		state:  CircuitClosed,
+	}
+}
+
+// ID is used to identify the type of the wrapped client
+func (cbc *CircuitBreakerClient) ID() string {
+	if idc, ok := cbc.client.(interface{ ID() string }); ok {
+		return idc.ID()
+	}
+
+	return ""
+}
+
+// Unwrap returns the wrapped client
+func (cbc *CircuitBreakerClient) Unwrap() prometheusapi.Client {
+	return cbc.client
+}
+
+// RetryPolicy returns the policy of the wrapped client
+func (cbc *CircuitBreakerClient) RetryPolicy() *RetryPolicy {
+	return retryPolicyFor(cbc.client)
+}
+
+// Headers returns the default headers of the wrapped client
+func (cbc *CircuitBreakerClient) Headers() http.Header {
+	return headersFor(cbc.client)
+}
+
+// Close closes the wrapped client if it supports closing
+func (cbc *CircuitBreakerClient) Close() error {
+	if closer, ok := cbc.client.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// State returns the current state of the circuit
+func (cbc *CircuitBreakerClient) State() CircuitState {
+	cbc.m.Lock()
+	defer cbc.m.Unlock()
+
+	return cbc.stateAt(time.Now())
+}
+
+// Passthrough to the prometheus client API
+func (cbc *CircuitBreakerClient) URL(ep string, args map[string]string) *url.URL {
+	return cbc.client.URL(ep, args)
+}
+
+// Do sends the request through the wrapped client if the circuit allows it
+func (cbc *CircuitBreakerClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	probe, err := cbc.allow(time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, body, err := cbc.client.Do(ctx, req)
+	cbc.record(probe, requestOutcome(ctx, res, err))
+	return res, body, err
+}
+
+// DoStream is the same as Do, but the response is returned before its body is read, see doStream
+func (cbc *CircuitBreakerClient) DoStream(ctx context.Context, req *http.Request) (*http.Response, error) {
+	probe, err := cbc.allow(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := doStream(cbc.client, ctx, req)
+	cbc.record(probe, requestOutcome(ctx, res, err))
+	return res, err
+}
+
+// stateAt returns the state at now, an open circuit is half-open once the cooldown is over
+func (cbc *CircuitBreakerClient) stateAt(now time.Time) CircuitState {
+	if cbc.state == CircuitOpen && now.Sub(cbc.openedAt) >= cbc.config.Cooldown {
+		return CircuitHalfOpen
+	}
+
+	return cbc.state
+}
+
+// allow returns an error if the request must fail fast, and whether the request is a probe
+func (cbc *CircuitBreakerClient) allow(now time.Time) (bool, error) {
+	cbc.m.Lock()
+	defer cbc.m.Unlock()
+
+	switch cbc.stateAt(now) {
+	case CircuitClosed:
+		return false, nil
+	case CircuitHalfOpen:
+		if cbc.probes < cbc.config.HalfOpenRequests {
+			cbc.state = CircuitHalfOpen
+			cbc.probes++
+			return true, nil
+		}
+		return false, NewCircuitOpenError(0, "waiting for the half-open probe requests")
+	}
+
+	retryAfter := cbc.config.Cooldown - now.Sub(cbc.openedAt)
+	return false, NewCircuitOpenError(retryAfter, fmt.Sprintf("%d consecutive failures", cbc.failures))
+}
+
+// record updates the circuit with the outcome of a request
+func (cbc *CircuitBreakerClient) record(probe bool, outcome breakerOutcome) {
+	cbc.m.Lock()
+	defer cbc.m.Unlock()
+
+	// the probes may have been reset by another probe which reopened the circuit
+	if probe && cbc.probes > 0 {
+		cbc.probes--
+	}
+
+	switch outcome {
+	case outcomeIgnored:
+		return
+	case outcomeSuccess:
+		if cbc.state != CircuitClosed {
+			klog.Infof("prometheus circuit breaker closed")
+		}
+		cbc.state = CircuitClosed
+		cbc.failures = 0
+		return
+	}
+
+	cbc.failures++
+	if cbc.state == CircuitHalfOpen || (cbc.state == CircuitClosed && cbc.failures >= cbc.config.FailureThreshold) {
+		klog.Warningf("prometheus circuit breaker opened after %d consecutive failures", cbc.failures)
+		cbc.state = CircuitOpen
+		cbc.openedAt = time.Now()
+		cbc.probes = 0
+	}
+}
+
+// breakerOutcome is the outcome of a request as seen by the circuit breaker
+type breakerOutcome int
+
+const (
+	outcomeSuccess breakerOutcome = iota
+	outcomeFailure
+	// outcomeIgnored doesn't tell whether the server is healthy, e.g. the caller cancelled the request
+	outcomeIgnored
+)
+
+// requestOutcome classifies the result of a request, transport errors and 5xx responses are failures
+func requestOutcome(ctx context.Context, res *http.Response, err error) breakerOutcome {
+	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, ErrClientClosed) {
+			return outcomeIgnored
+		}
+		return outcomeFailure
+	}
+
+	if res == nil || res.StatusCode >= http.StatusInternalServerError {
+		return outcomeFailure
+	}
+
+	return outcomeSuccess
+}
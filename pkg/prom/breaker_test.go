@@ -0,0 +1,135 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeClient is a prometheusapi.Client which responds the given status codes in order, and an
+// error for a zero status code
+type fakeClient struct {
+	statuses []int
+	calls    int
+}
+
+func (fc *fakeClient) URL(ep string, args map[string]string) *url.URL {
+	return &url.URL{Path: ep}
+}
+
+func (fc *fakeClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	status := fc.statuses[fc.calls%len(fc.statuses)]
+	fc.calls++
+	if status == 0 {
+		return nil, nil, errors.New("connection refused")
+	}
+
+	return &http.Response{StatusCode: status}, []byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`), nil
+}
+
+func TestCircuitBreakerClient(t *testing.T) {
+	fake := &fakeClient{statuses: []int{http.StatusInternalServerError, 0}}
+	cbc := NewCircuitBreakerClient(fake, &CircuitBreakerConfig{FailureThreshold: 2, Cooldown: 50 * time.Millisecond})
+	ctx := NewContext(cbc)
+
+	for i := 0; i < 2; i++ {
+		if _, err := ctx.QuerySync("up"); err == nil || IsCircuitOpenError(err) {
+			t.Fatalf("attempt %d: expected the request sent and failed, got %v", i, err)
+		}
+	}
+	if s := cbc.State(); s != CircuitOpen {
+		t.Fatalf("expected open circuit, got %s", s)
+	}
+
+	// fail fast while open
+	_, err := ctx.QuerySync("up")
+	if !IsCircuitOpenError(err) {
+		t.Fatalf("expected CircuitOpenError, got %v", err)
+	}
+	var coe CircuitOpenError
+	if !errors.As(err, &coe) || coe.RetryAfter <= 0 {
+		t.Errorf("expected the remaining cooldown, got %v", err)
+	}
+
+	// the async queries fail fast with the CircuitOpenError too
+	if _, err := ctx.Query("up").Await(); !IsCircuitOpenError(err) {
+		t.Fatalf("expected CircuitOpenError from Await, got %v", err)
+	}
+	for i, resCh := range ctx.QueryAll("up", "down") {
+		if _, err := resCh.Await(); !IsCircuitOpenError(err) {
+			t.Fatalf("expected CircuitOpenError from QueryAll %d, got %v", i, err)
+		}
+	}
+	if fake.calls != 2 {
+		t.Errorf("expected no request sent while open, got %d calls", fake.calls)
+	}
+
+	// a failed probe reopens the circuit
+	time.Sleep(60 * time.Millisecond)
+	if s := cbc.State(); s != CircuitHalfOpen {
+		t.Fatalf("expected half-open circuit after cooldown, got %s", s)
+	}
+	if _, err := ctx.QuerySync("up"); err == nil || IsCircuitOpenError(err) {
+		t.Fatalf("expected the probe sent and failed, got %v", err)
+	}
+	if s := cbc.State(); s != CircuitOpen {
+		t.Fatalf("expected the failed probe to reopen the circuit, got %s", s)
+	}
+
+	// a successful probe closes the circuit
+	fake.statuses = []int{http.StatusOK}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := ctx.QuerySync("up"); err != nil {
+		t.Fatalf("expected the probe to succeed, got %v", err)
+	}
+	if s := cbc.State(); s != CircuitClosed {
+		t.Fatalf("expected closed circuit, got %s", s)
+	}
+}
+
+func TestCircuitBreakerClient_HalfOpenProbes(t *testing.T) {
+	cbc := NewCircuitBreakerClient(&fakeClient{statuses: []int{0}}, &CircuitBreakerConfig{FailureThreshold: 1, Cooldown: 0})
+	cbc.record(false, outcomeFailure)
+
+	probe, err := cbc.allow(time.Now())
+	if err != nil || !probe {
+		t.Fatalf("expected a probe allowed, got %v, %v", probe, err)
+	}
+	if _, err := cbc.allow(time.Now()); !IsCircuitOpenError(err) {
+		t.Fatalf("expected a single probe allowed, got %v", err)
+	}
+
+	// a cancelled probe doesn't change the state, but frees the probe slot
+	cbc.record(true, outcomeIgnored)
+	if probe, err := cbc.allow(time.Now()); err != nil || !probe {
+		t.Fatalf("expected another probe allowed, got %v, %v", probe, err)
+	}
+}
+
+func TestRequestOutcome(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		ctx      context.Context
+		res      *http.Response
+		err      error
+		expected breakerOutcome
+	}{
+		{context.Background(), &http.Response{StatusCode: http.StatusOK}, nil, outcomeSuccess},
+		{context.Background(), &http.Response{StatusCode: http.StatusBadRequest}, nil, outcomeSuccess},
+		{context.Background(), &http.Response{StatusCode: http.StatusBadGateway}, nil, outcomeFailure},
+		{context.Background(), nil, errors.New("connection refused"), outcomeFailure},
+		{cancelled, nil, context.Canceled, outcomeIgnored},
+		{context.Background(), nil, ErrClientClosed, outcomeIgnored},
+	}
+
+	for i, c := range cases {
+		if o := requestOutcome(c.ctx, c.res, c.err); o != c.expected {
+			t.Errorf("case %d: expected %d, got %d", i, c.expected, o)
+		}
+	}
+}
@@ -1,6 +1,22 @@
 package prom
 
-import "net/http"
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthProvider sets the credentials of the requests sent to prometheus
+type AuthProvider interface {
+	// Authenticate sets the credentials on the request headers, replacing any previous ones so
+	// the same request can be authenticated again when retried
+	Authenticate(req *http.Request) error
+}
 
 // ClientAuth is used to authenticate for client requests.
 type ClientAuth struct {
@@ -21,6 +37,225 @@ func (auth *ClientAuth) Apply(req *http.Request) {
 
 	if auth.BearerToken != "" {
 		token := "Bearer " + auth.BearerToken
-		req.Header.Add("Authorization", token)
+		req.Header.Set("Authorization", token)
+	}
+}
+
+// Authenticate implements AuthProvider with the static credentials
+func (auth *ClientAuth) Authenticate(req *http.Request) error {
+	auth.Apply(req)
+	return nil
+}
+
+//--------------------------------------------------------------------------
+//  FileTokenAuth
+//--------------------------------------------------------------------------
+
+// FileTokenAuth is an AuthProvider which sends the bearer token read from a file, the file is read
+// again when it changes, e.g. a projected service account token.
+type FileTokenAuth struct {
+	token *reloadingFile
+}
+
+// NewFileTokenAuth creates a FileTokenAuth for the token file
+func NewFileTokenAuth(path string) *FileTokenAuth {
+	return &FileTokenAuth{
+		token: &reloadingFile{paths: []string{path}, load: loadToken},
+	}
+}
+
+// Authenticate sets the current token as the bearer token of the request
+func (fta *FileTokenAuth) Authenticate(req *http.Request) error {
+	token, err := fta.token.Get()
+	if err != nil {
+		return fmt.Errorf("read bearer token failed: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token.(string))
+	return nil
+}
+
+func loadToken(paths []string) (interface{}, error) {
+	data, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		return nil, err
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return nil, fmt.Errorf("token file %s is empty", paths[0])
+	}
+
+	return token, nil
+}
+
+//--------------------------------------------------------------------------
+//  OAuth2ClientCredentials
+//--------------------------------------------------------------------------
+
+const (
+	// defaultTokenRefreshBefore is how long before its expiry an access token is refreshed
+	defaultTokenRefreshBefore = 30 * time.Second
+	defaultTokenTimeout       = 10 * time.Second
+)
+
+// OAuth2Config configures the OAuth2 client credentials grant
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// EndpointParams are additional parameters of the token request, e.g. audience
+	EndpointParams url.Values
+	// RefreshBefore is how long before its expiry the access token is refreshed
+	RefreshBefore time.Duration
+	// HTTPClient sends the token requests, a client with a 10 seconds timeout is used if nil
+	HTTPClient *http.Client
+}
+
+// OAuth2ClientCredentials is an AuthProvider which sends the access token obtained with the client
+// credentials grant. The token is cached until it is about to expire.
+type OAuth2ClientCredentials struct {
+	config OAuth2Config
+
+	m       sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewOAuth2ClientCredentials creates an OAuth2ClientCredentials for the config
+func NewOAuth2ClientCredentials(config OAuth2Config) *OAuth2ClientCredentials {
+	if config.RefreshBefore <= 0 {
+		config.RefreshBefore = defaultTokenRefreshBefore
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: defaultTokenTimeout}
+	}
+
+	return &OAuth2ClientCredentials{config: config}
+}
+
+// Authenticate sets the access token as the bearer token of the request
+func (occ *OAuth2ClientCredentials) Authenticate(req *http.Request) error {
+	token, err := occ.Token(req)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Token returns the cached access token, or requests a new one if it is about to expire. The
+// token request is cancelled with the given request.
+func (occ *OAuth2ClientCredentials) Token(req *http.Request) (string, error) {
+	occ.m.Lock()
+	defer occ.m.Unlock()
+
+	if occ.token != "" && time.Now().Add(occ.config.RefreshBefore).Before(occ.expires) {
+		return occ.token, nil
+	}
+
+	token, expiresIn, err := occ.requestToken(req)
+	if err != nil {
+		return "", err
+	}
+
+	occ.token = token
+	occ.expires = time.Now().Add(expiresIn)
+	return token, nil
+}
+
+// tokenResponse is the successful response of the token endpoint
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// requestToken requests a new access token, tokens without expiry are refreshed every hour
+func (occ *OAuth2ClientCredentials) requestToken(req *http.Request) (string, time.Duration, error) {
+	params := url.Values{}
+	for k, v := range occ.config.EndpointParams {
+		params[k] = v
+	}
+	params.Set("grant_type", "client_credentials")
+	if len(occ.config.Scopes) > 0 {
+		params.Set("scope", strings.Join(occ.config.Scopes, " "))
+	}
+
+	tokenReq, err := http.NewRequestWithContext(req.Context(), http.MethodPost, occ.config.TokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tokenReq.SetBasicAuth(url.QueryEscape(occ.config.ClientID), url.QueryEscape(occ.config.ClientSecret))
+
+	resp, err := occ.config.HTTPClient.Do(tokenReq)
+	if err != nil {
+		return "", 0, fmt.Errorf("oauth2 token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("oauth2 token response read failed: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", 0, fmt.Errorf("oauth2 token request failed: %d (%s) Body: %s", resp.StatusCode, http.StatusText(resp.StatusCode), body)
+	}
+
+	var tr tokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return "", 0, fmt.Errorf("oauth2 token response unmarshal failed: %w", err)
+	}
+	if tr.AccessToken == "" {
+		return "", 0, fmt.Errorf("oauth2 token response has no access_token")
+	}
+	if tr.TokenType != "" && !strings.EqualFold(tr.TokenType, "bearer") {
+		return "", 0, fmt.Errorf("oauth2 token type %s is not supported", tr.TokenType)
+	}
+
+	expiresIn := time.Hour
+	if tr.ExpiresIn > 0 {
+		expiresIn = time.Duration(tr.ExpiresIn) * time.Second
 	}
+
+	return tr.AccessToken, expiresIn, nil
+}
+
+//--------------------------------------------------------------------------
+//  HeaderAuth
+//--------------------------------------------------------------------------
+
+// HeaderAuth is an AuthProvider which sets static headers, e.g. an api key header
+type HeaderAuth struct {
+	Headers map[string]string
+}
+
+// Authenticate sets the headers on the request
+func (ha *HeaderAuth) Authenticate(req *http.Request) error {
+	for k, v := range ha.Headers {
+		req.Header.Set(k, v)
+	}
+
+	return nil
+}
+
+//--------------------------------------------------------------------------
+//  ChainAuth
+//--------------------------------------------------------------------------
+
+// ChainAuth is an AuthProvider which applies the providers in order
+type ChainAuth []AuthProvider
+
+// Authenticate applies all the providers, and stops at the first error
+func (ca ChainAuth) Authenticate(req *http.Request) error {
+	for _, provider := range ca {
+		if err := provider.Authenticate(req); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
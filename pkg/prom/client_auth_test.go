@@ -0,0 +1,154 @@
+package prom
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientAuth_ApplyTwice(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "http://prometheus/api/v1/query", nil)
+
+	auth := &ClientAuth{BearerToken: "token"}
+	auth.Apply(req)
+	auth.Apply(req)
+
+	if values := req.Header.Values("Authorization"); len(values) != 1 || values[0] != "Bearer token" {
+		t.Errorf("expected a single Authorization header, got %v", values)
+	}
+}
+
+func TestFileTokenAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prom-auth")
+	if err != nil {
+		t.Fatalf("create temp dir failed %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "token")
+	modTime := time.Now().Add(-time.Minute)
+	writeTestFile(t, path, []byte("token-1\n"), modTime)
+
+	auth := NewFileTokenAuth(path)
+	req, _ := http.NewRequest(http.MethodPost, "http://prometheus/api/v1/query", nil)
+	if err := auth.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate failed %s", err.Error())
+	}
+	if h := req.Header.Get("Authorization"); h != "Bearer token-1" {
+		t.Errorf("unexpected Authorization header %s", h)
+	}
+
+	// the rotated token is read again
+	writeTestFile(t, path, []byte("token-2"), modTime.Add(time.Second))
+	if err := auth.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate failed %s", err.Error())
+	}
+	if values := req.Header.Values("Authorization"); len(values) != 1 || values[0] != "Bearer token-2" {
+		t.Errorf("expected the rotated token, got %v", values)
+	}
+
+	if err := NewFileTokenAuth(filepath.Join(dir, "missing")).Authenticate(req); err == nil {
+		t.Errorf("expected an error for a missing token file")
+	}
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	var tokens int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "read write" || r.FormValue("audience") != "prometheus" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		n := atomic.AddInt32(&tokens, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"access-` + strconv.Itoa(int(n)) + `","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	var authorization atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization.Store(r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer server.Close()
+
+	auth := NewOAuth2ClientCredentials(OAuth2Config{
+		TokenURL:       tokenServer.URL,
+		ClientID:       "client",
+		ClientSecret:   "secret",
+		Scopes:         []string{"read", "write"},
+		EndpointParams: map[string][]string{"audience": {"prometheus"}},
+	})
+
+	for _, rateLimit := range []bool{false, true} {
+		client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, rateLimit, &ClientAuth{BearerToken: "ignored"},
+			WithAuthProvider(auth))
+		if err != nil {
+			t.Fatalf("NewPrometheusClient failed %s", err.Error())
+		}
+
+		for i := 0; i < 2; i++ {
+			if _, err := NewContext(client).QuerySync("up"); err != nil {
+				t.Fatalf("query failed %s", err.Error())
+			}
+		}
+	}
+
+	if h := authorization.Load(); h != "Bearer access-1" {
+		t.Errorf("expected the access token, got %v", h)
+	}
+	if n := atomic.LoadInt32(&tokens); n != 1 {
+		t.Errorf("expected the token cached, got %d token requests", n)
+	}
+
+	// the token is refreshed before it expires
+	auth.m.Lock()
+	auth.expires = time.Now().Add(10 * time.Second)
+	auth.m.Unlock()
+	req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+	if err := auth.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate failed %s", err.Error())
+	}
+	if h := req.Header.Get("Authorization"); h != "Bearer access-2" {
+		t.Errorf("expected the refreshed token, got %s", h)
+	}
+
+	// token errors fail the query without sending it
+	bad := NewOAuth2ClientCredentials(OAuth2Config{TokenURL: tokenServer.URL, ClientID: "client", ClientSecret: "wrong"})
+	client, _ := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, true, nil, WithAuthProvider(bad))
+	if _, err := NewContext(client).QuerySync("up"); err == nil {
+		t.Errorf("expected the query to fail with the token error")
+	}
+}
+
+func TestChainAuth(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "http://prometheus/api/v1/query", nil)
+
+	auth := ChainAuth{
+		&ClientAuth{Username: "user", Password: "pass"},
+		&HeaderAuth{Headers: map[string]string{"X-Api-Key": "key"}},
+	}
+	if err := auth.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate failed %s", err.Error())
+	}
+
+	if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("expected basic auth, got %s %s", user, pass)
+	}
+	if h := req.Header.Get("X-Api-Key"); h != "key" {
+		t.Errorf("expected the static header, got %s", h)
+	}
+}
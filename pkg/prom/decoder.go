@@ -0,0 +1,427 @@
+package prom
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/util"
+
+	"k8s.io/klog"
+)
+
+// SeriesHandler is called by StreamQueryResults for each series of a matrix or vector result, in
+// the order of the response. The handler owns the series, and an error stops the decoding.
+type SeriesHandler func(result *QueryResult) error
+
+// DecodeQueryResults decodes the query response body into QueryResults. It returns the same results
+// and errors as NewQueryResultsWithPrecision on the unmarshalled body, but decodes the series
+// straight into QueryResult without building the generic tree of the response.
+func DecodeQueryResults(query string, body io.Reader, precision time.Duration) *QueryResults {
+	var results []*QueryResult
+	qrs := StreamQueryResults(query, body, precision, func(result *QueryResult) error {
+		results = append(results, result)
+		return nil
+	})
+
+	// the scalar results are set by StreamQueryResults
+	if qrs.Error == nil && qrs.Results == nil {
+		qrs.Results = results
+	}
+
+	return qrs
+}
+
+// StreamQueryResults decodes the query response body, and calls the handler for each series of a
+// matrix or vector result instead of collecting them in Results, so only one series is decoded in
+// memory at once. The body is read as it is decoded, so the response is not held in memory either
+// if body is the response body, see QueryStream. The scalar and string results are set as for
+// DecodeQueryResults.
+//
+// The warnings of prometheus follow the data in the response, so the handler may have been called
+// before the NoStoreAPIError of a partial response is returned, in which case the series handled
+// must be discarded.
+func StreamQueryResults(query string, body io.Reader, precision time.Duration, handler SeriesHandler) *QueryResults {
+	qrs := &QueryResults{Query: query}
+
+	d := &responseDecoder{
+		dec:       json.NewDecoder(body),
+		query:     query,
+		precision: precision,
+		handler:   handler,
+		qrs:       qrs,
+	}
+	if err := d.decode(); err != nil {
+		qrs.Error = err
+		qrs.Results = nil
+	}
+
+	return qrs
+}
+
+// responseDecoder walks the tokens of a prometheus response
+type responseDecoder struct {
+	dec       *json.Decoder
+	query     string
+	precision time.Duration
+	handler   SeriesHandler
+	qrs       *QueryResults
+}
+
+// decode decodes the response, the errors match the ones of NewQueryResults
+func (d *responseDecoder) decode() error {
+	tok, err := d.dec.Token()
+	if err == io.EOF || (err == nil && tok == nil) {
+		return QueryResultNilErr(d.query)
+	}
+	if err != nil {
+		return d.unmarshalErr(err)
+	}
+	if tok != json.Delim('{') {
+		return PromUnexpectedResponseErr(d.query)
+	}
+
+	// the error fields are kept as a response map for wrapPrometheusError
+	response := map[string]interface{}{}
+	hasData := false
+
+	for d.dec.More() {
+		key, err := d.key()
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case "status", "errorType", "error", "warnings":
+			var v interface{}
+			if err := d.dec.Decode(&v); err != nil {
+				return d.unmarshalErr(err)
+			}
+			response[key] = v
+
+		case "data":
+			hasData = true
+			if err := d.decodeData(); err != nil {
+				return err
+			}
+
+		default:
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := d.dec.Token(); err != nil {
+		return d.unmarshalErr(err)
+	}
+
+	// the NoStoreAPIWarning means the data is partial, so it is promoted to an error
+	var noStoreAPI bool
+	for _, w := range parseWarnings(response) {
+		if IsNoStoreAPIWarning(w) {
+			noStoreAPI = true
+			continue
+		}
+		d.qrs.Warnings = append(d.qrs.Warnings, w)
+	}
+	if noStoreAPI {
+		return NewNoStoreAPIError(d.query)
+	}
+
+	if !hasData || response["status"] == "error" {
+		return wrapPrometheusError(d.query, response, nil)
+	}
+
+	return nil
+}
+
+// decodeData decodes the data object, the result is buffered if it comes before the resultType
+func (d *responseDecoder) decodeData() error {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return d.unmarshalErr(err)
+	}
+	if tok != json.Delim('{') {
+		return DataFieldFormatErr(d.query)
+	}
+
+	var buffered json.RawMessage
+	hasResult, hasResultType := false, false
+
+	for d.dec.More() {
+		key, err := d.key()
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case "resultType":
+			var resultType interface{}
+			if err := d.dec.Decode(&resultType); err != nil {
+				return d.unmarshalErr(err)
+			}
+			rt, _ := resultType.(string)
+			d.qrs.ResultType = ResultType(rt)
+			hasResultType = true
+
+		case "result":
+			hasResult = true
+			if !hasResultType {
+				if err := d.dec.Decode(&buffered); err != nil {
+					return d.unmarshalErr(err)
+				}
+				continue
+			}
+			if err := d.decodeResult(d.dec); err != nil {
+				return err
+			}
+
+		default:
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := d.dec.Token(); err != nil {
+		return d.unmarshalErr(err)
+	}
+
+	if !hasResult {
+		return ResultFieldDoesNotExistErr(d.query)
+	}
+	if buffered != nil {
+		return d.decodeResult(json.NewDecoder(bytes.NewReader(buffered)))
+	}
+
+	return nil
+}
+
+// decodeResult decodes the result with dec, by the result type
+func (d *responseDecoder) decodeResult(dec *json.Decoder) error {
+	switch d.qrs.ResultType {
+	case ResultTypeScalar:
+		var dp dataPoint
+		if err := dec.Decode(&dp); err != nil {
+			return d.unmarshalErr(err)
+		}
+		v, warn, err := d.dataPoint(dp)
+		if err != nil {
+			return err
+		}
+		if warn != nil {
+			klog.Warningf("%s\nQuery: %s", warn.Message(), d.query)
+		}
+
+		d.qrs.ScalarValue = &v
+		d.qrs.Results = []*QueryResult{{Metric: map[string]interface{}{}, Values: []*util.Vector{&v}}}
+		return nil
+
+	case ResultTypeString:
+		var dp dataPoint
+		if err := dec.Decode(&dp); err != nil {
+			return d.unmarshalErr(err)
+		}
+		if !dp.ok {
+			return DataPointFormatErr(d.query)
+		}
+
+		d.qrs.StringValue = &StringResult{Timestamp: dp.timestamp, Value: dp.value}
+		return nil
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return d.unmarshalErr(err)
+	}
+	if tok != json.Delim('[') {
+		return ResultFieldFormatErr(d.query)
+	}
+
+	for dec.More() {
+		var s seriesJSON
+		if err := dec.Decode(&s); err != nil {
+			return d.seriesErr(err)
+		}
+
+		result, err := d.series(&s)
+		if err != nil {
+			return err
+		}
+		if err := d.handler(result); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return d.unmarshalErr(err)
+	}
+
+	return nil
+}
+
+// series converts the decoded series into a QueryResult, the values share a single allocation
+func (d *responseDecoder) series(s *seriesJSON) (*QueryResult, error) {
+	if s.Metric == nil {
+		return nil, MetricFieldDoesNotExistErr(d.query)
+	}
+
+	// Determine if the result is a ranged data set or single value, responses without
+	// resultType are guessed from the values field
+	isRange := d.qrs.ResultType == ResultTypeMatrix
+	if d.qrs.ResultType == "" {
+		isRange = s.Values != nil
+	}
+
+	var points []dataPoint
+	if !isRange {
+		if s.Value == nil {
+			return nil, ValueFieldDoesNotExistErr(d.query)
+		}
+		points = []dataPoint{*s.Value}
+	} else {
+		if s.Values == nil {
+			return nil, ValueFieldFormatErr(d.query)
+		}
+		points = *s.Values
+	}
+
+	var vectors []*util.Vector
+	if len(points) > 0 {
+		backing := make([]util.Vector, len(points))
+		vectors = make([]*util.Vector, len(points))
+
+		// Define label string for values to ensure that we only run labelsForMetric once
+		// if we receive multiple warnings.
+		var labelString string = ""
+
+		for i, dp := range points {
+			v, warn, err := d.dataPoint(dp)
+			if err != nil {
+				return nil, err
+			}
+			if warn != nil {
+				if labelString == "" {
+					labelString = labelsForMetric(s.Metric)
+				}
+				klog.Warningf("%s\nQuery: %s\nLabels: %s", warn.Message(), d.query, labelString)
+			}
+
+			backing[i] = v
+			vectors[i] = &backing[i]
+		}
+	}
+
+	return &QueryResult{
+		Metric: s.Metric,
+		Values: vectors,
+	}, nil
+}
+
+// dataPoint converts the decoded data point into a Vector
+func (d *responseDecoder) dataPoint(dp dataPoint) (util.Vector, warning, error) {
+	if !dp.ok {
+		return util.Vector{}, nil, DataPointFormatErr(d.query)
+	}
+
+	return newDataPoint(dp.timestamp, dp.value, d.precision)
+}
+
+// key returns the next key of the current object
+func (d *responseDecoder) key() (string, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return "", d.unmarshalErr(err)
+	}
+
+	key, ok := tok.(string)
+	if !ok {
+		return "", PromUnexpectedResponseErr(d.query)
+	}
+
+	return key, nil
+}
+
+// skip skips the next value
+func (d *responseDecoder) skip() error {
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err != nil {
+		return d.unmarshalErr(err)
+	}
+
+	return nil
+}
+
+// seriesErr returns the format error of the series decoding error
+func (d *responseDecoder) seriesErr(err error) error {
+	var ute *json.UnmarshalTypeError
+	if errors.As(err, &ute) {
+		switch ute.Field {
+		case "":
+			return ResultFormatErr(d.query)
+		case "metric":
+			return MetricFieldFormatErr(d.query)
+		case "values":
+			return ValueFieldFormatErr(d.query)
+		}
+	}
+
+	return d.unmarshalErr(err)
+}
+
+func (d *responseDecoder) unmarshalErr(err error) error {
+	return fmt.Errorf("Unmarshal Error: %s\nQuery: %s", err, d.query)
+}
+
+// seriesJSON is a series of a matrix or vector result
+type seriesJSON struct {
+	Metric map[string]interface{} `json:"metric"`
+	Value  *dataPoint             `json:"value"`
+	Values *[]dataPoint           `json:"values"`
+}
+
+// dataPoint is a [timestamp, "value"] pair of the response, ok is false if it is malformed
+type dataPoint struct {
+	timestamp float64
+	value     string
+	ok        bool
+}
+
+// UnmarshalJSON parses the pair without the reflection of encoding/json, the malformed pairs are
+// recorded as not ok so the error is returned with the query
+func (dp *dataPoint) UnmarshalJSON(b []byte) error {
+	*dp = dataPoint{}
+
+	b = bytes.TrimSpace(b)
+	if len(b) < 2 || b[0] != '[' || b[len(b)-1] != ']' {
+		return nil
+	}
+	inner := b[1 : len(b)-1]
+
+	i := bytes.IndexByte(inner, ',')
+	if i < 0 {
+		return nil
+	}
+	timestamp, err := strconv.ParseFloat(string(bytes.TrimSpace(inner[:i])), 64)
+	if err != nil {
+		return nil
+	}
+
+	s := bytes.TrimSpace(inner[i+1:])
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return nil
+	}
+
+	// the values are plain numbers, the escaped strings are left to encoding/json
+	value := string(s[1 : len(s)-1])
+	if bytes.IndexByte(s[1:len(s)-1], '\\') >= 0 || bytes.IndexByte(s[1:len(s)-1], '"') >= 0 {
+		if err := json.Unmarshal(s, &value); err != nil {
+			return nil
+		}
+	}
+
+	*dp = dataPoint{timestamp: timestamp, value: value, ok: true}
+	return nil
+}
@@ -0,0 +1,298 @@
+package prom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	prometheusapi "github.com/prometheus/client_golang/api"
+)
+
+func TestDecodeQueryResults_MatchesNewQueryResults(t *testing.T) {
+	responses := []string{
+		`null`,
+		`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"pod":"pod1"},"values":[[1600000000,"1"],[1600000060,"2"]]},{"metric":{"pod":"pod2"},"values":[]}]}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"pod":"pod1"},"value":[1600000003.5,"NaN"]}]}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[]}}`,
+		`{"status":"success","data":{"resultType":"scalar","result":[1600000000,"+Inf"]}}`,
+		`{"status":"success","data":{"resultType":"string","result":[1600000000,"a \"quoted\", string"]}}`,
+		`{"status":"success","data":{"result":[{"metric":{},"values":[[1600000000,"1"]]},{"metric":{},"value":[1600000000,"1"]}]}}`,
+		`{"status":"success","data":{"result":[1600000000,"42"],"resultType":"scalar"}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[]},"warnings":["partial data"]}`,
+		`{"status":"success","data":{"resultType":"vector","result":[]},"warnings":["No StoreAPIs matched for this query"]}`,
+		`{"status":"error","errorType":"execution","error":"many-to-many matching not allowed"}`,
+		`{"status":"success"}`,
+		`{"status":"success","data":[]}`,
+		`{"status":"success","data":{"resultType":"vector"}}`,
+		`{"status":"success","data":{"resultType":"vector","result":{}}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[1]}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[{"value":[1600000000,"1"]}]}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":"pod1","value":[1600000000,"1"]}]}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{}}]}}`,
+		`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":"1"}]}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":["1600000000","1"]}]}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1600000000,1]}]}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1600000000,"x"]}]}}`,
+		`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1600000000]]}]}}`,
+		`{"status":"success","data":{"resultType":"scalar","result":[1600000000,null]}}`,
+		`{"status":"success","data":{"resultType":"string","result":[1600000000,"a","b"]}}`,
+	}
+
+	for _, response := range responses {
+		var raw interface{}
+		if err := json.Unmarshal([]byte(response), &raw); err != nil {
+			t.Fatalf("unmarshal %s failed %s", response, err.Error())
+		}
+
+		expected := NewQueryResults("up", raw)
+		actual := DecodeQueryResults("up", strings.NewReader(response), DefaultTimestampPrecision)
+
+		if fmt.Sprint(expected.Error) != fmt.Sprint(actual.Error) {
+			t.Errorf("%s: expected error %v, got %v", response, expected.Error, actual.Error)
+			continue
+		}
+		if !reflect.DeepEqual(expected.Results, actual.Results) || !reflect.DeepEqual(expected.Warnings, actual.Warnings) ||
+			!reflect.DeepEqual(expected.ScalarValue, actual.ScalarValue) || !reflect.DeepEqual(expected.StringValue, actual.StringValue) {
+			t.Errorf("%s: expected %+v, got %+v", response, expected, actual)
+		}
+	}
+
+	if results := DecodeQueryResults("up", strings.NewReader(`{"status":"success","data":`), DefaultTimestampPrecision); results.Error == nil {
+		t.Errorf("expected an error for a truncated response")
+	}
+}
+
+func TestStreamQueryResults(t *testing.T) {
+	body := newMatrixResponse(3, 2)
+
+	var pods []string
+	results := StreamQueryResults("up", bytes.NewReader(body), DefaultTimestampPrecision, func(result *QueryResult) error {
+		pods = append(pods, result.Metric["pod"].(string))
+		return nil
+	})
+	if results.Error != nil || results.ResultType != ResultTypeMatrix || len(results.Results) != 0 {
+		t.Errorf("expected the streamed matrix, got %+v", results)
+	}
+	if strings.Join(pods, ",") != "pod-0,pod-1,pod-2" {
+		t.Errorf("expected the series in order, got %v", pods)
+	}
+
+	// the handler error stops the decoding
+	stop := errors.New("stop")
+	calls := 0
+	results = StreamQueryResults("up", bytes.NewReader(body), DefaultTimestampPrecision, func(result *QueryResult) error {
+		calls++
+		return stop
+	})
+	if results.Error != stop || calls != 1 {
+		t.Errorf("expected the handler error after 1 series, got %v after %d", results.Error, calls)
+	}
+}
+
+func TestQueryRangeStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(newMatrixResponse(4, 10))
+	}))
+	defer server.Close()
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, false, nil)
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+
+	points := 0
+	end := time.Now()
+	_, err = NewContext(client).QueryRangeStream(context.Background(), "up", end.Add(-time.Hour), end, time.Minute, func(result *QueryResult) error {
+		points += len(result.Values)
+		return nil
+	})
+	if err != nil || points != 40 {
+		t.Errorf("expected 40 points streamed, got %d %v", points, err)
+	}
+}
+
+func TestQueryRangeStream_DecodesWhileReceived(t *testing.T) {
+	// the server sends the first series, and the rest of the response once the series is handled
+	handled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := string(newMatrixResponse(2, 10))
+		split := strings.Index(response, `},{"metric"`) + 2
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(response[:split]))
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-handled:
+		case <-time.After(5 * time.Second):
+			t.Errorf("the first series was not handled before the response ended")
+		}
+		_, _ = w.Write([]byte(response[split:]))
+	}))
+	defer server.Close()
+
+	newClient := func(rateLimit bool) prometheusapi.Client {
+		client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, rateLimit, nil)
+		if err != nil {
+			t.Fatalf("NewPrometheusClient failed %s", err.Error())
+		}
+		return client
+	}
+	rateLimited := newClient(true)
+	defer rateLimited.(*RateLimitedPrometheusClient).Close()
+	failover, err := NewFailoverClient([]prometheusapi.Client{newClient(true)}, &FailoverConfig{})
+	if err != nil {
+		t.Fatalf("NewFailoverClient failed %s", err.Error())
+	}
+	defer failover.Close()
+
+	clients := map[string]prometheusapi.Client{
+		"client":       newClient(false),
+		"rate limited": rateLimited,
+		"failover":     NewCircuitBreakerClient(failover, nil),
+	}
+	for name, client := range clients {
+		handled = make(chan struct{})
+
+		series := 0
+		end := time.Now()
+		_, err := NewContext(client).QueryRangeStream(context.Background(), "up", end.Add(-time.Hour), end, time.Minute, func(result *QueryResult) error {
+			if series++; series == 1 {
+				close(handled)
+			}
+			return nil
+		})
+		if err != nil || series != 2 {
+			t.Errorf("%s: expected 2 series streamed, got %d %v", name, series, err)
+		}
+	}
+
+	// the worker is released once the body is closed
+	deadline := time.Now().Add(5 * time.Second)
+	for rateLimited.(requestCounter).TotalOutboundRequests() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if outbound := rateLimited.(requestCounter).TotalOutboundRequests(); outbound != 0 {
+		t.Errorf("expected no outbound request, got %d", outbound)
+	}
+}
+
+// newMatrixResponse returns a matrix response with the number of series and points per series
+func newMatrixResponse(series, points int) []byte {
+	var sb strings.Builder
+	sb.WriteString(`{"status":"success","data":{"resultType":"matrix","result":[`)
+	for i := 0; i < series; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, `{"metric":{"__name__":"container_cpu_usage_seconds_total","namespace":"default","pod":"pod-%d","container":"app"},"values":[`, i)
+		for j := 0; j < points; j++ {
+			if j > 0 {
+				sb.WriteString(",")
+			}
+			fmt.Fprintf(&sb, `[%d,"%g"]`, 1600000000+j*60, float64(i*j)/7)
+		}
+		sb.WriteString("]}")
+	}
+	sb.WriteString("]}}")
+
+	return []byte(sb.String())
+}
+
+var benchmarkResponse = newMatrixResponse(200, 720)
+
+func BenchmarkNewQueryResults(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkResponse)))
+
+	for i := 0; i < b.N; i++ {
+		var raw interface{}
+		if err := json.Unmarshal(benchmarkResponse, &raw); err != nil {
+			b.Fatal(err)
+		}
+		if results := NewQueryResults("bench", raw); results.Error != nil {
+			b.Fatal(results.Error)
+		}
+	}
+}
+
+func BenchmarkDecodeQueryResults(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkResponse)))
+
+	for i := 0; i < b.N; i++ {
+		if results := DecodeQueryResults("bench", bytes.NewReader(benchmarkResponse), DefaultTimestampPrecision); results.Error != nil {
+			b.Fatal(results.Error)
+		}
+	}
+}
+
+func BenchmarkStreamQueryResults(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkResponse)))
+
+	for i := 0; i < b.N; i++ {
+		results := StreamQueryResults("bench", bytes.NewReader(benchmarkResponse), DefaultTimestampPrecision, func(result *QueryResult) error {
+			return nil
+		})
+		if results.Error != nil {
+			b.Fatal(results.Error)
+		}
+	}
+}
+
+// benchmarkQueryRange runs the range query against a server answering the benchmark response
+func benchmarkQueryRange(b *testing.B, query func(ctx *Context, start, end time.Time) error) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(benchmarkResponse)
+	}))
+	defer server.Close()
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, false, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := NewContext(client)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkResponse)))
+	end := time.Now()
+	for i := 0; i < b.N; i++ {
+		if err := query(ctx, end.Add(-12*time.Hour), end); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRawQueryRange(b *testing.B) {
+	benchmarkQueryRange(b, func(ctx *Context, start, end time.Time) error {
+		body, err := ctx.RawQueryRange("bench", start, end, time.Minute)
+		if err != nil {
+			return err
+		}
+		var raw interface{}
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return err
+		}
+		return NewQueryResults("bench", raw).Error
+	})
+}
+
+func BenchmarkQueryRangeStream(b *testing.B) {
+	benchmarkQueryRange(b, func(ctx *Context, start, end time.Time) error {
+		_, err := ctx.QueryRangeStream(context.Background(), "bench", start, end, time.Minute, func(result *QueryResult) error {
+			return nil
+		})
+		return err
+	})
+}
@@ -0,0 +1,128 @@
+package prom
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/util/httputil"
+)
+
+// ThanosQueryParams are the Thanos specific parameters of the query and query_range requests, the
+// zero values leave the Thanos defaults.
+type ThanosQueryParams struct {
+	// Dedup enables the deduplication of the replicas
+	Dedup *bool
+	// PartialResponse allows partial results when some StoreAPIs are unavailable
+	PartialResponse *bool
+	// MaxSourceResolution is the maximum resolution of the downsampled data, e.g. 0s, 5m, 1h or auto
+	MaxSourceResolution string
+	// ReplicaLabels are the labels deduplicated, which override the ones of the querier
+	ReplicaLabels []string
+}
+
+// PrometheusQueryParams are the optional parameters of the prometheus query and query_range
+// requests, the zero values leave the server defaults.
+type PrometheusQueryParams struct {
+	// Timeout is the evaluation timeout, capped by the -query.timeout flag of the server
+	Timeout time.Duration
+	// LookbackDelta is the lookback of the instant vector selectors
+	LookbackDelta time.Duration
+}
+
+// ThanosDecorator returns a QueryParamsDecorator which sets the Thanos parameters on the query and
+// query_range requests. The parameters already set on the request are kept.
+func ThanosDecorator(params ThanosQueryParams) QueryParamsDecorator {
+	return func(path string, values url.Values) url.Values {
+		if !isQueryPath(path) {
+			return values
+		}
+
+		if params.Dedup != nil {
+			setDefault(values, "dedup", strconv.FormatBool(*params.Dedup))
+		}
+		if params.PartialResponse != nil {
+			setDefault(values, "partial_response", strconv.FormatBool(*params.PartialResponse))
+		}
+		if params.MaxSourceResolution != "" {
+			setDefault(values, "max_source_resolution", params.MaxSourceResolution)
+		}
+		if _, ok := values["replicaLabels[]"]; !ok && len(params.ReplicaLabels) > 0 {
+			values["replicaLabels[]"] = append([]string(nil), params.ReplicaLabels...)
+		}
+
+		return values
+	}
+}
+
+// PrometheusDecorator returns a QueryParamsDecorator which sets the prometheus timeout and
+// lookback_delta on the query and query_range requests. The parameters already set on the request
+// are kept.
+func PrometheusDecorator(params PrometheusQueryParams) QueryParamsDecorator {
+	return func(path string, values url.Values) url.Values {
+		if !isQueryPath(path) {
+			return values
+		}
+
+		if params.Timeout > 0 {
+			setDefault(values, "timeout", formatSeconds(params.Timeout))
+		}
+		if params.LookbackDelta > 0 {
+			setDefault(values, "lookback_delta", formatSeconds(params.LookbackDelta))
+		}
+
+		return values
+	}
+}
+
+// ChainDecorators returns a QueryParamsDecorator which applies the decorators in order
+func ChainDecorators(decorators ...QueryParamsDecorator) QueryParamsDecorator {
+	return func(path string, values url.Values) url.Values {
+		for _, decorator := range decorators {
+			if decorator != nil {
+				values = decorator(path, values)
+			}
+		}
+
+		return values
+	}
+}
+
+// decorate applies the decorator of the named context of the request, then the decorator of all the
+// requests, to the query parameters of the request. The built-in decorators keep the parameters
+// already set, so the context ones take precedence.
+func decorate(req *http.Request, decorator QueryParamsDecorator, contextDecorators map[string]QueryParamsDecorator) {
+	name, _ := httputil.GetName(req)
+	named := contextDecorators[name]
+	if decorator == nil && named == nil {
+		return
+	}
+
+	values := req.URL.Query()
+	if named != nil {
+		values = named(req.URL.Path, values)
+	}
+	if decorator != nil {
+		values = decorator(req.URL.Path, values)
+	}
+	req.URL.RawQuery = values.Encode()
+}
+
+// isQueryPath returns true for the query and query_range endpoints
+func isQueryPath(path string) bool {
+	return strings.HasSuffix(path, ctxQuery) || strings.HasSuffix(path, ctxQueryRange)
+}
+
+// setDefault sets the value of the key if it is not set
+func setDefault(values url.Values, key, value string) {
+	if _, ok := values[key]; !ok {
+		values.Set(key, value)
+	}
+}
+
+// formatSeconds formats the duration as the float seconds accepted by the prometheus API
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
@@ -0,0 +1,77 @@
+package prom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThanosDecorator(t *testing.T) {
+	dedup, partial := false, true
+	decorator := ThanosDecorator(ThanosQueryParams{
+		Dedup:               &dedup,
+		PartialResponse:     &partial,
+		MaxSourceResolution: "5m",
+		ReplicaLabels:       []string{"replica", "rule_replica"},
+	})
+
+	values := decorator("/api/v1/query_range", url.Values{"query": {"up"}, "dedup": {"true"}})
+	expected := "dedup=true&max_source_resolution=5m&partial_response=true&query=up&replicaLabels%5B%5D=replica&replicaLabels%5B%5D=rule_replica"
+	if values.Encode() != expected {
+		t.Errorf("expected %s, got %s", expected, values.Encode())
+	}
+
+	values = decorator("/api/v1/status/buildinfo", url.Values{})
+	if len(values) != 0 {
+		t.Errorf("expected the other endpoints not decorated, got %s", values.Encode())
+	}
+}
+
+func TestQueryParamsDecorator(t *testing.T) {
+	var m sync.Mutex
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		queries = append(queries, r.URL.Query())
+		m.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer server.Close()
+
+	dedup := true
+	for _, rateLimit := range []bool{false, true} {
+		queries = nil
+
+		client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, rateLimit, nil,
+			WithQueryParamsDecorator(PrometheusDecorator(PrometheusQueryParams{Timeout: 90 * time.Second, LookbackDelta: 1500 * time.Millisecond})),
+			WithContextQueryParamsDecorator(FrontendContextName, ChainDecorators(
+				ThanosDecorator(ThanosQueryParams{Dedup: &dedup}),
+				PrometheusDecorator(PrometheusQueryParams{Timeout: 10 * time.Second}),
+			)))
+		if err != nil {
+			t.Fatalf("NewPrometheusClient failed %s", err.Error())
+		}
+
+		if _, err := NewContext(client).QuerySync("up"); err != nil {
+			t.Fatalf("query failed %s", err.Error())
+		}
+		if _, err := NewNamedContext(client, FrontendContextName).QuerySync("up"); err != nil {
+			t.Fatalf("query failed %s", err.Error())
+		}
+
+		if len(queries) != 2 {
+			t.Fatalf("expected 2 queries, got %d", len(queries))
+		}
+		if q := queries[0]; q.Get("timeout") != "90" || q.Get("lookback_delta") != "1.5" || q.Get("dedup") != "" {
+			t.Errorf("expected the client decorator, got %s", q.Encode())
+		}
+		// the context decorator takes precedence over the client one
+		if q := queries[1]; q.Get("timeout") != "10" || q.Get("lookback_delta") != "1.5" || q.Get("dedup") != "true" {
+			t.Errorf("expected the context decorator, got %s", q.Encode())
+		}
+	}
+}
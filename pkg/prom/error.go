@@ -1,10 +1,12 @@
 package prom
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"k8s.io/klog"
 )
@@ -30,6 +32,8 @@ type QueryError struct {
 	Query      string `json:"query"`
 	Error      error  `json:"error"`
 	ParseError error  `json:"parseError"`
+	// Tenant is the X-Scope-OrgID of the query, empty if it was sent without tenant
+	Tenant string `json:"tenant,omitempty"`
 }
 
 // String returns a string representation of the QueryError
@@ -43,12 +47,17 @@ func (qe *QueryError) String() string {
 		sb.WriteString(fmt.Sprintf("  Parse Error: %s\n", qe.ParseError))
 	}
 	sb.WriteString(fmt.Sprintf("for Query: %s\n", qe.Query))
+	if qe.Tenant != "" {
+		sb.WriteString(fmt.Sprintf("for Tenant: %s\n", qe.Tenant))
+	}
 	return sb.String()
 }
 
 type QueryWarning struct {
 	Query    string   `json:"query"`
 	Warnings []string `json:"warnings"`
+	// Tenant is the X-Scope-OrgID of the query, empty if it was sent without tenant
+	Tenant string `json:"tenant,omitempty"`
 }
 
 // String returns a string representation of the QueryWarning
@@ -59,6 +68,9 @@ func (qw *QueryWarning) String() string {
 		sb.WriteString(fmt.Sprintf("  %d) %s\n", i+1, w))
 	}
 	sb.WriteString(fmt.Sprintf("for Query: %s\n", qw.Query))
+	if qw.Tenant != "" {
+		sb.WriteString(fmt.Sprintf("for Tenant: %s\n", qw.Tenant))
+	}
 	return sb.String()
 }
 
@@ -92,6 +104,11 @@ type QueryErrorCollector struct {
 // Reports an error to the collector. Ignores if the error is nil and the warnings
 // are empty
 func (ec *QueryErrorCollector) Report(query string, warnings []string, requestError error, parseError error) {
+	ec.ReportTenant("", query, warnings, requestError, parseError)
+}
+
+// ReportTenant is the same as Report, and records the tenant the query was sent to
+func (ec *QueryErrorCollector) ReportTenant(tenant string, query string, warnings []string, requestError error, parseError error) {
 	if requestError == nil && parseError == nil && len(warnings) == 0 {
 		return
 	}
@@ -104,6 +121,7 @@ func (ec *QueryErrorCollector) Report(query string, warnings []string, requestEr
 			Query:      query,
 			Error:      requestError,
 			ParseError: parseError,
+			Tenant:     tenant,
 		})
 	}
 
@@ -111,6 +129,7 @@ func (ec *QueryErrorCollector) Report(query string, warnings []string, requestEr
 		ec.warnings = append(ec.warnings, &QueryWarning{
 			Query:    query,
 			Warnings: warnings,
+			Tenant:   tenant,
 		})
 	}
 }
@@ -245,6 +264,12 @@ func WrapError(err error, msg string) error {
 		return e.Wrap(msg)
 	case NoDataError:
 		return e.Wrap(msg)
+	case CircuitOpenError:
+		return e.Wrap(msg)
+	case PrometheusError:
+		return e.Wrap(msg)
+	case NoStoreAPIError:
+		return e.Wrap(msg)
 	default:
 		return fmt.Errorf("%s: %s", msg, err)
 	}
@@ -265,10 +290,10 @@ func CommErrorf(format string, args ...interface{}) CommError {
 	return NewCommError(fmt.Sprintf(format, args...))
 }
 
-// IsCommError returns true if the given error is a CommError
+// IsCommError returns true if the given error is or wraps a CommError
 func IsCommError(err error) bool {
-	_, ok := err.(CommError)
-	return ok
+	var pce CommError
+	return errors.As(err, &pce)
 }
 
 // Error prints the error as a string
@@ -309,3 +334,114 @@ func (nde NoDataError) Wrap(message string) NoDataError {
 	nde.messages = append([]string{message}, nde.messages...)
 	return nde
 }
+
+// CircuitOpenError is returned without sending the request while the circuit breaker is open
+type CircuitOpenError struct {
+	// RetryAfter is the remaining cooldown of the circuit
+	RetryAfter time.Duration
+	messages   []string
+}
+
+// NewCircuitOpenError creates a new CircuitOpenError
+func NewCircuitOpenError(retryAfter time.Duration, messages ...string) CircuitOpenError {
+	return CircuitOpenError{RetryAfter: retryAfter, messages: messages}
+}
+
+// IsCircuitOpenError returns true if the given error is or wraps a CircuitOpenError
+func IsCircuitOpenError(err error) bool {
+	var coe CircuitOpenError
+	return errors.As(err, &coe)
+}
+
+// Error prints the error as a string
+func (coe CircuitOpenError) Error() string {
+	return fmt.Sprintf("Prometheus circuit open, retry after %s: %s", coe.RetryAfter, strings.Join(coe.messages, ": "))
+}
+
+// Wrap wraps the error with the given message, but persists the error type.
+func (coe CircuitOpenError) Wrap(message string) CircuitOpenError {
+	coe.messages = append([]string{message}, coe.messages...)
+	return coe
+}
+
+// ErrorType is the errorType of the prometheus API error responses
+type ErrorType string
+
+const (
+	ErrorTypeTimeout     ErrorType = "timeout"
+	ErrorTypeCanceled    ErrorType = "canceled"
+	ErrorTypeExecution   ErrorType = "execution"
+	ErrorTypeBadData     ErrorType = "bad_data"
+	ErrorTypeInternal    ErrorType = "internal"
+	ErrorTypeUnavailable ErrorType = "unavailable"
+	ErrorTypeNotFound    ErrorType = "not_found"
+)
+
+// PrometheusError is the error returned by the prometheus API in the errorType and error fields
+// of the response
+type PrometheusError struct {
+	Type    ErrorType
+	Message string
+	Query   string
+	// Err is the communication error of the response, nil if the response status was successful
+	Err      error
+	messages []string
+}
+
+// NewPrometheusError creates a new PrometheusError
+func NewPrometheusError(errorType ErrorType, message string, query string, err error) PrometheusError {
+	return PrometheusError{Type: errorType, Message: message, Query: query, Err: err}
+}
+
+// IsPrometheusError returns true if the given error is or wraps a PrometheusError
+func IsPrometheusError(err error) bool {
+	var pe PrometheusError
+	return errors.As(err, &pe)
+}
+
+// Error prints the error as a string
+func (pe PrometheusError) Error() string {
+	msg := fmt.Sprintf("Prometheus %s error: '%s' parsing query '%s'", pe.Type, pe.Message, pe.Query)
+	if len(pe.messages) > 0 {
+		msg = strings.Join(pe.messages, ": ") + ": " + msg
+	}
+	return msg
+}
+
+// Unwrap returns the communication error of the response
+func (pe PrometheusError) Unwrap() error {
+	return pe.Err
+}
+
+// Wrap wraps the error with the given message, but persists the error type.
+func (pe PrometheusError) Wrap(message string) PrometheusError {
+	pe.messages = append([]string{message}, pe.messages...)
+	return pe
+}
+
+// NoStoreAPIError is returned for the responses with the NoStoreAPIWarning, whose data is partial
+type NoStoreAPIError struct {
+	messages []string
+}
+
+// NewNoStoreAPIError creates a new NoStoreAPIError
+func NewNoStoreAPIError(messages ...string) NoStoreAPIError {
+	return NoStoreAPIError{messages: messages}
+}
+
+// IsNoStoreAPIError returns true if the given error is or wraps a NoStoreAPIError
+func IsNoStoreAPIError(err error) bool {
+	var nse NoStoreAPIError
+	return errors.As(err, &nse)
+}
+
+// Error prints the error as a string
+func (nse NoStoreAPIError) Error() string {
+	return fmt.Sprintf("%s: %s", NoStoreAPIWarning, strings.Join(nse.messages, ": "))
+}
+
+// Wrap wraps the error with the given message, but persists the error type.
+func (nse NoStoreAPIError) Wrap(message string) NoStoreAPIError {
+	nse.messages = append([]string{message}, nse.messages...)
+	return nse
+}
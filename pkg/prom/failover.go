@@ -0,0 +1,435 @@
+package prom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	prometheusapi "github.com/prometheus/client_golang/api"
+	"k8s.io/klog"
+)
+
+const (
+	defaultHealthCheckInterval = 30 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+	defaultHealthCheckQuery    = "vector(1)"
+)
+
+// FailoverConfig configures a FailoverPrometheusClient
+type FailoverConfig struct {
+	// HealthCheckInterval is the interval of the health checks of the endpoints, values <= 0 disable them
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	// HealthCheckQuery is the query sent with the diagnostic context to check an endpoint
+	HealthCheckQuery string
+	// HedgeAfter enables hedged requests, the request is also sent to the next endpoint if the
+	// current one doesn't answer within HedgeAfter, and the first answer wins. Values <= 0 disable it
+	HedgeAfter time.Duration
+}
+
+// DefaultFailoverConfig returns a FailoverConfig which checks the endpoints every 30 seconds, without
+// hedged requests.
+func DefaultFailoverConfig() *FailoverConfig {
+	return &FailoverConfig{
+		HealthCheckInterval: defaultHealthCheckInterval,
+		HealthCheckTimeout:  defaultHealthCheckTimeout,
+		HealthCheckQuery:    defaultHealthCheckQuery,
+	}
+}
+
+//--------------------------------------------------------------------------
+//  FailoverPrometheusClient
+//--------------------------------------------------------------------------
+
+// FailoverPrometheusClient is a prometheus client over several replicas of the same prometheus. The
+// requests are sent to the active endpoint, which is the first healthy one, and fail over to the
+// other endpoints on transport errors or 5xx responses.
+type FailoverPrometheusClient struct {
+	clients []prometheusapi.Client
+	bases   []*url.URL
+	config  FailoverConfig
+
+	m       sync.RWMutex
+	healthy []bool
+	active  int
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// NewFailoverPrometheusClient creates a client for each of the addresses with NewPrometheusClient, and
+// a FailoverPrometheusClient over them, the DefaultFailoverConfig is used if config is nil.
+func NewFailoverPrometheusClient(addresses []string, timeout, keepAlive time.Duration, queryConcurrency int, insecureSkipVerify bool,
+	needRateLimit bool, auth *ClientAuth, config *FailoverConfig, opts ...ClientOption) (*FailoverPrometheusClient, error) {
+	var clients []prometheusapi.Client
+	for _, address := range addresses {
+		client, err := NewPrometheusClient(address, timeout, keepAlive, queryConcurrency, insecureSkipVerify, needRateLimit, auth, opts...)
+		if err != nil {
+			closeClients(clients)
+			return nil, fmt.Errorf("create client for %s failed: %w", address, err)
+		}
+		clients = append(clients, client)
+	}
+
+	return NewFailoverClient(clients, config)
+}
+
+// NewFailoverClient creates a FailoverPrometheusClient over the clients in order of preference, and
+// starts the health checks.
+func NewFailoverClient(clients []prometheusapi.Client, config *FailoverConfig) (*FailoverPrometheusClient, error) {
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("failover client needs at least one endpoint")
+	}
+	if config == nil {
+		config = DefaultFailoverConfig()
+	}
+
+	c := *config
+	if c.HealthCheckTimeout <= 0 {
+		c.HealthCheckTimeout = defaultHealthCheckTimeout
+	}
+	if c.HealthCheckQuery == "" {
+		c.HealthCheckQuery = defaultHealthCheckQuery
+	}
+
+	fpc := &FailoverPrometheusClient{
+		clients: clients,
+		bases:   make([]*url.URL, len(clients)),
+		config:  c,
+		healthy: make([]bool, len(clients)),
+		stopCh:  make(chan struct{}),
+	}
+	for i, client := range clients {
+		fpc.bases[i] = client.URL("", nil)
+		fpc.healthy[i] = true
+	}
+
+	if c.HealthCheckInterval > 0 {
+		go fpc.runHealthChecks()
+	}
+
+	return fpc, nil
+}
+
+// ID is used to identify the type of the endpoint clients
+func (fpc *FailoverPrometheusClient) ID() string {
+	if idc, ok := fpc.clients[0].(interface{ ID() string }); ok {
+		return idc.ID()
+	}
+
+	return ""
+}
+
+// RetryPolicy returns the policy of the preferred endpoint client
+func (fpc *FailoverPrometheusClient) RetryPolicy() *RetryPolicy {
+	return retryPolicyFor(fpc.clients[0])
+}
+
+// Headers returns the default headers of the preferred endpoint client
+func (fpc *FailoverPrometheusClient) Headers() http.Header {
+	return headersFor(fpc.clients[0])
+}
+
+// URL returns the url of the active endpoint, Do sends the request to the endpoint it selects
+func (fpc *FailoverPrometheusClient) URL(ep string, args map[string]string) *url.URL {
+	return fpc.clients[fpc.Active()].URL(ep, args)
+}
+
+// Active returns the index of the active endpoint
+func (fpc *FailoverPrometheusClient) Active() int {
+	fpc.m.RLock()
+	defer fpc.m.RUnlock()
+
+	return fpc.active
+}
+
+// Healthy returns whether the endpoint at index i passed its last health check or request
+func (fpc *FailoverPrometheusClient) Healthy(i int) bool {
+	fpc.m.RLock()
+	defer fpc.m.RUnlock()
+
+	return fpc.healthy[i]
+}
+
+// Close stops the health checks and closes the endpoint clients which support closing
+func (fpc *FailoverPrometheusClient) Close() error {
+	fpc.stopOnce.Do(func() {
+		close(fpc.stopCh)
+	})
+
+	return closeClients(fpc.clients)
+}
+
+// failoverResult is the response of one endpoint to the request
+type failoverResult struct {
+	endpoint int
+	res      *http.Response
+	body     []byte
+	err      error
+	outcome  breakerOutcome
+}
+
+// Do sends the request to the active endpoint, and to the next endpoints in order if it fails, or
+// if it is too slow in hedged mode.
+func (fpc *FailoverPrometheusClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	r := fpc.do(ctx, req, false)
+	return r.res, r.body, r.err
+}
+
+// DoStream is the same as Do, but the response is returned before its body is read, see doStream.
+// The request to the endpoint is cancelled once the caller closes the body, which it must do.
+func (fpc *FailoverPrometheusClient) DoStream(ctx context.Context, req *http.Request) (*http.Response, error) {
+	r := fpc.do(ctx, req, true)
+	return r.res, r.err
+}
+
+// do sends the request to the endpoints as described by Do, the bodies of the responses which are
+// not returned are closed if stream is true
+func (fpc *FailoverPrometheusClient) do(ctx context.Context, req *http.Request, stream bool) *failoverResult {
+	order := fpc.order()
+
+	results := make(chan *failoverResult, len(order))
+	cancels := map[int]context.CancelFunc{}
+	next, pending := 0, 0
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+
+		// the responses still pending lose, their bodies are closed once received
+		if stream && pending > 0 {
+			go discardResults(results, pending)
+		}
+	}()
+
+	send := func() error {
+		endpoint := order[next]
+		next++
+
+		epReq, err := fpc.rewrite(ctx, req, endpoint)
+		if err != nil {
+			return err
+		}
+
+		epCtx, cancel := context.WithCancel(ctx)
+		cancels[endpoint] = cancel
+		pending++
+
+		go func() {
+			r := &failoverResult{endpoint: endpoint}
+			if stream {
+				r.res, r.err = doStream(fpc.clients[endpoint], epCtx, epReq)
+			} else {
+				r.res, r.body, r.err = fpc.clients[endpoint].Do(epCtx, epReq)
+			}
+			r.outcome = requestOutcome(epCtx, r.res, r.err)
+			results <- r
+		}()
+		return nil
+	}
+
+	// keep leaves the request of the returned streamed response running until its body is closed
+	keep := func(r *failoverResult) *failoverResult {
+		if stream && r.res != nil {
+			onBodyClose(r.res, cancels[r.endpoint])
+			delete(cancels, r.endpoint)
+		}
+		return r
+	}
+
+	if err := send(); err != nil {
+		return &failoverResult{err: err}
+	}
+
+	var hedge <-chan time.Time
+	if fpc.config.HedgeAfter > 0 && len(order) > 1 {
+		timer := time.NewTimer(fpc.config.HedgeAfter)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	var last *failoverResult
+	for {
+		select {
+		case r := <-results:
+			pending--
+			if stream && last != nil {
+				discardResult(last)
+			}
+			last = r
+
+			switch r.outcome {
+			case outcomeSuccess:
+				fpc.markHealthy(r.endpoint, true)
+				return keep(r)
+			case outcomeFailure:
+				fpc.markHealthy(r.endpoint, false)
+				klog.Warningf("prometheus endpoint %s failed, err %v", fpc.bases[r.endpoint], r.err)
+			}
+
+			if ctx.Err() == nil && next < len(order) {
+				if err := send(); err != nil {
+					if stream {
+						discardResult(last)
+					}
+					return &failoverResult{err: err}
+				}
+			} else if pending == 0 {
+				return keep(last)
+			}
+
+		case <-hedge:
+			hedge = nil
+			if next < len(order) {
+				if err := send(); err != nil {
+					if stream && last != nil {
+						discardResult(last)
+					}
+					return &failoverResult{err: err}
+				}
+			}
+
+		case <-ctx.Done():
+			if stream && last != nil {
+				discardResult(last)
+			}
+			return &failoverResult{err: ctx.Err()}
+		}
+	}
+}
+
+// discardResult closes the streamed body of the response which is not returned
+func discardResult(r *failoverResult) {
+	if r.res != nil && r.res.Body != nil {
+		r.res.Body.Close()
+	}
+}
+
+// discardResults closes the streamed bodies of the pending responses
+func discardResults(results <-chan *failoverResult, pending int) {
+	for ; pending > 0; pending-- {
+		discardResult(<-results)
+	}
+}
+
+// order returns the endpoints to try, the active one first, then the healthy ones, then the others
+func (fpc *FailoverPrometheusClient) order() []int {
+	fpc.m.RLock()
+	defer fpc.m.RUnlock()
+
+	order := []int{fpc.active}
+	for _, healthy := range []bool{true, false} {
+		for i := range fpc.clients {
+			if i != fpc.active && fpc.healthy[i] == healthy {
+				order = append(order, i)
+			}
+		}
+	}
+
+	return order
+}
+
+// markHealthy records the health of the endpoint, the active endpoint is the first healthy one
+func (fpc *FailoverPrometheusClient) markHealthy(endpoint int, healthy bool) {
+	fpc.m.Lock()
+	defer fpc.m.Unlock()
+
+	fpc.healthy[endpoint] = healthy
+
+	active := fpc.active
+	if !fpc.healthy[active] || (healthy && endpoint < active) {
+		for i := range fpc.clients {
+			if fpc.healthy[i] {
+				active = i
+				break
+			}
+		}
+	}
+
+	if active != fpc.active {
+		klog.Infof("prometheus active endpoint changed from %s to %s", fpc.bases[fpc.active], fpc.bases[active])
+		fpc.active = active
+	}
+}
+
+// rewrite returns a copy of the request targeting the endpoint, the request url may be built from
+// the base url of any endpoint
+func (fpc *FailoverPrometheusClient) rewrite(ctx context.Context, req *http.Request, endpoint int) (*http.Request, error) {
+	path := req.URL.Path
+	for _, base := range fpc.bases {
+		if base.Scheme == req.URL.Scheme && base.Host == req.URL.Host && strings.HasPrefix(path, base.Path) {
+			path = strings.TrimPrefix(path, base.Path)
+			break
+		}
+	}
+
+	u := fpc.clients[endpoint].URL(path, nil)
+	u.RawQuery = req.URL.RawQuery
+
+	epReq := req.Clone(ctx)
+	epReq.URL = u
+	epReq.Host = u.Host
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		epReq.Body = body
+	}
+
+	return epReq, nil
+}
+
+// runHealthChecks checks the endpoints on every health check interval until closed
+func (fpc *FailoverPrometheusClient) runHealthChecks() {
+	ticker := time.NewTicker(fpc.config.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fpc.stopCh:
+			return
+		case <-ticker.C:
+			fpc.checkHealth()
+		}
+	}
+}
+
+// checkHealth queries all the endpoints with the diagnostic context
+func (fpc *FailoverPrometheusClient) checkHealth() {
+	var wg sync.WaitGroup
+	for i := range fpc.clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), fpc.config.HealthCheckTimeout)
+			defer cancel()
+
+			_, err := NewNamedContext(fpc.clients[i], DiagnosticContextName).QuerySyncWithContext(ctx, fpc.config.HealthCheckQuery)
+			if err != nil {
+				klog.Warningf("prometheus endpoint %s health check failed, err %s", fpc.bases[i], err.Error())
+			}
+			fpc.markHealthy(i, err == nil)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// closeClients closes the clients which support closing, and returns the first error
+func closeClients(clients []prometheusapi.Client) error {
+	var first error
+	for _, client := range clients {
+		if closer, ok := client.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+
+	return first
+}
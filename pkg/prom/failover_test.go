@@ -0,0 +1,122 @@
+package prom
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	prometheusapi "github.com/prometheus/client_golang/api"
+)
+
+func newTestFailoverClient(t *testing.T, addresses []string, config *FailoverConfig) *FailoverPrometheusClient {
+	fpc, err := NewFailoverPrometheusClient(addresses, 10*time.Second, 10*time.Second, 2, false, false, &ClientAuth{}, config)
+	if err != nil {
+		t.Fatalf("NewFailoverPrometheusClient failed %s", err.Error())
+	}
+
+	return fpc
+}
+
+func TestFailoverPrometheusClient_Failover(t *testing.T) {
+	var primaryCount, secondaryCount int32
+	primary := newFlakyPromServer(1, http.StatusServiceUnavailable, &primaryCount)
+	defer primary.Close()
+	secondary := newFlakyPromServer(0, http.StatusOK, &secondaryCount)
+	defer secondary.Close()
+
+	fpc := newTestFailoverClient(t, []string{primary.URL, secondary.URL}, &FailoverConfig{})
+	defer fpc.Close()
+	ctx := NewNamedContext(fpc, ClusterContextName)
+
+	if _, err := ctx.QuerySync("up"); err != nil {
+		t.Fatalf("expected the query to fail over, got %s", err.Error())
+	}
+	if atomic.LoadInt32(&primaryCount) != 1 || atomic.LoadInt32(&secondaryCount) != 1 {
+		t.Errorf("expected 1 request to each endpoint, got %d, %d", primaryCount, secondaryCount)
+	}
+	if fpc.Active() != 1 || fpc.Healthy(0) {
+		t.Errorf("expected the secondary endpoint active, got %d", fpc.Active())
+	}
+
+	// the passive endpoint stays active until the primary passes a health check
+	if _, err := ctx.QuerySync("up"); err != nil {
+		t.Fatalf("query failed %s", err.Error())
+	}
+	if n := atomic.LoadInt32(&secondaryCount); n != 2 {
+		t.Errorf("expected the query sent to the active endpoint, got %d", n)
+	}
+
+	fpc.checkHealth()
+	if fpc.Active() != 0 || !fpc.Healthy(0) {
+		t.Errorf("expected fail back to the primary endpoint, got %d", fpc.Active())
+	}
+}
+
+func TestFailoverPrometheusClient_AllFailed(t *testing.T) {
+	var count int32
+	server := newFlakyPromServer(10, http.StatusInternalServerError, &count)
+	defer server.Close()
+
+	fpc := newTestFailoverClient(t, []string{server.URL, server.URL + "/"}, &FailoverConfig{})
+	defer fpc.Close()
+
+	_, err := NewContext(fpc).QuerySync("up")
+	if !IsCommError(err) {
+		t.Errorf("expected CommError, got %v", err)
+	}
+	if n := atomic.LoadInt32(&count); n != 2 {
+		t.Errorf("expected both endpoints tried, got %d requests", n)
+	}
+}
+
+func TestFailoverPrometheusClient_Hedge(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	var slowCount, fastCount int32
+	slow := newBlockingPromServer(release, &slowCount)
+	defer slow.Close()
+	fast := newFlakyPromServer(0, http.StatusOK, &fastCount)
+	defer fast.Close()
+
+	fpc := newTestFailoverClient(t, []string{slow.URL, fast.URL}, &FailoverConfig{HedgeAfter: 20 * time.Millisecond})
+	defer fpc.Close()
+
+	start := time.Now()
+	if _, err := NewContext(fpc).QuerySync("up"); err != nil {
+		t.Fatalf("expected the hedged query to succeed, got %s", err.Error())
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the hedged answer first, took %s", elapsed)
+	}
+	if atomic.LoadInt32(&slowCount) != 1 || atomic.LoadInt32(&fastCount) != 1 {
+		t.Errorf("expected 1 request to each endpoint, got %d, %d", slowCount, fastCount)
+	}
+
+	// a slow endpoint is not unhealthy
+	if fpc.Active() != 0 {
+		t.Errorf("expected the primary endpoint still active, got %d", fpc.Active())
+	}
+}
+
+func TestFailoverPrometheusClient_Rewrite(t *testing.T) {
+	a, _ := prometheusapi.NewClient(prometheusapi.Config{Address: "http://a:9090/prom"})
+	b, _ := prometheusapi.NewClient(prometheusapi.Config{Address: "https://b"})
+	fpc, err := NewFailoverClient([]prometheusapi.Client{a, b}, &FailoverConfig{})
+	if err != nil {
+		t.Fatalf("NewFailoverClient failed %s", err.Error())
+	}
+	defer fpc.Close()
+
+	u := fpc.URL(ctxQuery, nil)
+	u.RawQuery = "query=up"
+	req, _ := http.NewRequest(http.MethodPost, u.String(), nil)
+
+	epReq, err := fpc.rewrite(req.Context(), req, 1)
+	if err != nil {
+		t.Fatalf("rewrite failed %s", err.Error())
+	}
+	if s := epReq.URL.String(); s != "https://b/api/v1/query?query=up" {
+		t.Errorf("unexpected rewritten url %s", s)
+	}
+}
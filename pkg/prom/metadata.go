@@ -0,0 +1,179 @@
+package prom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/util/httputil"
+)
+
+const (
+	ctxLabels      = apiPrefix + "/labels"
+	ctxLabelValues = apiPrefix + "/label/:name/values"
+	ctxSeries      = apiPrefix + "/series"
+	ctxMetadata    = apiPrefix + "/metadata"
+)
+
+// MetricMetadata is the metadata of a metric reported by the targets
+type MetricMetadata struct {
+	// Type is the metric type, e.g. counter, gauge, histogram, summary or unknown
+	Type string `json:"type"`
+	Help string `json:"help"`
+	Unit string `json:"unit"`
+}
+
+// apiResponse is the envelope of the prometheus API responses, the data is decoded by the caller
+type apiResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType ErrorType       `json:"errorType"`
+	Error     string          `json:"error"`
+	Warnings  []string        `json:"warnings"`
+}
+
+// Labels returns the label names of the series selected by the matches in [start, end]. The nil
+// matches select all the series, and the zero start or end leave the range unbounded.
+func (ctx *Context) Labels(reqCtx context.Context, matches []string, start, end time.Time) ([]string, error) {
+	var labels []string
+	err := ctx.api(reqCtx, http.MethodPost, ctxLabels, nil, seriesParams(matches, start, end), &labels)
+	if err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// LabelValues returns the values of the label of the series selected by the matches in [start, end],
+// e.g. the pods or containers which exist. The nil matches select all the series, and the zero
+// start or end leave the range unbounded.
+func (ctx *Context) LabelValues(reqCtx context.Context, label string, matches []string, start, end time.Time) ([]string, error) {
+	var values []string
+	err := ctx.api(reqCtx, http.MethodGet, ctxLabelValues, map[string]string{"name": label}, seriesParams(matches, start, end), &values)
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// Series returns the label sets of the series selected by the matches in [start, end], at least one
+// match is required. The zero start or end leave the range unbounded.
+func (ctx *Context) Series(reqCtx context.Context, matches []string, start, end time.Time) ([]map[string]string, error) {
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("at least one match is required for the series of prometheus")
+	}
+
+	var series []map[string]string
+	err := ctx.api(reqCtx, http.MethodPost, ctxSeries, nil, seriesParams(matches, start, end), &series)
+	if err != nil {
+		return nil, err
+	}
+
+	return series, nil
+}
+
+// Metadata returns the metadata of the metrics by metric name, or of the metric only if it is not
+// empty. A limit > 0 is the maximum number of metrics returned.
+func (ctx *Context) Metadata(reqCtx context.Context, metric string, limit int) (map[string][]MetricMetadata, error) {
+	params := url.Values{}
+	if metric != "" {
+		params.Set("metric", metric)
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	var metadata map[string][]MetricMetadata
+	if err := ctx.api(reqCtx, http.MethodGet, ctxMetadata, nil, params, &metadata); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+// api sends the request to the API endpoint, which has the args replaced in its path, and decodes
+// the data of the response into data. The warnings are reported to the error collector, and the
+// NoStoreAPIWarning is promoted to an error as for the queries.
+func (ctx *Context) api(reqCtx context.Context, method, endpoint string, args map[string]string, params url.Values, data interface{}) error {
+	u := ctx.Client.URL(endpoint, args)
+	u.RawQuery = params.Encode()
+
+	// the request is identified by its path and parameters in the errors and warnings
+	query := u.Path
+	if len(params) > 0 {
+		query += "?" + params.Encode()
+		if unescaped, err := url.QueryUnescape(query); err == nil {
+			query = unescaped
+		}
+	}
+
+	req, resp, body, err := ctx.do(reqCtx, method, u, query)
+	if err != nil {
+		if resp == nil {
+			return fmt.Errorf("query error: '%w' fetching query '%s'", err, query)
+		}
+
+		return fmt.Errorf("query error %d: '%w' fetching query '%s'", resp.StatusCode, err, query)
+	}
+
+	// Unsuccessful Status Code, log body and status
+	statusCode := resp.StatusCode
+	statusText := http.StatusText(statusCode)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return parseErrorBody(query, body, CommErrorf("%d (%s) URL: '%s', Request Headers: '%s', Headers: '%s', Body: '%s' Query: '%s'", statusCode, statusText, req.URL, req.Header, httputil.HeaderString(resp.Header), body, query))
+	}
+
+	var response apiResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("Unmarshal Error: %s\nQuery: %s", err, query)
+	}
+
+	var warnings []string
+	var noStoreAPI bool
+	for _, w := range response.Warnings {
+		if IsNoStoreAPIWarning(w) {
+			noStoreAPI = true
+			continue
+		}
+		warnings = append(warnings, w)
+	}
+	ctx.errorCollector.ReportTenant(requestTenant(req), query, warnings, nil, nil)
+	if noStoreAPI {
+		return NewNoStoreAPIError(query)
+	}
+
+	if response.Status == "error" {
+		return NewPrometheusError(response.ErrorType, response.Error, query, nil)
+	}
+	if response.Status != "success" || response.Data == nil {
+		return PromUnexpectedResponseErr(query)
+	}
+
+	if err := json.Unmarshal(response.Data, data); err != nil {
+		return fmt.Errorf("Unmarshal Error: %s\nQuery: %s", err, query)
+	}
+
+	return nil
+}
+
+// seriesParams returns the match[], start and end parameters of the series selection, the zero
+// start or end are not set
+func seriesParams(matches []string, start, end time.Time) url.Values {
+	params := url.Values{}
+	for _, match := range matches {
+		params.Add("match[]", match)
+	}
+	if !start.IsZero() {
+		params.Set("start", start.Format(time.RFC3339Nano))
+	}
+	if !end.IsZero() {
+		params.Set("end", end.Format(time.RFC3339Nano))
+	}
+
+	return params
+}
@@ -0,0 +1,86 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMetadataAPIs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm failed %s", err.Error())
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/api/v1/labels":
+			if r.Method != http.MethodPost || r.Form.Get("match[]") != "up" || r.Form.Get("start") == "" {
+				t.Errorf("unexpected labels request %s %s", r.Method, r.Form.Encode())
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":["__name__","job"]}`))
+		case "/api/v1/label/pod/values":
+			if r.Method != http.MethodGet || r.Form["match[]"] != nil {
+				t.Errorf("unexpected label values request %s %s", r.Method, r.Form.Encode())
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":["pod-0","pod-1"],"warnings":["partial data"]}`))
+		case "/api/v1/series":
+			_, _ = w.Write([]byte(`{"status":"success","data":[{"__name__":"node_memory_MemTotal_bytes","instance":"node-0"}]}`))
+		case "/api/v1/metadata":
+			if r.Form.Get("metric") != "up" || r.Form.Get("limit") != "1" {
+				t.Errorf("unexpected metadata request %s", r.Form.Encode())
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":{"up":[{"type":"gauge","help":"Target is up","unit":""}]}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"invalid label name"}`))
+		}
+	}))
+	defer server.Close()
+
+	for _, rateLimit := range []bool{false, true} {
+		client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, rateLimit, nil)
+		if err != nil {
+			t.Fatalf("NewPrometheusClient failed %s", err.Error())
+		}
+		ctx := NewContext(client)
+		reqCtx := context.Background()
+
+		labels, err := ctx.Labels(reqCtx, []string{"up"}, time.Now().Add(-time.Hour), time.Time{})
+		if err != nil || !reflect.DeepEqual(labels, []string{"__name__", "job"}) {
+			t.Errorf("expected the labels, got %v %v", labels, err)
+		}
+
+		values, err := ctx.LabelValues(reqCtx, "pod", nil, time.Time{}, time.Time{})
+		if err != nil || !reflect.DeepEqual(values, []string{"pod-0", "pod-1"}) {
+			t.Errorf("expected the label values, got %v %v", values, err)
+		}
+		if warnings := ctx.Warnings(); len(warnings) != 1 || warnings[0].Warnings[0] != "partial data" {
+			t.Errorf("expected the warning reported, got %v", warnings)
+		}
+
+		series, err := ctx.Series(reqCtx, []string{"node_memory_MemTotal_bytes"}, time.Time{}, time.Time{})
+		if err != nil || len(series) != 1 || series[0]["instance"] != "node-0" {
+			t.Errorf("expected the series, got %v %v", series, err)
+		}
+		if _, err := ctx.Series(reqCtx, nil, time.Time{}, time.Time{}); err == nil {
+			t.Errorf("expected an error for the series without match")
+		}
+
+		metadata, err := ctx.Metadata(reqCtx, "up", 1)
+		if err != nil || len(metadata["up"]) != 1 || metadata["up"][0].Type != "gauge" {
+			t.Errorf("expected the metadata, got %v %v", metadata, err)
+		}
+
+		// the error body of an unsuccessful response is a PrometheusError, which wraps the CommError
+		var pe PrometheusError
+		_, err = ctx.LabelValues(reqCtx, "bad-label", nil, time.Time{}, time.Time{})
+		if !errors.As(err, &pe) || pe.Type != ErrorTypeBadData || !IsCommError(err) {
+			t.Errorf("expected a bad_data PrometheusError, got %v", err)
+		}
+	}
+}
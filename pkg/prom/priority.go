@@ -0,0 +1,85 @@
+package prom
+
+// QueryPriority is the priority class of the queries sent through a RateLimitedPrometheusClient.
+// Each class has its own lane in the request queue.
+type QueryPriority int
+
+const (
+	// HighPriority is for latency sensitive queries, like the diagnostic and frontend ones
+	HighPriority QueryPriority = iota
+	// NormalPriority is the priority of the queries from contexts without a configured priority
+	NormalPriority
+	// LowPriority is for heavy queries which can wait, like the range queries of compute cost data
+	LowPriority
+
+	// closerPriority is the lane of the worker closer sentinels, which is served last
+	closerPriority
+)
+
+const (
+	defaultHighPriorityWeight   = 8
+	defaultNormalPriorityWeight = 4
+	defaultLowPriorityWeight    = 1
+)
+
+// PriorityConfig assigns priorities to the named contexts, and weights to the priorities. The queued
+// requests are served by weighted round robin over the priorities, so a priority with weight w gets
+// at least w/total of the workers while it has requests queued. Weights < 1 are treated as 1.
+type PriorityConfig struct {
+	// ContextPriorities maps the context name, see NewNamedContext, to its priority
+	ContextPriorities map[string]QueryPriority
+	Weights           map[QueryPriority]int
+}
+
+// DefaultPriorityConfig returns a PriorityConfig which serves the diagnostic and frontend contexts
+// first, and the compute cost data range context last.
+func DefaultPriorityConfig() *PriorityConfig {
+	return &PriorityConfig{
+		ContextPriorities: map[string]QueryPriority{
+			DiagnosticContextName:           HighPriority,
+			FrontendContextName:             HighPriority,
+			ComputeCostDataRangeContextName: LowPriority,
+		},
+		Weights: map[QueryPriority]int{
+			HighPriority:   defaultHighPriorityWeight,
+			NormalPriority: defaultNormalPriorityWeight,
+			LowPriority:    defaultLowPriorityWeight,
+		},
+	}
+}
+
+// Priority returns the priority of the named context
+func (pc *PriorityConfig) Priority(contextName string) QueryPriority {
+	if pc == nil {
+		return NormalPriority
+	}
+
+	if p, ok := pc.ContextPriorities[contextName]; ok && p >= HighPriority && p <= LowPriority {
+		return p
+	}
+
+	return NormalPriority
+}
+
+// laneWeights returns the queue lane weights indexed by priority, the closer lane has weight 0 so
+// the closers are dequeued after all the requests
+func (pc *PriorityConfig) laneWeights() []int {
+	weights := make([]int, closerPriority+1)
+	for p := HighPriority; p <= LowPriority; p++ {
+		weights[p] = 1
+		if pc != nil && pc.Weights[p] > 1 {
+			weights[p] = pc.Weights[p]
+		}
+	}
+
+	return weights
+}
+
+// workRequestPriority returns the queue lane of a workRequest
+func workRequestPriority(item interface{}) int {
+	if we, ok := item.(*workRequest); ok && !we.closer {
+		return int(we.priority)
+	}
+
+	return int(closerPriority)
+}
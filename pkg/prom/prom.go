@@ -2,10 +2,11 @@ package prom
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
 	"net"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/open-resource-management/metricsclient/pkg/util/atomic"
@@ -23,6 +24,9 @@ const (
 	PrometheusClientID string = "Prometheus"
 )
 
+// ErrClientClosed is returned for the requests sent to or queued in a client which is shut down
+var ErrClientClosed = errors.New("prometheus client is closed")
+
 //--------------------------------------------------------------------------
 //  QueryParamsDecorator
 //--------------------------------------------------------------------------
@@ -31,14 +35,153 @@ const (
 // outgoing requests
 type QueryParamsDecorator = func(path string, values url.Values) url.Values
 
+//--------------------------------------------------------------------------
+//  ClientOption
+//--------------------------------------------------------------------------
+
+// ClientOption configures the optional behaviors of the prometheus clients
+type ClientOption func(*clientOptions)
+
+// clientOptions holds the settings applied by ClientOption
+type clientOptions struct {
+	retry    *RetryPolicy
+	priority *PriorityConfig
+	qps      *QPSLimit
+	breaker  *CircuitBreakerConfig
+	tls      *TLSConfig
+	auth     AuthProvider
+	headers  http.Header
+
+	decorator         QueryParamsDecorator
+	contextDecorators map[string]QueryParamsDecorator
+}
+
+// WithRetryPolicy makes the queries sent by the client retry on transient failures
+func WithRetryPolicy(policy *RetryPolicy) ClientOption {
+	return func(o *clientOptions) {
+		o.retry = policy
+	}
+}
+
+// WithPriorityConfig sets the priorities of the named contexts for the rate limited client, the
+// DefaultPriorityConfig is used if not set
+func WithPriorityConfig(config *PriorityConfig) ClientOption {
+	return func(o *clientOptions) {
+		o.priority = config
+	}
+}
+
+// WithQPSLimit limits the requests per second sent by the client, on top of the concurrency limit
+// if the client is rate limited
+func WithQPSLimit(limit *QPSLimit) ClientOption {
+	return func(o *clientOptions) {
+		o.qps = limit
+	}
+}
+
+// WithCircuitBreaker wraps the client in a CircuitBreakerClient with the given config
+func WithCircuitBreaker(config *CircuitBreakerConfig) ClientOption {
+	return func(o *clientOptions) {
+		o.breaker = config
+		if o.breaker == nil {
+			o.breaker = DefaultCircuitBreakerConfig()
+		}
+	}
+}
+
+// WithTLSConfig configures the CA, client certificate, server name and minimum version of the TLS
+// connections, the insecureSkipVerify argument of NewPrometheusClient still applies
+func WithTLSConfig(config *TLSConfig) ClientOption {
+	return func(o *clientOptions) {
+		o.tls = config
+	}
+}
+
+// WithAuthProvider authenticates the requests with the provider instead of the ClientAuth argument
+// of NewPrometheusClient
+func WithAuthProvider(provider AuthProvider) ClientOption {
+	return func(o *clientOptions) {
+		o.auth = provider
+	}
+}
+
+// WithTenant sends the requests to the tenants with the X-Scope-OrgID header, unless the request
+// sets its own tenant, see Context.SetTenant and WithQueryTenant
+func WithTenant(tenants ...string) ClientOption {
+	return WithHeaders(map[string]string{TenantHeader: TenantID(tenants...)})
+}
+
+// WithHeaders sets the headers on the requests which don't set them already
+func WithHeaders(headers map[string]string) ClientOption {
+	return func(o *clientOptions) {
+		if o.headers == nil {
+			o.headers = http.Header{}
+		}
+		for k, v := range headers {
+			o.headers.Set(k, v)
+		}
+	}
+}
+
+// WithQueryParamsDecorator decorates the query parameters of all the requests sent by the client
+func WithQueryParamsDecorator(decorator QueryParamsDecorator) ClientOption {
+	return func(o *clientOptions) {
+		o.decorator = decorator
+	}
+}
+
+// WithContextQueryParamsDecorator decorates the query parameters of the requests of the named
+// context, see NewNamedContext, before the decorator of all the requests
+func WithContextQueryParamsDecorator(contextName string, decorator QueryParamsDecorator) ClientOption {
+	return func(o *clientOptions) {
+		if o.contextDecorators == nil {
+			o.contextDecorators = map[string]QueryParamsDecorator{}
+		}
+		o.contextDecorators[contextName] = decorator
+	}
+}
+
+// authProvider returns the provider of the options, or the ClientAuth if not set
+func authProvider(auth *ClientAuth, options clientOptions) AuthProvider {
+	if options.auth != nil {
+		return options.auth
+	}
+	if auth != nil {
+		return auth
+	}
+
+	return nil
+}
+
+// authenticate applies the provider to the request if there is one
+func authenticate(provider AuthProvider, req *http.Request) error {
+	if provider == nil {
+		return nil
+	}
+
+	return provider.Authenticate(req)
+}
+
+func newClientOptions(opts []ClientOption) clientOptions {
+	var options clientOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
 //--------------------------------------------------------------------------
 //  PrometheusClient
 //--------------------------------------------------------------------------
 
 func NewPrometheusClient(address string, timeout, keepAlive time.Duration, queryConcurrency int, insecureSkipVerify bool,
-	needRateLimit bool, auth *ClientAuth) (prometheusapi.Client, error) {
+	needRateLimit bool, auth *ClientAuth, opts ...ClientOption) (prometheusapi.Client, error) {
+	options := newClientOptions(opts)
 
-	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	tlsConfig, err := newTLSConfig(options.tls, address, insecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
 
 	pc := prometheusapi.Config{
 		Address: address,
@@ -53,21 +196,39 @@ func NewPrometheusClient(address string, timeout, keepAlive time.Duration, query
 		},
 	}
 
+	var client prometheusapi.Client
 	if needRateLimit {
-		return newRateLimitedClient(PrometheusClientID, pc, queryConcurrency, auth, nil)
+		client, err = newRateLimitedClient(PrometheusClientID, pc, queryConcurrency, authProvider(auth, options), options.decorator, options)
 	} else {
-		return newPrometheusClientImp(PrometheusClientID, pc, auth, nil)
+		client, err = newPrometheusClientImp(PrometheusClientID, pc, authProvider(auth, options), options.decorator, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the breaker wraps the rate limited client, so requests fail fast instead of queueing
+	if options.breaker != nil {
+		client = NewCircuitBreakerClient(client, options.breaker)
 	}
+
+	return client, nil
 }
 
 type PrometheusClient struct {
 	id        string
 	client    prometheusapi.Client
-	auth      *ClientAuth
+	hc        *http.Client
+	auth      AuthProvider
 	decorator QueryParamsDecorator
+	headers   http.Header
+	retry     *RetryPolicy
+	qps       *qpsLimiter
+
+	// contextDecorators decorate the requests of the named contexts before decorator
+	contextDecorators map[string]QueryParamsDecorator
 }
 
-func newPrometheusClientImp(id string, config prometheusapi.Config, auth *ClientAuth, decorator QueryParamsDecorator) (prometheusapi.Client, error) {
+func newPrometheusClientImp(id string, config prometheusapi.Config, auth AuthProvider, decorator QueryParamsDecorator, options clientOptions) (prometheusapi.Client, error) {
 	c, err := prometheusapi.NewClient(config)
 	if err != nil {
 		return nil, err
@@ -76,8 +237,14 @@ func newPrometheusClientImp(id string, config prometheusapi.Config, auth *Client
 	nlpc := &PrometheusClient{
 		id:        id,
 		client:    c,
+		hc:        httpClient(config),
 		decorator: decorator,
 		auth:      auth,
+		headers:   options.headers,
+		retry:     options.retry,
+		qps:       newQPSLimiter(options.qps),
+
+		contextDecorators: options.contextDecorators,
 	}
 
 	return nlpc, nil
@@ -88,6 +255,16 @@ func (nlpc *PrometheusClient) ID() string {
 	return nlpc.id
 }
 
+// RetryPolicy returns the policy used to retry failed queries, nil if queries are not retried
+func (nlpc *PrometheusClient) RetryPolicy() *RetryPolicy {
+	return nlpc.retry
+}
+
+// Headers returns the headers set on the requests which don't set them already, e.g. the tenant
+func (nlpc *PrometheusClient) Headers() http.Header {
+	return nlpc.headers
+}
+
 // Passthrough to the prometheus client API
 func (nlpc *PrometheusClient) URL(ep string, args map[string]string) *url.URL {
 	return nlpc.client.URL(ep, args)
@@ -95,8 +272,39 @@ func (nlpc *PrometheusClient) URL(ep string, args map[string]string) *url.URL {
 
 //passthrough to prometheus client API
 func (nlpc *PrometheusClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
-	nlpc.auth.Apply(req)
-	return nlpc.client.Do(ctx, req)
+	if err := nlpc.prepare(ctx, req); err != nil {
+		return nil, nil, err
+	}
+
+	res, body, err := nlpc.client.Do(ctx, req)
+	nlpc.qps.Observe(res, err)
+	return res, body, err
+}
+
+// DoStream is the same as Do, but the response is returned before its body is read. The caller must
+// close the body of the response.
+func (nlpc *PrometheusClient) DoStream(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if err := nlpc.prepare(ctx, req); err != nil {
+		return nil, err
+	}
+
+	res, err := nlpc.hc.Do(req.WithContext(ctx))
+	nlpc.qps.Observe(res, err)
+	return res, err
+}
+
+// prepare sets the default headers, credentials and query parameters on the request, and waits for
+// the qps limit
+func (nlpc *PrometheusClient) prepare(ctx context.Context, req *http.Request) error {
+	setDefaultHeaders(req, nlpc.headers)
+	if err := authenticate(nlpc.auth, req); err != nil {
+		return err
+	}
+
+	// decorate the raw query parameters
+	decorate(req, nlpc.decorator, nlpc.contextDecorators)
+
+	return nlpc.qps.Wait(ctx)
 }
 
 //--------------------------------------------------------------------------
@@ -104,14 +312,29 @@ func (nlpc *PrometheusClient) Do(ctx context.Context, req *http.Request) (*http.
 //--------------------------------------------------------------------------
 
 // RateLimitedPrometheusClient is a prometheus client which limits the total number of
-// concurrent outbound requests allowed at a given moment.
+// concurrent outbound requests allowed at a given moment. The queued requests are served
+// by the priority of their named context, see PriorityConfig.
 type RateLimitedPrometheusClient struct {
 	id        string
 	client    prometheusapi.Client
-	auth      *ClientAuth
+	hc        *http.Client
+	auth      AuthProvider
 	queue     queue.BlockingQueue
 	decorator QueryParamsDecorator
+	headers   http.Header
 	outbound  *atomic.AtomicInt32
+	retry     *RetryPolicy
+	priority  *PriorityConfig
+	qps       *qpsLimiter
+
+	// contextDecorators decorate the requests of the named contexts before decorator
+	contextDecorators map[string]QueryParamsDecorator
+
+	// closed is guarded by m, so no request is enqueued after the closer sentinels
+	m        sync.RWMutex
+	closed   bool
+	workers  sync.WaitGroup
+	capacity int
 }
 
 // requestCounter is used to determine if the prometheus client keeps track of
@@ -123,25 +346,39 @@ type requestCounter interface {
 
 // NewRateLimitedClient creates a prometheus client which limits the number of concurrent outbound
 // prometheus requests.
-func newRateLimitedClient(id string, config prometheusapi.Config, maxConcurrency int, auth *ClientAuth, decorator QueryParamsDecorator) (prometheusapi.Client, error) {
+func newRateLimitedClient(id string, config prometheusapi.Config, maxConcurrency int, auth AuthProvider, decorator QueryParamsDecorator, options clientOptions) (prometheusapi.Client, error) {
 	c, err := prometheusapi.NewClient(config)
 	if err != nil {
 		return nil, err
 	}
 
-	queue := queue.NewBlockingQueue()
+	priority := options.priority
+	if priority == nil {
+		priority = DefaultPriorityConfig()
+	}
+
+	queue := queue.NewPriorityBlockingQueue(priority.laneWeights(), workRequestPriority)
 	outbound := atomic.NewAtomicInt32(0)
 
 	rlpc := &RateLimitedPrometheusClient{
 		id:        id,
 		client:    c,
+		hc:        httpClient(config),
 		queue:     queue,
 		decorator: decorator,
 		outbound:  outbound,
 		auth:      auth,
+		headers:   options.headers,
+		retry:     options.retry,
+		priority:  priority,
+		qps:       newQPSLimiter(options.qps),
+		capacity:  maxConcurrency,
+
+		contextDecorators: options.contextDecorators,
 	}
 
 	// Start concurrent request processing
+	rlpc.workers.Add(maxConcurrency)
 	for i := 0; i < maxConcurrency; i++ {
 		go rlpc.worker()
 	}
@@ -154,6 +391,16 @@ func (rlpc *RateLimitedPrometheusClient) ID() string {
 	return rlpc.id
 }
 
+// RetryPolicy returns the policy used to retry failed queries, nil if queries are not retried
+func (rlpc *RateLimitedPrometheusClient) RetryPolicy() *RetryPolicy {
+	return rlpc.retry
+}
+
+// Headers returns the headers set on the requests which don't set them already, e.g. the tenant
+func (rlpc *RateLimitedPrometheusClient) Headers() http.Header {
+	return rlpc.headers
+}
+
 // TotalRequests returns the total number of requests that are either waiting to be sent and/or
 // are currently outbound.
 func (rlpc *RateLimitedPrometheusClient) TotalQueuedRequests() int {
@@ -179,9 +426,13 @@ type workRequest struct {
 	respChan chan *workResponse
 	// used as a sentinel value to close the worker goroutine
 	closer bool
+	// the queue lane of the request
+	priority QueryPriority
 	// request metadata for diagnostics
 	contextName string
 	query       string
+	// stream returns the response before its body is read, see DoStream
+	stream bool
 }
 
 // workResponse is the response payload returned to the Do method
@@ -193,6 +444,8 @@ type workResponse struct {
 
 // worker is used as a consumer goroutine to pull workRequest from the blocking queue and execute them
 func (rlpc *RateLimitedPrometheusClient) worker() {
+	defer rlpc.workers.Done()
+
 	for {
 		// blocks until there is an item available
 		item := rlpc.queue.Dequeue()
@@ -208,11 +461,27 @@ func (rlpc *RateLimitedPrometheusClient) worker() {
 			ctx := we.ctx
 			req := we.req
 
-			// decorate the raw query parameters
-			if rlpc.decorator != nil {
-				req.URL.RawQuery = rlpc.decorator(req.URL.Path, req.URL.Query()).Encode()
+			// skip the request if the caller gave up while it was queued
+			if err := ctx.Err(); err != nil {
+				we.respChan <- &workResponse{err: err}
+				continue
+			}
+
+			// wait for the qps limit, which holds the worker
+			if err := rlpc.qps.Wait(ctx); err != nil {
+				we.respChan <- &workResponse{err: err}
+				continue
+			}
+
+			// authenticate right before sending, so refreshed credentials are used for queued requests
+			if err := authenticate(rlpc.auth, req); err != nil {
+				we.respChan <- &workResponse{err: err}
+				continue
 			}
 
+			// decorate the raw query parameters
+			decorate(req, rlpc.decorator, rlpc.contextDecorators)
+
 			// measure time in queue
 			timeInQueue := time.Since(we.start)
 
@@ -221,11 +490,22 @@ func (rlpc *RateLimitedPrometheusClient) worker() {
 
 			// Execute Request
 			roundTripStart := time.Now()
-			res, body, err := rlpc.client.Do(ctx, req)
+			var res *http.Response
+			var body []byte
+			var err error
+			if we.stream {
+				res, err = rlpc.hc.Do(req.WithContext(ctx))
+			} else {
+				res, body, err = rlpc.client.Do(ctx, req)
+			}
+			rlpc.qps.Observe(res, err)
 
-			// Decrement outbound counter
-			rlpc.outbound.Decrement()
-			LogQueryRequest(req, timeInQueue, time.Since(roundTripStart))
+			// the streamed body is read by the caller, which holds the worker until it closes the body
+			var closed chan struct{}
+			if we.stream && res != nil {
+				closed = make(chan struct{})
+				onBodyClose(res, func() { close(closed) })
+			}
 
 			// Pass back response data over channel to caller
 			we.respChan <- &workResponse{
@@ -233,16 +513,41 @@ func (rlpc *RateLimitedPrometheusClient) worker() {
 				body: body,
 				err:  err,
 			}
+
+			// the body is closed here if the caller gave up before receiving the response
+			if closed != nil {
+				select {
+				case <-closed:
+				case <-ctx.Done():
+					res.Body.Close()
+				}
+			}
+
+			// Decrement outbound counter
+			rlpc.outbound.Decrement()
+			LogQueryRequest(req, timeInQueue, time.Since(roundTripStart))
 		}
 	}
 }
 
 // Rate limit and passthrough to prometheus client API
 func (rlpc *RateLimitedPrometheusClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
-	rlpc.auth.Apply(req)
+	workRes := rlpc.do(ctx, req, false)
+	return workRes.res, workRes.body, workRes.err
+}
+
+// DoStream is the same as Do, but the response is returned before its body is read. The request
+// holds its worker until the caller closes the body of the response, which it must do.
+func (rlpc *RateLimitedPrometheusClient) DoStream(ctx context.Context, req *http.Request) (*http.Response, error) {
+	workRes := rlpc.do(ctx, req, true)
+	return workRes.res, workRes.err
+}
 
-	respChan := make(chan *workResponse)
-	defer close(respChan)
+// do queues the request and waits for its response
+func (rlpc *RateLimitedPrometheusClient) do(ctx context.Context, req *http.Request, stream bool) *workResponse {
+	// buffered so a worker never blocks on a caller that was cancelled, the channel is
+	// left open as the worker may still send after Do returns
+	respChan := make(chan *workResponse, 1)
 
 	// request names are used as a debug utility to identify requests in queue
 	contextName := "<none>"
@@ -251,18 +556,96 @@ func (rlpc *RateLimitedPrometheusClient) Do(ctx context.Context, req *http.Reque
 	}
 	query, _ := httputil.GetQuery(req)
 
+	setDefaultHeaders(req, rlpc.headers)
+
+	rlpc.m.RLock()
+	if rlpc.closed {
+		rlpc.m.RUnlock()
+		return &workResponse{err: ErrClientClosed}
+	}
 	rlpc.queue.Enqueue(&workRequest{
 		ctx:         ctx,
 		req:         req,
 		start:       time.Now(),
 		respChan:    respChan,
 		closer:      false,
+		priority:    rlpc.priority.Priority(contextName),
 		contextName: contextName,
 		query:       query,
+		stream:      stream,
 	})
+	rlpc.m.RUnlock()
 
-	workRes := <-respChan
-	return workRes.res, workRes.body, workRes.err
+	select {
+	case workRes := <-respChan:
+		return workRes
+	case <-ctx.Done():
+		return &workResponse{err: ctx.Err()}
+	}
+}
+
+// Close fails the queued requests with ErrClientClosed and waits for the in-flight requests
+// to complete, see Shutdown.
+func (rlpc *RateLimitedPrometheusClient) Close() error {
+	return rlpc.Shutdown(context.Background(), false)
+}
+
+// Shutdown stops accepting new requests, which fail with ErrClientClosed, and stops the workers.
+// The queued requests are sent before the workers stop if drain is true, otherwise they fail with
+// ErrClientClosed. Shutdown waits for the workers until ctx is done, in which case the requests
+// still queued are failed and ctx.Err() is returned. It is safe to call multiple times.
+func (rlpc *RateLimitedPrometheusClient) Shutdown(ctx context.Context, drain bool) error {
+	rlpc.m.Lock()
+	if !rlpc.closed {
+		rlpc.closed = true
+
+		if !drain {
+			rlpc.failQueued(ErrClientClosed)
+		}
+
+		// the sentinels are queued after the pending requests, one for each worker
+		for i := 0; i < rlpc.capacity; i++ {
+			rlpc.queue.Enqueue(&workRequest{closer: true})
+		}
+	}
+	rlpc.m.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		rlpc.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		rlpc.failQueued(ErrClientClosed)
+		return ctx.Err()
+	}
+}
+
+// failQueued responds err to all the queued requests, the closer sentinels are kept in the queue
+func (rlpc *RateLimitedPrometheusClient) failQueued(err error) {
+	closers := 0
+	for {
+		item, ok := rlpc.queue.TryDequeue()
+		if !ok {
+			break
+		}
+
+		if we, ok := item.(*workRequest); ok {
+			if we.closer {
+				closers++
+				continue
+			}
+			we.respChan <- &workResponse{err: err}
+		}
+	}
+
+	for i := 0; i < closers; i++ {
+		rlpc.queue.Enqueue(&workRequest{closer: true})
+	}
 }
 
 // LogQueryRequest logs the query that was send to prom/thanos with the time in queue and total time after being sent
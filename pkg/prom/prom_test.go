@@ -1,6 +1,13 @@
 package prom
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -23,3 +30,326 @@ func TestNewPrometheusClient(t *testing.T) {
 
 	t.Logf("TestNewPrometheusClient succeed")
 }
+
+// newBlockingPromServer returns a server which answers an empty vector once release is closed
+// or the request is cancelled, and counts the requests it received
+func newBlockingPromServer(release chan struct{}, count *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(count, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+}
+
+func TestQuerySyncWithContext_Cancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	var count int32
+	server := newBlockingPromServer(release, &count)
+	defer server.Close()
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, false, &ClientAuth{})
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+	ctx := NewNamedContext(client, ClusterContextName)
+
+	reqCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = ctx.QuerySyncWithContext(reqCtx, "up")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("in-flight request was not aborted, took %s", elapsed)
+	}
+}
+
+func TestQueryWithContext_Cancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	var count int32
+	server := newBlockingPromServer(release, &count)
+	defer server.Close()
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, false, &ClientAuth{})
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+	ctx := NewNamedContext(client, ClusterContextName)
+
+	// the request error is returned by Await, not a communication error of the nil body
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelDeadline()
+	if _, err := ctx.QueryWithContext(deadline, "up").Await(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	resCh := ctx.QueryRangeWithContext(cancelled, "up", time.Now().Add(-time.Hour), time.Now(), time.Minute)
+	for atomic.LoadInt32(&count) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if _, err := resCh.Await(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+
+	// each request error is collected once
+	if errs := ctx.Errors(); len(errs) != 2 || errs[0].ParseError != nil || errs[1].ParseError != nil {
+		t.Fatalf("expected the 2 request errors, got %v", errs)
+	}
+}
+
+func TestRateLimitedClient_SkipCancelled(t *testing.T) {
+	release := make(chan struct{})
+	var count int32
+	server := newBlockingPromServer(release, &count)
+	defer server.Close()
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, true, &ClientAuth{})
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+	ctx := NewNamedContext(client, ClusterContextName)
+
+	// occupy the only worker
+	blocked := ctx.QueryWithContext(context.Background(), "up")
+	for atomic.LoadInt32(&count) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// queue a request and give up on it while the worker is busy
+	reqCtx, cancel := context.WithCancel(context.Background())
+	queued := make(chan error, 1)
+	go func() {
+		_, err := ctx.QueryRangeSyncWithContext(reqCtx, "up", time.Now().Add(-time.Hour), time.Now(), time.Minute)
+		queued <- err
+	}()
+	cancel()
+	select {
+	case err := <-queued:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("cancelled request did not return while queued")
+	}
+
+	close(release)
+	if _, err := blocked.Await(); err != nil {
+		t.Fatalf("blocked query failed %s", err.Error())
+	}
+	if _, err := ctx.QuerySync("up"); err != nil {
+		t.Fatalf("query failed %s", err.Error())
+	}
+
+	if n := atomic.LoadInt32(&count); n != 2 {
+		t.Fatalf("expected the cancelled request to be skipped, server got %d requests", n)
+	}
+}
+
+func newTestRateLimitedClient(t *testing.T, address string, concurrency int) (*Context, *RateLimitedPrometheusClient) {
+	client, err := NewPrometheusClient(address, 10*time.Second, 10*time.Second, concurrency, false, true, &ClientAuth{})
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+
+	return NewNamedContext(client, ClusterContextName), client.(*RateLimitedPrometheusClient)
+}
+
+func isClosed(rlpc *RateLimitedPrometheusClient) bool {
+	rlpc.m.RLock()
+	defer rlpc.m.RUnlock()
+
+	return rlpc.closed
+}
+
+func TestRateLimitedClient_CloseWorkers(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	for i := 0; i < 50; i++ {
+		_, rlpc := newTestRateLimitedClient(t, "http://127.0.0.1", 10)
+		if err := rlpc.Close(); err != nil {
+			t.Fatalf("Close failed %s", err.Error())
+		}
+	}
+
+	if n := runtime.NumGoroutine(); n > baseline+5 {
+		t.Fatalf("expected the workers to stop, %d goroutines before, %d after", baseline, n)
+	}
+}
+
+func TestRateLimitedClient_Shutdown(t *testing.T) {
+	cases := []struct {
+		name  string
+		drain bool
+		// the error expected for the queued request
+		queuedErr error
+		requests  int32
+	}{
+		{name: "drain", drain: true, queuedErr: nil, requests: 2},
+		{name: "fail", drain: false, queuedErr: ErrClientClosed, requests: 1},
+	}
+
+	for _, c := range cases {
+		release := make(chan struct{})
+		var count int32
+		server := newBlockingPromServer(release, &count)
+
+		ctx, rlpc := newTestRateLimitedClient(t, server.URL, 1)
+
+		// occupy the only worker, then queue another request
+		inflight := ctx.Query("up")
+		for atomic.LoadInt32(&count) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		queued := make(chan error, 1)
+		go func() {
+			_, err := ctx.QuerySync("up")
+			queued <- err
+		}()
+		for rlpc.TotalQueuedRequests() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		shutdown := make(chan error, 1)
+		go func() {
+			shutdown <- rlpc.Shutdown(context.Background(), c.drain)
+		}()
+
+		// new requests are rejected as soon as the shutdown starts
+		for !isClosed(rlpc) {
+			time.Sleep(time.Millisecond)
+		}
+		if _, err := ctx.QuerySync("up"); !errors.Is(err, ErrClientClosed) {
+			t.Errorf("%s: expected new query rejected, got %v", c.name, err)
+		}
+
+		close(release)
+		if _, err := inflight.Await(); err != nil {
+			t.Errorf("%s: in-flight query failed %s", c.name, err.Error())
+		}
+		if err := <-queued; !errors.Is(err, c.queuedErr) {
+			t.Errorf("%s: expected queued query error %v, got %v", c.name, c.queuedErr, err)
+		}
+		if err := <-shutdown; err != nil {
+			t.Errorf("%s: Shutdown failed %s", c.name, err.Error())
+		}
+		if n := atomic.LoadInt32(&count); n != c.requests {
+			t.Errorf("%s: expected %d requests sent, got %d", c.name, c.requests, n)
+		}
+
+		server.Close()
+	}
+}
+
+func TestRateLimitedClient_ShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	var count int32
+	server := newBlockingPromServer(release, &count)
+	defer server.Close()
+
+	ctx, rlpc := newTestRateLimitedClient(t, server.URL, 1)
+
+	inflight := ctx.Query("up")
+	for atomic.LoadInt32(&count) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	deadline, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := rlpc.Shutdown(deadline, true); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	close(release)
+	if _, err := inflight.Await(); err != nil {
+		t.Errorf("in-flight query failed %s", err.Error())
+	}
+	if err := rlpc.Close(); err != nil {
+		t.Errorf("Close failed %s", err.Error())
+	}
+}
+
+func TestRateLimitedClient_Priority(t *testing.T) {
+	release := make(chan struct{})
+	var m sync.Mutex
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		queries = append(queries, r.URL.Query().Get("query"))
+		m.Unlock()
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, true, &ClientAuth{})
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+	rlpc := client.(*RateLimitedPrometheusClient)
+	defer rlpc.Close()
+	low := NewNamedContext(client, ComputeCostDataRangeContextName)
+	high := NewNamedContext(client, DiagnosticContextName)
+
+	// occupy the only worker, then flood the low priority lane before the high priority query
+	blocked := low.Query("blocked")
+	for rlpc.TotalOutboundRequests() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	var pending []QueryResultsChan
+	for i := 0; i < 5; i++ {
+		pending = append(pending, low.Query("low"))
+		for rlpc.TotalQueuedRequests() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	pending = append(pending, high.Query("high"))
+	for rlpc.TotalQueuedRequests() != 6 {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	blocked.Await()
+	for _, p := range pending {
+		p.Await()
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if len(queries) != 7 || queries[1] != "high" {
+		t.Errorf("expected the high priority query to be sent first, got %v", queries)
+	}
+}
+
+func TestPriorityConfig_Priority(t *testing.T) {
+	config := DefaultPriorityConfig()
+
+	cases := map[string]QueryPriority{
+		DiagnosticContextName:           HighPriority,
+		FrontendContextName:             HighPriority,
+		ClusterContextName:              NormalPriority,
+		"<none>":                        NormalPriority,
+		ComputeCostDataRangeContextName: LowPriority,
+	}
+	for name, expected := range cases {
+		if p := config.Priority(name); p != expected {
+			t.Errorf("%s: expected priority %d, got %d", name, expected, p)
+		}
+	}
+
+	var none *PriorityConfig
+	if p := none.Priority(DiagnosticContextName); p != NormalPriority {
+		t.Errorf("expected normal priority for nil config, got %d", p)
+	}
+}
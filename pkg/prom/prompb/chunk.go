@@ -0,0 +1,302 @@
+package prompb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// Samples decodes the samples of the XOR chunk, which is the gorilla encoding of the prometheus TSDB:
+// the number of samples as a big endian uint16 followed by the bit stream of the delta of delta
+// encoded timestamps and the XOR encoded values.
+func (m *Chunk) Samples() ([]Sample, error) {
+	if m.Type != ChunkEncodingXOR {
+		return nil, fmt.Errorf("prompb: unsupported chunk encoding %d", m.Type)
+	}
+	if len(m.Data) < 2 {
+		return nil, fmt.Errorf("prompb: XOR chunk of %d bytes is too short", len(m.Data))
+	}
+
+	num := int(binary.BigEndian.Uint16(m.Data))
+	it := xorIterator{br: bitReader{b: m.Data[2:]}, leading: 0xff}
+
+	samples := make([]Sample, 0, num)
+	for i := 0; i < num; i++ {
+		if err := it.next(i); err != nil {
+			return nil, fmt.Errorf("prompb: reading sample %d of the XOR chunk: %w", i, err)
+		}
+		samples = append(samples, Sample{Timestamp: it.t, Value: math.Float64frombits(it.v)})
+	}
+
+	return samples, nil
+}
+
+// NewXORChunk encodes the samples into a XOR chunk, e.g. to serve the streamed responses of a remote
+// read endpoint. At most math.MaxUint16 samples are encoded in a chunk.
+func NewXORChunk(samples []Sample) (Chunk, error) {
+	if len(samples) > math.MaxUint16 {
+		return Chunk{}, fmt.Errorf("prompb: %d samples exceed the XOR chunk size", len(samples))
+	}
+
+	w := bitWriter{b: make([]byte, 2, 2+len(samples)*2)}
+	binary.BigEndian.PutUint16(w.b, uint16(len(samples)))
+
+	var t, tDelta int64
+	var v uint64
+	leading, trailing := uint8(0xff), uint8(0)
+
+	for i, s := range samples {
+		vbits := math.Float64bits(s.Value)
+
+		switch i {
+		case 0:
+			var buf [binary.MaxVarintLen64]byte
+			for _, b := range buf[:binary.PutVarint(buf[:], s.Timestamp)] {
+				w.writeBits(uint64(b), 8)
+			}
+			w.writeBits(vbits, 64)
+
+		case 1:
+			tDelta = s.Timestamp - t
+			var buf [binary.MaxVarintLen64]byte
+			for _, b := range buf[:binary.PutUvarint(buf[:], uint64(tDelta))] {
+				w.writeBits(uint64(b), 8)
+			}
+			leading, trailing = w.writeXOR(vbits, v, leading, trailing)
+
+		default:
+			delta := s.Timestamp - t
+			dod := delta - tDelta
+			switch {
+			case dod == 0:
+				w.writeBits(0, 1)
+			case bitRange(dod, 14):
+				w.writeBits(0x02, 2)
+				w.writeBits(uint64(dod), 14)
+			case bitRange(dod, 17):
+				w.writeBits(0x06, 3)
+				w.writeBits(uint64(dod), 17)
+			case bitRange(dod, 20):
+				w.writeBits(0x0e, 4)
+				w.writeBits(uint64(dod), 20)
+			default:
+				w.writeBits(0x0f, 4)
+				w.writeBits(uint64(dod), 64)
+			}
+			tDelta = delta
+			leading, trailing = w.writeXOR(vbits, v, leading, trailing)
+		}
+
+		t, v = s.Timestamp, vbits
+	}
+
+	chunk := Chunk{Type: ChunkEncodingXOR, Data: w.b}
+	if len(samples) > 0 {
+		chunk.MinTimeMs, chunk.MaxTimeMs = samples[0].Timestamp, samples[len(samples)-1].Timestamp
+	}
+
+	return chunk, nil
+}
+
+// bitRange returns true if x is in the range of the nbits delta of delta encoding
+func bitRange(x int64, nbits uint8) bool {
+	return -((1<<(nbits-1))-1) <= x && x <= 1<<(nbits-1)
+}
+
+// xorIterator decodes the samples of a XOR chunk
+type xorIterator struct {
+	br bitReader
+
+	t      int64
+	v      uint64
+	tDelta uint64
+
+	leading  uint8
+	trailing uint8
+}
+
+// next decodes the i-th sample
+func (it *xorIterator) next(i int) error {
+	switch i {
+	case 0:
+		t, err := binary.ReadVarint(&it.br)
+		if err != nil {
+			return err
+		}
+		v, err := it.br.readBits(64)
+		if err != nil {
+			return err
+		}
+		it.t, it.v = t, v
+		return nil
+
+	case 1:
+		tDelta, err := binary.ReadUvarint(&it.br)
+		if err != nil {
+			return err
+		}
+		it.tDelta = tDelta
+		it.t += int64(tDelta)
+		return it.readValue()
+	}
+
+	// the prefix of the delta of delta is up to four 1 bits followed by a 0 bit
+	var prefix uint8
+	for ; prefix < 4; prefix++ {
+		bit, err := it.br.readBits(1)
+		if err != nil {
+			return err
+		}
+		if bit == 0 {
+			break
+		}
+	}
+
+	var size uint8
+	switch prefix {
+	case 1:
+		size = 14
+	case 2:
+		size = 17
+	case 3:
+		size = 20
+	case 4:
+		size = 64
+	}
+
+	var dod int64
+	if size > 0 {
+		b, err := it.br.readBits(size)
+		if err != nil {
+			return err
+		}
+		// the deltas of delta are two's complement in size bits
+		if size != 64 && b > (1<<(size-1)) {
+			b -= 1 << size
+		}
+		dod = int64(b)
+	}
+
+	it.tDelta = uint64(int64(it.tDelta) + dod)
+	it.t += int64(it.tDelta)
+	return it.readValue()
+}
+
+// readValue decodes the XOR of the value with the previous one
+func (it *xorIterator) readValue() error {
+	bit, err := it.br.readBits(1)
+	if err != nil || bit == 0 {
+		return err
+	}
+
+	bit, err = it.br.readBits(1)
+	if err != nil {
+		return err
+	}
+	if bit == 1 {
+		leading, err := it.br.readBits(5)
+		if err != nil {
+			return err
+		}
+		sigbits, err := it.br.readBits(6)
+		if err != nil {
+			return err
+		}
+		// 0 significant bits is an overflow of 64
+		if sigbits == 0 {
+			sigbits = 64
+		}
+		if leading+sigbits > 64 {
+			return fmt.Errorf("the XOR value has %d leading zeros and %d significant bits", leading, sigbits)
+		}
+		it.leading, it.trailing = uint8(leading), uint8(64-leading-sigbits)
+	} else if it.leading == 0xff {
+		return fmt.Errorf("the XOR value reuses the unset leading and trailing zeros")
+	}
+
+	b, err := it.br.readBits(64 - it.leading - it.trailing)
+	if err != nil {
+		return err
+	}
+	it.v ^= b << it.trailing
+	return nil
+}
+
+// writeXOR writes the XOR of the value with the previous one, and returns the leading and trailing
+// zeros of the value written
+func (w *bitWriter) writeXOR(v, prev uint64, leading, trailing uint8) (uint8, uint8) {
+	delta := v ^ prev
+	if delta == 0 {
+		w.writeBits(0, 1)
+		return leading, trailing
+	}
+	w.writeBits(1, 1)
+
+	newLeading, newTrailing := uint8(bits.LeadingZeros64(delta)), uint8(bits.TrailingZeros64(delta))
+	// the leading zeros are written in 5 bits
+	if newLeading >= 32 {
+		newLeading = 31
+	}
+
+	if leading != 0xff && newLeading >= leading && newTrailing >= trailing {
+		w.writeBits(0, 1)
+		w.writeBits(delta>>trailing, 64-leading-trailing)
+		return leading, trailing
+	}
+
+	sigbits := 64 - newLeading - newTrailing
+	w.writeBits(1, 1)
+	w.writeBits(uint64(newLeading), 5)
+	// 64 significant bits overflow to 0 in 6 bits
+	w.writeBits(uint64(sigbits), 6)
+	w.writeBits(delta>>newTrailing, sigbits)
+	return newLeading, newTrailing
+}
+
+// bitReader reads the bits of b from the most significant bit of each byte
+type bitReader struct {
+	b []byte
+	// pos is the position of the next bit
+	pos uint
+}
+
+func (r *bitReader) readBits(n uint8) (uint64, error) {
+	if uint(len(r.b))*8-r.pos < uint(n) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	var v uint64
+	for i := uint8(0); i < n; i++ {
+		bit := (r.b[r.pos/8] >> (7 - r.pos%8)) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+
+	return v, nil
+}
+
+// ReadByte reads the next 8 bits, which are not aligned on the bytes of b after the first sample
+func (r *bitReader) ReadByte() (byte, error) {
+	v, err := r.readBits(8)
+	return byte(v), err
+}
+
+// bitWriter appends bits to b from the most significant bit of each byte
+type bitWriter struct {
+	b []byte
+	// free is the number of bits free in the last byte of b
+	free uint8
+}
+
+func (w *bitWriter) writeBits(v uint64, n uint8) {
+	for i := int(n) - 1; i >= 0; i-- {
+		if w.free == 0 {
+			w.b = append(w.b, 0)
+			w.free = 8
+		}
+		w.free--
+		w.b[len(w.b)-1] |= byte((v>>uint(i))&1) << w.free
+	}
+}
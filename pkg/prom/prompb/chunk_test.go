@@ -0,0 +1,85 @@
+package prompb
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestChunk_Samples(t *testing.T) {
+	// two samples with the same value: the count, the varint of the first timestamp, the bits of the
+	// first value, the uvarint of the delta and the 0 bit of the unchanged value
+	chunk := Chunk{Type: ChunkEncodingXOR, Data: []byte{
+		0x00, 0x02,
+		0xd0, 0x0f,
+		0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x0f,
+		0x00,
+	}}
+
+	samples, err := chunk.Samples()
+	expected := []Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 1015, Value: 1}}
+	if err != nil || !reflect.DeepEqual(samples, expected) {
+		t.Errorf("expected %v, got %v %v", expected, samples, err)
+	}
+
+	encoded, err := NewXORChunk(expected)
+	if err != nil || !bytes.Equal(encoded.Data, chunk.Data) || encoded.MinTimeMs != 1000 || encoded.MaxTimeMs != 1015 {
+		t.Errorf("expected %x, got %x %v", chunk.Data, encoded.Data, err)
+	}
+}
+
+func TestXORChunk_RoundTrip(t *testing.T) {
+	// the timestamps cover all the sizes of the delta of delta, and the values the reuse of the
+	// leading and trailing zeros, the 64 significant bits and the special values
+	timestamps := []int64{-5000, 15000, 30000, 45000, 45001, 50000, 100000, 1100000, 1100001, 1 << 40, 1<<40 + 15000}
+	values := []float64{0, 1, 1, 2, 3.5, -3.5, math.MaxFloat64, math.SmallestNonzeroFloat64, math.Inf(1), 0.1, 0.1}
+
+	samples := make([]Sample, len(timestamps))
+	for i := range timestamps {
+		samples[i] = Sample{Timestamp: timestamps[i], Value: values[i]}
+	}
+
+	for n := 0; n <= len(samples); n++ {
+		chunk, err := NewXORChunk(samples[:n])
+		if err != nil {
+			t.Fatalf("NewXORChunk failed %s", err.Error())
+		}
+
+		decoded, err := chunk.Samples()
+		if err != nil || len(decoded) != n {
+			t.Fatalf("expected %d samples, got %v %v", n, decoded, err)
+		}
+		for i := range decoded {
+			if decoded[i].Timestamp != samples[i].Timestamp || math.Float64bits(decoded[i].Value) != math.Float64bits(samples[i].Value) {
+				t.Errorf("expected %v, got %v", samples[i], decoded[i])
+			}
+		}
+	}
+
+	nan, err := NewXORChunk([]Sample{{Timestamp: 1, Value: math.NaN()}, {Timestamp: 2, Value: 1}})
+	if err != nil {
+		t.Fatalf("NewXORChunk failed %s", err.Error())
+	}
+	if decoded, err := nan.Samples(); err != nil || !math.IsNaN(decoded[0].Value) || decoded[1].Value != 1 {
+		t.Errorf("expected the NaN sample, got %v %v", decoded, err)
+	}
+}
+
+func TestChunk_SamplesErrors(t *testing.T) {
+	chunk, err := NewXORChunk([]Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}, {Timestamp: 3000, Value: 3}})
+	if err != nil {
+		t.Fatalf("NewXORChunk failed %s", err.Error())
+	}
+
+	truncated := Chunk{Type: ChunkEncodingXOR, Data: chunk.Data[:len(chunk.Data)-2]}
+	if _, err := truncated.Samples(); err == nil {
+		t.Errorf("expected an error for the truncated chunk")
+	}
+
+	unknown := Chunk{Type: ChunkEncodingUnknown, Data: chunk.Data}
+	if _, err := unknown.Samples(); err == nil {
+		t.Errorf("expected an error for the unknown encoding")
+	}
+}
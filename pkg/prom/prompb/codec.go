@@ -0,0 +1,529 @@
+package prompb
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+//--------------------------------------------------------------------------
+//  Marshal
+//--------------------------------------------------------------------------
+
+// Marshal returns the protobuf encoding of the request
+func (m *ReadRequest) Marshal() ([]byte, error) {
+	return m.append(nil), nil
+}
+
+func (m *ReadRequest) append(b []byte) []byte {
+	for _, q := range m.Queries {
+		b = appendMessage(b, 1, q.append(nil))
+	}
+	if len(m.AcceptedResponseTypes) > 0 {
+		var packed []byte
+		for _, t := range m.AcceptedResponseTypes {
+			packed = protowire.AppendVarint(packed, uint64(t))
+		}
+		b = appendMessage(b, 2, packed)
+	}
+	return b
+}
+
+// Marshal returns the protobuf encoding of the response
+func (m *ReadResponse) Marshal() ([]byte, error) {
+	var b []byte
+	for _, r := range m.Results {
+		b = appendMessage(b, 1, r.append(nil))
+	}
+	return b, nil
+}
+
+func (m *Query) append(b []byte) []byte {
+	b = appendInt64(b, 1, m.StartTimestampMs)
+	b = appendInt64(b, 2, m.EndTimestampMs)
+	for _, matcher := range m.Matchers {
+		b = appendMessage(b, 3, matcher.append(nil))
+	}
+	if m.Hints != nil {
+		b = appendMessage(b, 4, m.Hints.append(nil))
+	}
+	return b
+}
+
+func (m *QueryResult) append(b []byte) []byte {
+	for _, ts := range m.Timeseries {
+		b = appendMessage(b, 1, ts.append(nil))
+	}
+	return b
+}
+
+// Marshal returns the protobuf encoding of the frame
+func (m *ChunkedReadResponse) Marshal() ([]byte, error) {
+	var b []byte
+	for _, s := range m.ChunkedSeries {
+		b = appendMessage(b, 1, s.append(nil))
+	}
+	b = appendInt64(b, 2, m.QueryIndex)
+	return b, nil
+}
+
+func (m *Sample) append(b []byte) []byte {
+	if m.Value != 0 {
+		b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(m.Value))
+	}
+	return appendInt64(b, 2, m.Timestamp)
+}
+
+func (m *TimeSeries) append(b []byte) []byte {
+	for i := range m.Labels {
+		b = appendMessage(b, 1, m.Labels[i].append(nil))
+	}
+	for i := range m.Samples {
+		b = appendMessage(b, 2, m.Samples[i].append(nil))
+	}
+	return b
+}
+
+func (m *Label) append(b []byte) []byte {
+	b = appendString(b, 1, m.Name)
+	return appendString(b, 2, m.Value)
+}
+
+func (m *LabelMatcher) append(b []byte) []byte {
+	b = appendInt64(b, 1, int64(m.Type))
+	b = appendString(b, 2, m.Name)
+	return appendString(b, 3, m.Value)
+}
+
+func (m *ReadHints) append(b []byte) []byte {
+	b = appendInt64(b, 1, m.StepMs)
+	b = appendString(b, 2, m.Func)
+	b = appendInt64(b, 3, m.StartMs)
+	b = appendInt64(b, 4, m.EndMs)
+	for _, g := range m.Grouping {
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendString(b, g)
+	}
+	if m.By {
+		b = appendInt64(b, 6, 1)
+	}
+	return appendInt64(b, 7, m.RangeMs)
+}
+
+func (m *Chunk) append(b []byte) []byte {
+	b = appendInt64(b, 1, m.MinTimeMs)
+	b = appendInt64(b, 2, m.MaxTimeMs)
+	b = appendInt64(b, 3, int64(m.Type))
+	if len(m.Data) > 0 {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Data)
+	}
+	return b
+}
+
+func (m *ChunkedSeries) append(b []byte) []byte {
+	for i := range m.Labels {
+		b = appendMessage(b, 1, m.Labels[i].append(nil))
+	}
+	for i := range m.Chunks {
+		b = appendMessage(b, 2, m.Chunks[i].append(nil))
+	}
+	return b
+}
+
+// appendMessage appends the encoded message or packed field
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// appendInt64 appends the varint, the zero value is omitted as in proto3
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// appendString appends the string, the empty value is omitted as in proto3
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+//--------------------------------------------------------------------------
+//  Unmarshal
+//--------------------------------------------------------------------------
+
+// Unmarshal decodes the protobuf encoding of the request into m
+func (m *ReadRequest) Unmarshal(b []byte) error {
+	*m = ReadRequest{}
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			v, n, err := consumeBytes(typ, b)
+			if err != nil {
+				return 0, err
+			}
+			q := &Query{}
+			if err := q.unmarshal(v); err != nil {
+				return 0, err
+			}
+			m.Queries = append(m.Queries, q)
+			return n, nil
+		case 2:
+			return consumeRepeatedVarint(typ, b, func(v uint64) {
+				m.AcceptedResponseTypes = append(m.AcceptedResponseTypes, ResponseType(v))
+			})
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// Unmarshal decodes the protobuf encoding of the response into m
+func (m *ReadResponse) Unmarshal(b []byte) error {
+	*m = ReadResponse{}
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 1 {
+			return skipField(num, typ, b)
+		}
+		v, n, err := consumeBytes(typ, b)
+		if err != nil {
+			return 0, err
+		}
+		r := &QueryResult{}
+		if err := r.unmarshal(v); err != nil {
+			return 0, err
+		}
+		m.Results = append(m.Results, r)
+		return n, nil
+	})
+}
+
+func (m *Query) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeInt64(typ, b, &m.StartTimestampMs)
+		case 2:
+			return consumeInt64(typ, b, &m.EndTimestampMs)
+		case 3:
+			v, n, err := consumeBytes(typ, b)
+			if err != nil {
+				return 0, err
+			}
+			matcher := &LabelMatcher{}
+			if err := matcher.unmarshal(v); err != nil {
+				return 0, err
+			}
+			m.Matchers = append(m.Matchers, matcher)
+			return n, nil
+		case 4:
+			v, n, err := consumeBytes(typ, b)
+			if err != nil {
+				return 0, err
+			}
+			m.Hints = &ReadHints{}
+			return n, m.Hints.unmarshal(v)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *QueryResult) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 1 {
+			return skipField(num, typ, b)
+		}
+		v, n, err := consumeBytes(typ, b)
+		if err != nil {
+			return 0, err
+		}
+		ts := &TimeSeries{}
+		if err := ts.unmarshal(v); err != nil {
+			return 0, err
+		}
+		m.Timeseries = append(m.Timeseries, ts)
+		return n, nil
+	})
+}
+
+// Unmarshal decodes the protobuf encoding of the frame into m
+func (m *ChunkedReadResponse) Unmarshal(b []byte) error {
+	*m = ChunkedReadResponse{}
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			v, n, err := consumeBytes(typ, b)
+			if err != nil {
+				return 0, err
+			}
+			s := &ChunkedSeries{}
+			if err := s.unmarshal(v); err != nil {
+				return 0, err
+			}
+			m.ChunkedSeries = append(m.ChunkedSeries, s)
+			return n, nil
+		case 2:
+			return consumeInt64(typ, b, &m.QueryIndex)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *Sample) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			if typ != protowire.Fixed64Type {
+				return 0, wireTypeErr(typ)
+			}
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			m.Value = math.Float64frombits(v)
+			return n, nil
+		case 2:
+			return consumeInt64(typ, b, &m.Timestamp)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *TimeSeries) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			v, n, err := consumeBytes(typ, b)
+			if err != nil {
+				return 0, err
+			}
+			var l Label
+			if err := l.unmarshal(v); err != nil {
+				return 0, err
+			}
+			m.Labels = append(m.Labels, l)
+			return n, nil
+		case 2:
+			v, n, err := consumeBytes(typ, b)
+			if err != nil {
+				return 0, err
+			}
+			var s Sample
+			if err := s.unmarshal(v); err != nil {
+				return 0, err
+			}
+			m.Samples = append(m.Samples, s)
+			return n, nil
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *Label) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.Name)
+		case 2:
+			return consumeString(typ, b, &m.Value)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *LabelMatcher) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			var v int64
+			n, err := consumeInt64(typ, b, &v)
+			m.Type = MatchType(v)
+			return n, err
+		case 2:
+			return consumeString(typ, b, &m.Name)
+		case 3:
+			return consumeString(typ, b, &m.Value)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *ReadHints) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeInt64(typ, b, &m.StepMs)
+		case 2:
+			return consumeString(typ, b, &m.Func)
+		case 3:
+			return consumeInt64(typ, b, &m.StartMs)
+		case 4:
+			return consumeInt64(typ, b, &m.EndMs)
+		case 5:
+			var g string
+			n, err := consumeString(typ, b, &g)
+			m.Grouping = append(m.Grouping, g)
+			return n, err
+		case 6:
+			var v int64
+			n, err := consumeInt64(typ, b, &v)
+			m.By = v != 0
+			return n, err
+		case 7:
+			return consumeInt64(typ, b, &m.RangeMs)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *Chunk) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeInt64(typ, b, &m.MinTimeMs)
+		case 2:
+			return consumeInt64(typ, b, &m.MaxTimeMs)
+		case 3:
+			var v int64
+			n, err := consumeInt64(typ, b, &v)
+			m.Type = ChunkEncoding(v)
+			return n, err
+		case 4:
+			v, n, err := consumeBytes(typ, b)
+			m.Data = v
+			return n, err
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *ChunkedSeries) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			v, n, err := consumeBytes(typ, b)
+			if err != nil {
+				return 0, err
+			}
+			var l Label
+			if err := l.unmarshal(v); err != nil {
+				return 0, err
+			}
+			m.Labels = append(m.Labels, l)
+			return n, nil
+		case 2:
+			v, n, err := consumeBytes(typ, b)
+			if err != nil {
+				return 0, err
+			}
+			var c Chunk
+			if err := c.unmarshal(v); err != nil {
+				return 0, err
+			}
+			m.Chunks = append(m.Chunks, c)
+			return n, nil
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// fieldFunc decodes the value of the field at the start of b, and returns its length
+type fieldFunc func(num protowire.Number, typ protowire.Type, b []byte) (int, error)
+
+// unmarshalFields calls field for each field of the message
+func unmarshalFields(b []byte, field fieldFunc) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// skipField skips the unknown field, e.g. the exemplars of a series
+func skipField(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+	n := protowire.ConsumeFieldValue(num, typ, b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	return n, nil
+}
+
+func consumeBytes(typ protowire.Type, b []byte) ([]byte, int, error) {
+	if typ != protowire.BytesType {
+		return nil, 0, wireTypeErr(typ)
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return nil, 0, protowire.ParseError(n)
+	}
+	return v, n, nil
+}
+
+func consumeString(typ protowire.Type, b []byte, s *string) (int, error) {
+	v, n, err := consumeBytes(typ, b)
+	if err != nil {
+		return 0, err
+	}
+	*s = string(v)
+	return n, nil
+}
+
+func consumeInt64(typ protowire.Type, b []byte, i *int64) (int, error) {
+	if typ != protowire.VarintType {
+		return 0, wireTypeErr(typ)
+	}
+	v, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*i = int64(v)
+	return n, nil
+}
+
+// consumeRepeatedVarint decodes the packed or unpacked repeated varint field
+func consumeRepeatedVarint(typ protowire.Type, b []byte, add func(v uint64)) (int, error) {
+	if typ == protowire.VarintType {
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		add(v)
+		return n, nil
+	}
+
+	packed, n, err := consumeBytes(typ, b)
+	if err != nil {
+		return 0, err
+	}
+	for len(packed) > 0 {
+		v, m := protowire.ConsumeVarint(packed)
+		if m < 0 {
+			return 0, protowire.ParseError(m)
+		}
+		add(v)
+		packed = packed[m:]
+	}
+	return n, nil
+}
+
+func wireTypeErr(typ protowire.Type) error {
+	return fmt.Errorf("prompb: unexpected wire type %d", typ)
+}
@@ -0,0 +1,94 @@
+package prompb
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestReadRequest_RoundTrip(t *testing.T) {
+	req := &ReadRequest{
+		Queries: []*Query{{
+			StartTimestampMs: 1600000000000,
+			EndTimestampMs:   1600003600000,
+			Matchers: []*LabelMatcher{
+				{Type: MatchEqual, Name: "__name__", Value: "container_cpu_usage_seconds_total"},
+				{Type: MatchNotRegexp, Name: "container", Value: "POD|"},
+			},
+			Hints: &ReadHints{StepMs: 60000, Func: "rate", Grouping: []string{"pod"}, By: true, RangeMs: 300000},
+		}},
+		AcceptedResponseTypes: []ResponseType{ResponseTypeStreamedXORChunks, ResponseTypeSamples},
+	}
+
+	b, err := req.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed %s", err.Error())
+	}
+
+	var decoded ReadRequest
+	if err := decoded.Unmarshal(b); err != nil || !reflect.DeepEqual(&decoded, req) {
+		t.Errorf("expected %+v, got %+v %v", req, decoded, err)
+	}
+
+	// the unpacked response types are accepted as well
+	unpacked := protowire.AppendTag(nil, 2, protowire.VarintType)
+	unpacked = protowire.AppendVarint(unpacked, uint64(ResponseTypeStreamedXORChunks))
+	if err := decoded.Unmarshal(unpacked); err != nil || !reflect.DeepEqual(decoded.AcceptedResponseTypes, []ResponseType{ResponseTypeStreamedXORChunks}) {
+		t.Errorf("expected the unpacked response type, got %v %v", decoded.AcceptedResponseTypes, err)
+	}
+}
+
+func TestReadResponse_RoundTrip(t *testing.T) {
+	resp := &ReadResponse{Results: []*QueryResult{
+		{Timeseries: []*TimeSeries{{
+			Labels:  []Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "kubelet"}},
+			Samples: []Sample{{Value: 1, Timestamp: 1600000000000}, {Value: 0, Timestamp: 1600000015000}},
+		}}},
+		{},
+	}}
+
+	b, err := resp.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed %s", err.Error())
+	}
+
+	// the unknown fields, e.g. the exemplars of newer servers, are skipped
+	b = protowire.AppendTag(b, 9, protowire.BytesType)
+	b = protowire.AppendString(b, "unknown")
+
+	var decoded ReadResponse
+	if err := decoded.Unmarshal(b); err != nil {
+		t.Fatalf("Unmarshal failed %s", err.Error())
+	}
+	// the empty result has no fields
+	resp.Results[1] = &QueryResult{}
+	if !reflect.DeepEqual(&decoded, resp) {
+		t.Errorf("expected %+v, got %+v", resp, decoded)
+	}
+
+	if err := decoded.Unmarshal(b[:len(b)-3]); err == nil {
+		t.Errorf("expected an error for the truncated response")
+	}
+}
+
+func TestChunkedReadResponse_RoundTrip(t *testing.T) {
+	chunk, err := NewXORChunk([]Sample{{Timestamp: 1600000000000, Value: 1}, {Timestamp: 1600000015000, Value: 2}})
+	if err != nil {
+		t.Fatalf("NewXORChunk failed %s", err.Error())
+	}
+	resp := &ChunkedReadResponse{
+		ChunkedSeries: []*ChunkedSeries{{Labels: []Label{{Name: "__name__", Value: "up"}}, Chunks: []Chunk{chunk}}},
+		QueryIndex:    1,
+	}
+
+	b, err := resp.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed %s", err.Error())
+	}
+
+	var decoded ChunkedReadResponse
+	if err := decoded.Unmarshal(b); err != nil || !reflect.DeepEqual(&decoded, resp) {
+		t.Errorf("expected %+v, got %+v %v", resp, decoded, err)
+	}
+}
@@ -0,0 +1,116 @@
+// Package prompb implements the protobuf messages of the prometheus remote read protocol, as defined
+// by the remote.proto and types.proto of prometheus, without the generated code of prometheus.
+package prompb
+
+// ResponseType is the type of the remote read response accepted by the client
+type ResponseType int32
+
+const (
+	// ResponseTypeSamples is a snappy compressed ReadResponse of raw samples
+	ResponseTypeSamples ResponseType = 0
+	// ResponseTypeStreamedXORChunks is a stream of ChunkedReadResponse frames of XOR chunks
+	ResponseTypeStreamedXORChunks ResponseType = 1
+)
+
+// MatchType is the operator of a LabelMatcher
+type MatchType int32
+
+const (
+	MatchEqual     MatchType = 0
+	MatchNotEqual  MatchType = 1
+	MatchRegexp    MatchType = 2
+	MatchNotRegexp MatchType = 3
+)
+
+// ChunkEncoding is the encoding of the data of a Chunk
+type ChunkEncoding int32
+
+const (
+	ChunkEncodingUnknown ChunkEncoding = 0
+	ChunkEncodingXOR     ChunkEncoding = 1
+)
+
+// ReadRequest is the request of the remote read endpoint
+type ReadRequest struct {
+	Queries []*Query
+	// AcceptedResponseTypes are the response types accepted by the client in order of preference,
+	// the servers without support of the streamed response reply with the samples
+	AcceptedResponseTypes []ResponseType
+}
+
+// ReadResponse is the sampled response, the results are in the order of the queries
+type ReadResponse struct {
+	Results []*QueryResult
+}
+
+// Query selects the series matched by all the matchers in [StartTimestampMs, EndTimestampMs]
+type Query struct {
+	StartTimestampMs int64
+	EndTimestampMs   int64
+	Matchers         []*LabelMatcher
+	Hints            *ReadHints
+}
+
+// QueryResult is the result of a query of the sampled response
+type QueryResult struct {
+	Timeseries []*TimeSeries
+}
+
+// ChunkedReadResponse is a frame of the streamed response, the series of a query may be split
+// across frames
+type ChunkedReadResponse struct {
+	ChunkedSeries []*ChunkedSeries
+	// QueryIndex is the index of the query of the series in the ReadRequest
+	QueryIndex int64
+}
+
+// Sample is a value at the timestamp in milliseconds
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// TimeSeries is a series of samples, the exemplars are not decoded
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// Label is a label of a series
+type Label struct {
+	Name  string
+	Value string
+}
+
+// LabelMatcher matches the value of a label
+type LabelMatcher struct {
+	Type  MatchType
+	Name  string
+	Value string
+}
+
+// ReadHints are the hints of the PromQL evaluation the data is read for, they can be ignored by
+// the server
+type ReadHints struct {
+	StepMs   int64
+	Func     string
+	StartMs  int64
+	EndMs    int64
+	Grouping []string
+	By       bool
+	RangeMs  int64
+}
+
+// Chunk is the encoded samples of a series in [MinTimeMs, MaxTimeMs]
+type Chunk struct {
+	MinTimeMs int64
+	MaxTimeMs int64
+	Type      ChunkEncoding
+	Data      []byte
+}
+
+// ChunkedSeries is a series of chunks
+type ChunkedSeries struct {
+	Labels []Label
+	Chunks []Chunk
+}
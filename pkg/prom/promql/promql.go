@@ -0,0 +1,425 @@
+package promql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/util/timeutil"
+)
+
+// Expr is a PromQL expression which can be rendered to the query string
+type Expr interface {
+	String() string
+}
+
+// Build validates the expression and renders it to the query string. The ranges of the range
+// selectors and subqueries must be whole seconds of at least 1s, as well as the subquery resolutions
+// other than 0, since they are rendered in seconds and a shorter one can't be expressed
+func Build(expr Expr) (string, error) {
+	if err := validate(expr); err != nil {
+		return "", err
+	}
+	return expr.String(), nil
+}
+
+// validate checks the ranges of the expression and its sub-expressions
+func validate(expr Expr) error {
+	switch e := expr.(type) {
+	case *MatrixSelector:
+		return validateRange("range", e.duration)
+	case *SubqueryExpr:
+		if err := validateRange("subquery range", e.duration); err != nil {
+			return err
+		}
+		if e.resolution != 0 {
+			if err := validateRange("subquery resolution", e.resolution); err != nil {
+				return err
+			}
+		}
+		return validate(e.expr)
+	case *FuncCall:
+		for _, arg := range e.args {
+			if err := validate(arg); err != nil {
+				return err
+			}
+		}
+	case *AggregateExpr:
+		if e.param != nil {
+			if err := validate(e.param); err != nil {
+				return err
+			}
+		}
+		return validate(e.expr)
+	case *BinaryExpr:
+		if err := validate(e.lhs); err != nil {
+			return err
+		}
+		return validate(e.rhs)
+	}
+	return nil
+}
+
+// validateRange returns error if the duration is not whole seconds of at least 1s
+func validateRange(kind string, duration time.Duration) error {
+	if duration < time.Second || duration%time.Second != 0 {
+		return fmt.Errorf("invalid %s %s, must be whole seconds of at least 1s", kind, duration)
+	}
+	return nil
+}
+
+//--------------------------------------------------------------------------
+//  LabelMatcher
+//--------------------------------------------------------------------------
+
+// MatchType is the operator of a label matcher
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// LabelMatcher matches the value of a label, the value is escaped when rendered, so it can
+// contain any character
+type LabelMatcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+}
+
+// Eq creates a label matcher selecting the label equal to value
+func Eq(name, value string) LabelMatcher {
+	return LabelMatcher{Name: name, Type: MatchEqual, Value: value}
+}
+
+// Neq creates a label matcher selecting the label not equal to value
+func Neq(name, value string) LabelMatcher {
+	return LabelMatcher{Name: name, Type: MatchNotEqual, Value: value}
+}
+
+// Re creates a label matcher selecting the label matching the regex
+func Re(name, regex string) LabelMatcher {
+	return LabelMatcher{Name: name, Type: MatchRegexp, Value: regex}
+}
+
+// Nre creates a label matcher selecting the label not matching the regex
+func Nre(name, regex string) LabelMatcher {
+	return LabelMatcher{Name: name, Type: MatchNotRegexp, Value: regex}
+}
+
+// String renders the matcher, e.g. pod="foo"
+func (m LabelMatcher) String() string {
+	return m.Name + string(m.Type) + QuoteString(m.Value)
+}
+
+// QuoteString quotes the string as a PromQL string literal, escaping the quotes, backslashes
+// and control characters
+func QuoteString(s string) string {
+	return strconv.Quote(s)
+}
+
+//--------------------------------------------------------------------------
+//  Selectors
+//--------------------------------------------------------------------------
+
+// VectorSelector selects the instant vector of a metric, e.g. metric{label="value"} offset 5m
+type VectorSelector struct {
+	metric   string
+	matchers []LabelMatcher
+	offset   time.Duration
+}
+
+// Vector creates a selector of the metric with the label matchers
+func Vector(metric string, matchers ...LabelMatcher) *VectorSelector {
+	return &VectorSelector{metric: metric, matchers: matchers}
+}
+
+// Where adds the label matchers to the selector
+func (vs *VectorSelector) Where(matchers ...LabelMatcher) *VectorSelector {
+	vs.matchers = append(vs.matchers, matchers...)
+	return vs
+}
+
+// Offset shifts the evaluation time of the selector to the past
+func (vs *VectorSelector) Offset(offset time.Duration) *VectorSelector {
+	vs.offset = offset
+	return vs
+}
+
+// Range creates a range vector selector of the given duration from the selector
+func (vs *VectorSelector) Range(duration time.Duration) *MatrixSelector {
+	return &MatrixSelector{vector: vs, duration: duration}
+}
+
+// String renders the selector
+func (vs *VectorSelector) String() string {
+	return vs.selectorString() + offsetString(vs.offset)
+}
+
+func (vs *VectorSelector) selectorString() string {
+	if len(vs.matchers) == 0 {
+		return vs.metric
+	}
+
+	matchers := make([]string, 0, len(vs.matchers))
+	for _, m := range vs.matchers {
+		matchers = append(matchers, m.String())
+	}
+	return vs.metric + "{" + strings.Join(matchers, ",") + "}"
+}
+
+// MatrixSelector selects the range vector of a metric, e.g. metric{label="value"}[5m] offset 5m
+type MatrixSelector struct {
+	vector   *VectorSelector
+	duration time.Duration
+}
+
+// String renders the selector, the offset of the vector selector is placed after the range
+func (ms *MatrixSelector) String() string {
+	return ms.vector.selectorString() + "[" + timeutil.DurationString(ms.duration) + "]" + offsetString(ms.vector.offset)
+}
+
+// SubqueryExpr evaluates the expression over a range, e.g. expr[5m:1m] offset 5m
+type SubqueryExpr struct {
+	expr       Expr
+	duration   time.Duration
+	resolution time.Duration
+	offset     time.Duration
+}
+
+// Subquery creates a subquery of the expression, the default resolution is used if resolution is 0
+func Subquery(expr Expr, duration, resolution time.Duration) *SubqueryExpr {
+	return &SubqueryExpr{expr: expr, duration: duration, resolution: resolution}
+}
+
+// Offset shifts the evaluation time of the subquery to the past
+func (sq *SubqueryExpr) Offset(offset time.Duration) *SubqueryExpr {
+	sq.offset = offset
+	return sq
+}
+
+// String renders the subquery, the resolution is left empty for the default one, e.g. expr[5m:]
+func (sq *SubqueryExpr) String() string {
+	resolution := ""
+	if sq.resolution != 0 {
+		resolution = timeutil.DurationString(sq.resolution)
+	}
+	return wrapOperand(sq.expr) + "[" + timeutil.DurationString(sq.duration) + ":" + resolution + "]" + offsetString(sq.offset)
+}
+
+//--------------------------------------------------------------------------
+//  Functions and Aggregations
+//--------------------------------------------------------------------------
+
+// FuncCall calls a function with the arguments, e.g. rate(metric[5m])
+type FuncCall struct {
+	name string
+	args []Expr
+}
+
+// Func creates a function call
+func Func(name string, args ...Expr) *FuncCall {
+	return &FuncCall{name: name, args: args}
+}
+
+// Rate creates a rate function call
+func Rate(expr Expr) *FuncCall {
+	return Func("rate", expr)
+}
+
+// String renders the function call
+func (fc *FuncCall) String() string {
+	args := make([]string, 0, len(fc.args))
+	for _, arg := range fc.args {
+		args = append(args, arg.String())
+	}
+	return fc.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// AggregateExpr aggregates the expression, e.g. sum(expr) by (label)
+type AggregateExpr struct {
+	op       string
+	expr     Expr
+	param    Expr
+	grouping []string
+	without  bool
+}
+
+// Aggregate creates an aggregation of the expression by the operator
+func Aggregate(op string, expr Expr) *AggregateExpr {
+	return &AggregateExpr{op: op, expr: expr}
+}
+
+// Sum creates a sum aggregation
+func Sum(expr Expr) *AggregateExpr {
+	return Aggregate("sum", expr)
+}
+
+// Avg creates an avg aggregation
+func Avg(expr Expr) *AggregateExpr {
+	return Aggregate("avg", expr)
+}
+
+// Max creates a max aggregation
+func Max(expr Expr) *AggregateExpr {
+	return Aggregate("max", expr)
+}
+
+// Param sets the parameter of the aggregation, such as the k of topk
+func (ae *AggregateExpr) Param(param Expr) *AggregateExpr {
+	ae.param = param
+	return ae
+}
+
+// By groups the aggregation by the labels
+func (ae *AggregateExpr) By(labels ...string) *AggregateExpr {
+	ae.grouping, ae.without = labels, false
+	return ae
+}
+
+// Without groups the aggregation by all the labels except the given ones
+func (ae *AggregateExpr) Without(labels ...string) *AggregateExpr {
+	ae.grouping, ae.without = labels, true
+	return ae
+}
+
+// String renders the aggregation
+func (ae *AggregateExpr) String() string {
+	var sb strings.Builder
+	sb.WriteString(ae.op)
+	sb.WriteString("(")
+	if ae.param != nil {
+		sb.WriteString(ae.param.String())
+		sb.WriteString(", ")
+	}
+	sb.WriteString(ae.expr.String())
+	sb.WriteString(")")
+
+	if ae.without {
+		sb.WriteString(" without (" + strings.Join(ae.grouping, ", ") + ")")
+	} else if len(ae.grouping) > 0 {
+		sb.WriteString(" by (" + strings.Join(ae.grouping, ", ") + ")")
+	}
+	return sb.String()
+}
+
+//--------------------------------------------------------------------------
+//  Binary Expressions and Literals
+//--------------------------------------------------------------------------
+
+// BinaryExpr applies the operator to both sides, e.g. a - on(label) b
+type BinaryExpr struct {
+	op       string
+	lhs, rhs Expr
+
+	matching   string
+	labels     []string
+	group      string
+	groupLabel []string
+}
+
+// Binary creates a binary expression of the operator
+func Binary(op string, lhs, rhs Expr) *BinaryExpr {
+	return &BinaryExpr{op: op, lhs: lhs, rhs: rhs}
+}
+
+// Add creates lhs + rhs
+func Add(lhs, rhs Expr) *BinaryExpr {
+	return Binary("+", lhs, rhs)
+}
+
+// Sub creates lhs - rhs
+func Sub(lhs, rhs Expr) *BinaryExpr {
+	return Binary("-", lhs, rhs)
+}
+
+// And creates lhs and rhs
+func And(lhs, rhs Expr) *BinaryExpr {
+	return Binary("and", lhs, rhs)
+}
+
+// On matches the vectors only by the labels
+func (be *BinaryExpr) On(labels ...string) *BinaryExpr {
+	be.matching, be.labels = "on", labels
+	return be
+}
+
+// Ignoring matches the vectors by all the labels except the given ones
+func (be *BinaryExpr) Ignoring(labels ...string) *BinaryExpr {
+	be.matching, be.labels = "ignoring", labels
+	return be
+}
+
+// GroupLeft allows many-to-one matching, copying the labels from the right side
+func (be *BinaryExpr) GroupLeft(labels ...string) *BinaryExpr {
+	be.group, be.groupLabel = "group_left", labels
+	return be
+}
+
+// GroupRight allows one-to-many matching, copying the labels from the left side
+func (be *BinaryExpr) GroupRight(labels ...string) *BinaryExpr {
+	be.group, be.groupLabel = "group_right", labels
+	return be
+}
+
+// String renders the binary expression, the operands which are binary expressions are wrapped
+// in parentheses so the precedence is kept
+func (be *BinaryExpr) String() string {
+	var sb strings.Builder
+	sb.WriteString(wrapOperand(be.lhs))
+	sb.WriteString(" " + be.op + " ")
+	if be.matching != "" {
+		sb.WriteString(be.matching + "(" + strings.Join(be.labels, ", ") + ") ")
+	}
+	if be.group != "" {
+		sb.WriteString(be.group + "(" + strings.Join(be.groupLabel, ", ") + ") ")
+	}
+	sb.WriteString(wrapOperand(be.rhs))
+	return sb.String()
+}
+
+// NumberLiteral is a float literal
+type NumberLiteral float64
+
+// Number creates a float literal
+func Number(v float64) NumberLiteral {
+	return NumberLiteral(v)
+}
+
+// String renders the literal
+func (n NumberLiteral) String() string {
+	return strconv.FormatFloat(float64(n), 'f', -1, 64)
+}
+
+// StringLiteral is a string literal, such as the arguments of label_replace
+type StringLiteral string
+
+// String creates a string literal, the value is escaped when rendered
+func String(s string) StringLiteral {
+	return StringLiteral(s)
+}
+
+// String renders the literal
+func (s StringLiteral) String() string {
+	return QuoteString(string(s))
+}
+
+// wrapOperand wraps the expression in parentheses if it is a binary expression
+func wrapOperand(expr Expr) string {
+	if _, ok := expr.(*BinaryExpr); ok {
+		return "(" + expr.String() + ")"
+	}
+	return expr.String()
+}
+
+// offsetString returns the offset modifier, or empty string if offset is not positive
+func offsetString(offset time.Duration) string {
+	if s := timeutil.DurationToPromOffsetString(offset); s != "" {
+		return " " + s
+	}
+	return ""
+}
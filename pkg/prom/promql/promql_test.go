@@ -0,0 +1,141 @@
+package promql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpr_String(t *testing.T) {
+	testCases := map[string]struct {
+		expr     Expr
+		expected string
+	}{
+		"vector selector": {
+			expr:     Vector("up"),
+			expected: `up`,
+		},
+		"label matchers": {
+			expr:     Vector("up", Eq("a", "1"), Neq("b", "2"), Re("c", "3|4"), Nre("d", "5.*")),
+			expected: `up{a="1",b!="2",c=~"3|4",d!~"5.*"}`,
+		},
+		"escaped label value": {
+			expr:     Vector("up", Eq("pod", `a"}or vector(1)#`), Eq("ns", `b\c`)),
+			expected: `up{pod="a\"}or vector(1)#",ns="b\\c"}`,
+		},
+		"escaped newline": {
+			expr:     Vector("up", Eq("pod", "a\nb")),
+			expected: `up{pod="a\nb"}`,
+		},
+		"offset": {
+			expr:     Vector("up", Eq("a", "1")).Offset(5 * time.Minute),
+			expected: `up{a="1"} offset 5m`,
+		},
+		"range with offset": {
+			expr:     Vector("up").Offset(time.Hour).Range(90 * time.Second),
+			expected: `up[90s] offset 1h`,
+		},
+		"subquery": {
+			expr:     Rate(Subquery(Vector("up"), 2*time.Minute, time.Minute)),
+			expected: `rate(up[2m:1m])`,
+		},
+		"subquery default resolution with offset": {
+			expr:     Subquery(Sub(Vector("a"), Vector("b")), time.Hour, 0).Offset(24 * time.Hour),
+			expected: `(a - b)[1h:] offset 1d`,
+		},
+		"aggregation by": {
+			expr:     Sum(Rate(Vector("up").Range(time.Minute))).By("namespace", "pod"),
+			expected: `sum(rate(up[1m])) by (namespace, pod)`,
+		},
+		"aggregation without": {
+			expr:     Max(Vector("up")).Without("instance"),
+			expected: `max(up) without (instance)`,
+		},
+		"aggregation param": {
+			expr:     Aggregate("topk", Vector("up")).Param(Number(5)),
+			expected: `topk(5, up)`,
+		},
+		"function call": {
+			expr:     Func("label_replace", Vector("up"), String("dst"), String("$1"), String("src"), String("(.*)")),
+			expected: `label_replace(up, "dst", "$1", "src", "(.*)")`,
+		},
+		"escaped string literal": {
+			expr:     Func("label_join", Vector("up"), String("dst"), String(`"\`), String("a")),
+			expected: `label_join(up, "dst", "\"\\", "a")`,
+		},
+		"binary": {
+			expr:     Sub(Number(1), Avg(Vector("up")).By("instance")),
+			expected: `1 - avg(up) by (instance)`,
+		},
+		"binary precedence": {
+			expr:     Binary("/", Sub(Vector("a"), Vector("b")), Vector("c")),
+			expected: `(a - b) / c`,
+		},
+		"binary matching": {
+			expr:     And(Vector("a"), Vector("b")).On("namespace", "pod"),
+			expected: `a and on(namespace, pod) b`,
+		},
+		"binary group left": {
+			expr:     Binary("*", Vector("a"), Vector("b")).Ignoring("job").GroupLeft("node"),
+			expected: `a * ignoring(job) group_left(node) b`,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if s := test.expr.String(); s != test.expected {
+				t.Fatalf("String: exp (%s); act (%s)", test.expected, s)
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	testCases := map[string]struct {
+		expr     Expr
+		expected string
+		hasErr   bool
+	}{
+		"valid": {
+			expr:     Sum(Rate(Subquery(Vector("up"), 5*time.Minute, 0))).By("pod"),
+			expected: `sum(rate(up[5m:])) by (pod)`,
+		},
+		"zero range": {
+			expr:   Rate(Vector("up").Range(0)),
+			hasErr: true,
+		},
+		"sub-second range": {
+			expr:   Rate(Vector("up").Range(500 * time.Millisecond)),
+			hasErr: true,
+		},
+		"fractional range": {
+			expr:   Sub(Number(1), Rate(Vector("up").Range(1500*time.Millisecond))),
+			hasErr: true,
+		},
+		"negative subquery range": {
+			expr:   Avg(Rate(Subquery(Vector("up"), -time.Minute, time.Minute))),
+			hasErr: true,
+		},
+		"sub-second subquery resolution": {
+			expr:   Rate(Subquery(Vector("up"), time.Minute, 100*time.Millisecond)),
+			hasErr: true,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			query, err := Build(test.expr)
+			if test.hasErr {
+				if err == nil {
+					t.Fatalf("Build: expected error, got (%s)", query)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build failed %s", err.Error())
+			}
+			if query != test.expected {
+				t.Fatalf("Build: exp (%s); act (%s)", test.expected, query)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package prom
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/open-resource-management/metricsclient/pkg/util/ratelimit"
+)
+
+const (
+	// adaptiveQPSDecrease is the factor applied to the rate on every throttled response
+	adaptiveQPSDecrease = 0.5
+	// adaptiveQPSIncrease is the fraction of the configured QPS recovered on every successful response
+	adaptiveQPSIncrease = 0.05
+)
+
+// QPSLimit configures the token bucket which limits the requests per second sent by a client,
+// independently of the concurrency limit of the RateLimitedPrometheusClient.
+type QPSLimit struct {
+	// QPS is the sustained requests per second, values <= 0 disable the limit
+	QPS float64
+	// Burst is the number of requests which can be sent at once
+	Burst int
+	// Adaptive halves the rate every time the server responds 429 or 503, down to MinQPS,
+	// and recovers it gradually to QPS on successful responses
+	Adaptive bool
+	MinQPS   float64
+}
+
+// qpsLimiter applies a QPSLimit to the requests of a client
+type qpsLimiter struct {
+	m      sync.Mutex
+	limit  QPSLimit
+	bucket *ratelimit.TokenBucket
+}
+
+// newQPSLimiter returns the limiter of the QPSLimit, nil if there's no limit
+func newQPSLimiter(limit *QPSLimit) *qpsLimiter {
+	if limit == nil || limit.QPS <= 0 {
+		return nil
+	}
+
+	l := *limit
+	if l.MinQPS <= 0 || l.MinQPS > l.QPS {
+		l.MinQPS = l.QPS * adaptiveQPSIncrease
+	}
+
+	return &qpsLimiter{
+		limit:  l,
+		bucket: ratelimit.NewTokenBucket(l.QPS, l.Burst),
+	}
+}
+
+// Wait blocks until the request can be sent or ctx is done
+func (ql *qpsLimiter) Wait(ctx context.Context) error {
+	if ql == nil {
+		return nil
+	}
+
+	return ql.bucket.Wait(ctx)
+}
+
+// Observe adapts the rate to the response of a request
+func (ql *qpsLimiter) Observe(resp *http.Response, err error) {
+	if ql == nil || !ql.limit.Adaptive || err != nil || resp == nil {
+		return
+	}
+
+	ql.m.Lock()
+	defer ql.m.Unlock()
+
+	rate := ql.bucket.Rate()
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		rate *= adaptiveQPSDecrease
+		if rate < ql.limit.MinQPS {
+			rate = ql.limit.MinQPS
+		}
+	case rate < ql.limit.QPS:
+		rate += ql.limit.QPS * adaptiveQPSIncrease
+		if rate > ql.limit.QPS {
+			rate = ql.limit.QPS
+		}
+	default:
+		return
+	}
+
+	ql.bucket.SetRate(rate)
+}
+
+// Rate returns the current rate of the limiter, 0 if there's no limit
+func (ql *qpsLimiter) Rate() float64 {
+	if ql == nil {
+		return 0
+	}
+
+	return ql.bucket.Rate()
+}
@@ -0,0 +1,78 @@
+package prom
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQPSLimiter_Adaptive(t *testing.T) {
+	if l := newQPSLimiter(&QPSLimit{QPS: 0}); l != nil {
+		t.Fatalf("expected no limiter for 0 qps")
+	}
+
+	l := newQPSLimiter(&QPSLimit{QPS: 100, Burst: 10, Adaptive: true, MinQPS: 20})
+
+	throttled := &http.Response{StatusCode: http.StatusTooManyRequests}
+	l.Observe(throttled, nil)
+	if r := l.Rate(); r != 50 {
+		t.Errorf("expected the rate halved to 50, got %f", r)
+	}
+	l.Observe(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil)
+	l.Observe(throttled, nil)
+	if r := l.Rate(); r != 20 {
+		t.Errorf("expected the rate capped to the min qps 20, got %f", r)
+	}
+
+	ok := &http.Response{StatusCode: http.StatusOK}
+	l.Observe(ok, nil)
+	if r := l.Rate(); r != 25 {
+		t.Errorf("expected the rate increased to 25, got %f", r)
+	}
+	for i := 0; i < 100; i++ {
+		l.Observe(ok, nil)
+	}
+	if r := l.Rate(); r != 100 {
+		t.Errorf("expected the rate recovered to 100, got %f", r)
+	}
+
+	fixed := newQPSLimiter(&QPSLimit{QPS: 100, Burst: 10})
+	fixed.Observe(throttled, nil)
+	if r := fixed.Rate(); r != 100 {
+		t.Errorf("expected the rate unchanged if not adaptive, got %f", r)
+	}
+}
+
+func TestQPSLimit_Client(t *testing.T) {
+	for _, rateLimit := range []bool{false, true} {
+		var count int32
+		server := newFlakyPromServer(0, http.StatusOK, &count)
+
+		client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 4, false, rateLimit, &ClientAuth{},
+			WithQPSLimit(&QPSLimit{QPS: 50, Burst: 1}))
+		if err != nil {
+			t.Fatalf("NewPrometheusClient failed %s", err.Error())
+		}
+		ctx := NewNamedContext(client, ClusterContextName)
+
+		start := time.Now()
+		var pending []QueryResultsChan
+		for i := 0; i < 6; i++ {
+			pending = append(pending, ctx.Query("up"))
+		}
+		for _, p := range pending {
+			p.Await()
+		}
+
+		// 1 burst request, then 5 requests at 50 qps
+		if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+			t.Errorf("rate limit %v: expected the requests limited to 50 qps, took %s", rateLimit, elapsed)
+		}
+		if n := atomic.LoadInt32(&count); n != 6 {
+			t.Errorf("rate limit %v: expected 6 requests, got %d", rateLimit, n)
+		}
+
+		server.Close()
+	}
+}
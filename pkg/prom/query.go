@@ -1,9 +1,10 @@
 package prom
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -26,6 +27,12 @@ type Context struct {
 	Client         prometheusapi.Client
 	name           string
 	errorCollector *QueryErrorCollector
+	// headers are set on every query of the context, e.g. the tenant
+	headers http.Header
+	// precision is the precision the timestamps of the results are rounded to, 0 for no rounding
+	precision time.Duration
+	// remoteRead is the configuration of the remote reads, the default one if nil
+	remoteRead *RemoteReadConfig
 }
 
 // NewContext creates a new Promethues querying context from the given client
@@ -36,6 +43,7 @@ func NewContext(client prometheusapi.Client) *Context {
 		Client:         client,
 		name:           "",
 		errorCollector: &ec,
+		precision:      DefaultTimestampPrecision,
 	}
 }
 
@@ -46,6 +54,56 @@ func NewNamedContext(client prometheusapi.Client, name string) *Context {
 	return ctx
 }
 
+// Clone returns a copy of the context, which sends the queries with the same client, name and
+// headers, and reports to the same error collector. The settings of the copy, e.g. the timestamp
+// precision, are changed independently.
+func (ctx *Context) Clone() *Context {
+	clone := *ctx
+	clone.headers = ctx.headers.Clone()
+	return &clone
+}
+
+// SetTenant sends the queries of the context to the tenants, overriding the tenant of the client.
+// Several tenants are queried together if the server supports it. It must not be called while
+// the context is querying.
+func (ctx *Context) SetTenant(tenants ...string) {
+	ctx.SetHeader(TenantHeader, TenantID(tenants...))
+}
+
+// SetHeader sets the header on the queries of the context, overriding the header of the client.
+// It must not be called while the context is querying.
+func (ctx *Context) SetHeader(key, value string) {
+	if ctx.headers == nil {
+		ctx.headers = http.Header{}
+	}
+	ctx.headers.Set(key, value)
+}
+
+// SetTimestampPrecision sets the precision the timestamps of the results are rounded to, the
+// DefaultTimestampPrecision by default. A precision <= 0 keeps the timestamps returned by
+// prometheus, including the sub-second ones. It must not be called while the context is querying.
+func (ctx *Context) SetTimestampPrecision(precision time.Duration) {
+	ctx.precision = precision
+}
+
+// TimestampPrecision returns the precision the timestamps of the results are rounded to
+func (ctx *Context) TimestampPrecision() time.Duration {
+	return ctx.precision
+}
+
+// Tenant returns the tenant of the queries made with reqCtx, the per-query tenant if set, otherwise
+// the tenant of the context, otherwise the tenant of the client if it sets headers.
+func (ctx *Context) Tenant(reqCtx context.Context) string {
+	if tenant := queryHeaders(reqCtx).Get(TenantHeader); tenant != "" {
+		return tenant
+	}
+	if tenant := ctx.headers.Get(TenantHeader); tenant != "" {
+		return tenant
+	}
+
+	return headersFor(ctx.Client).Get(TenantHeader)
+}
+
 // Warnings returns the warnings collected from the Context's ErrorCollector
 func (ctx *Context) Warnings() []*QueryWarning {
 	return ctx.errorCollector.Warnings()
@@ -81,9 +139,14 @@ func (ctx *Context) ErrorCollection() error {
 // results on the provided channel. Receiver is responsible for closing the
 // channel, preferably using the Read method.
 func (ctx *Context) Query(query string) QueryResultsChan {
+	return ctx.QueryWithContext(context.Background(), query)
+}
+
+// QueryWithContext is the same as Query, but the request is cancelled when reqCtx is done.
+func (ctx *Context) QueryWithContext(reqCtx context.Context, query string) QueryResultsChan {
 	resCh := make(QueryResultsChan)
 
-	go runQuery(query, ctx, resCh, "")
+	go runQuery(reqCtx, query, ctx, resCh, "")
 
 	return resCh
 }
@@ -94,7 +157,7 @@ func (ctx *Context) Query(query string) QueryResultsChan {
 func (ctx *Context) ProfileQuery(query string, profileLabel string) QueryResultsChan {
 	resCh := make(QueryResultsChan)
 
-	go runQuery(query, ctx, resCh, profileLabel)
+	go runQuery(context.Background(), query, ctx, resCh, profileLabel)
 
 	return resCh
 }
@@ -128,19 +191,35 @@ func (ctx *Context) ProfileQueryAll(queries ...string) []QueryResultsChan {
 }
 
 func (ctx *Context) QuerySync(query string) ([]*QueryResult, error) {
-	raw, err := ctx.query(query)
+	return ctx.QuerySyncWithContext(context.Background(), query)
+}
+
+// QuerySyncWithContext is the same as QuerySync, but the request is cancelled when reqCtx is done.
+func (ctx *Context) QuerySyncWithContext(reqCtx context.Context, query string) ([]*QueryResult, error) {
+	results, err := ctx.QueryResultsSync(reqCtx, query)
 	if err != nil {
 		return nil, err
 	}
 
-	results := NewQueryResults(query, raw)
-	if results.Error != nil {
-		return nil, results.Error
-	}
-
 	return results.Results, nil
 }
 
+// QueryResultsSync runs the query and returns the typed results, e.g. for the queries returning a
+// scalar or a string, see QueryResults.AsScalar and QueryResults.AsString.
+func (ctx *Context) QueryResultsSync(reqCtx context.Context, query string) (*QueryResults, error) {
+	results, tenant, err := ctx.query(reqCtx, query, nil)
+	return ctx.syncResults(tenant, results, err)
+}
+
+// QueryStream runs the query and passes each series of the result to the handler instead of
+// collecting them, see StreamQueryResults. The returned results hold the result type and warnings.
+// The response body is decoded while it is received if the client implements DoStream, otherwise
+// once read by the client. A failed read of the body may be returned after some series are handled.
+func (ctx *Context) QueryStream(reqCtx context.Context, query string, handler SeriesHandler) (*QueryResults, error) {
+	results, tenant, err := ctx.query(reqCtx, query, handler)
+	return ctx.syncResults(tenant, results, err)
+}
+
 // QueryURL returns the URL used to query Prometheus
 func (ctx *Context) QueryURL() *url.URL {
 	return ctx.Client.URL(ctxQuery, nil)
@@ -148,15 +227,12 @@ func (ctx *Context) QueryURL() *url.URL {
 
 // runQuery executes the prometheus query asynchronously, collects results and
 // errors, and passes them through the results channel.
-func runQuery(query string, ctx *Context, resCh QueryResultsChan, profileLabel string) {
+func runQuery(reqCtx context.Context, query string, ctx *Context, resCh QueryResultsChan, profileLabel string) {
 	//defer errors.HandlePanic()
 	//startQuery := time.Now()
 
-	raw, requestError := ctx.query(query)
-	results := NewQueryResults(query, raw)
-
-	// report all warnings, request, and parse errors (nils will be ignored)
-	ctx.errorCollector.Report(query, []string{}, requestError, results.Error)
+	results, tenant, requestError := ctx.query(reqCtx, query, nil)
+	ctx.reportResults(tenant, results, requestError)
 
 	if profileLabel != "" {
 		//log.Profile(startQuery, profileLabel)
@@ -167,63 +243,202 @@ func runQuery(query string, ctx *Context, resCh QueryResultsChan, profileLabel s
 
 // RawQuery is a direct query to the prometheus client and returns the body of the response
 func (ctx *Context) RawQuery(query string) ([]byte, error) {
-	u := ctx.Client.URL(ctxQuery, nil)
-	q := u.Query()
-	q.Set("query", query)
-	u.RawQuery = q.Encode()
+	return ctx.RawQueryWithContext(context.Background(), query)
+}
 
-	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+// RawQueryWithContext is the same as RawQuery, but the request is cancelled when reqCtx is done.
+func (ctx *Context) RawQueryWithContext(reqCtx context.Context, query string) ([]byte, error) {
+	_, resp, err := ctx.rawQuery(reqCtx, query)
 	if err != nil {
 		return nil, err
 	}
 
-	// Set QueryContext name if non empty
-	if ctx.name != "" {
-		req = httputil.SetName(req, ctx.name)
+	body, err := readBody(reqCtx, resp)
+	if err != nil {
+		return nil, queryRequestError(query, resp, err)
 	}
-	req = httputil.SetQuery(req, query)
 
-	// Note that the warnings return value from client.Do() is always nil using this
-	// version of the prometheus client library. We parse the warnings out of the response
-	// body after json decodidng completes.
-	resp, body, err := ctx.Client.Do(context.Background(), req)
-	if err != nil {
-		if resp == nil {
-			return nil, fmt.Errorf("query error: '%s' fetching query '%s'", err.Error(), query)
-		}
+	return body, nil
+}
 
-		return nil, fmt.Errorf("query error %d: '%s' fetching query '%s'", resp.StatusCode, err.Error(), query)
+// rawQuery sends the query, and returns the tenant it was sent to and the successful response before
+// its body is read. The caller must close the body of the response.
+func (ctx *Context) rawQuery(reqCtx context.Context, query string) (string, *http.Response, error) {
+	u := ctx.Client.URL(ctxQuery, nil)
+	q := u.Query()
+	q.Set("query", query)
+	u.RawQuery = q.Encode()
+
+	req, resp, err := ctx.doStream(reqCtx, http.MethodPost, u, nil, nil, query)
+	tenant := requestTenant(req)
+	if err != nil {
+		_, _ = readBody(reqCtx, resp)
+		return tenant, nil, queryRequestError(query, resp, err)
 	}
 
 	// Unsuccessful Status Code, log body and status
 	statusCode := resp.StatusCode
 	statusText := http.StatusText(statusCode)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, CommErrorf("%d (%s) URL: '%s', Request Headers: '%s', Headers: '%s', Body: '%s' Query: '%s'", statusCode, statusText, req.URL, req.Header, httputil.HeaderString(resp.Header), body, query)
+		body, _ := readBody(reqCtx, resp)
+		return tenant, nil, parseErrorBody(query, body, CommErrorf("%d (%s) URL: '%s', Request Headers: '%s', Headers: '%s', Body: '%s' Query: '%s'", statusCode, statusText, req.URL, req.Header, httputil.HeaderString(resp.Header), body, query))
+	}
+
+	return tenant, resp, nil
+}
+
+// queryRequestError returns the error of the request of the query, resp is nil if there is no response
+func queryRequestError(query string, resp *http.Response, err error) error {
+	if resp == nil {
+		return fmt.Errorf("query error: '%w' fetching query '%s'", err, query)
+	}
+
+	return fmt.Errorf("query error %d: '%w' fetching query '%s'", resp.StatusCode, err, query)
+}
+
+// do sends the request to the url with the method, retrying transient failures if the client has a
+// RetryPolicy. Every failed attempt which is retried is reported to the error collector as a warning.
+func (ctx *Context) do(reqCtx context.Context, method string, u *url.URL, query string) (*http.Request, *http.Response, []byte, error) {
+	req, resp, err := ctx.doStream(reqCtx, method, u, nil, nil, query)
+	data, readErr := readBody(reqCtx, resp)
+	if err == nil {
+		err = readErr
+	}
+
+	return req, resp, data, err
+}
+
+// doStream is the same as do, but the request has the body and header, which is overridden by the
+// context and per-query headers, and the response is returned before its body is read, see
+// streamClient. The caller must close the body of the response if there is one.
+func (ctx *Context) doStream(reqCtx context.Context, method string, u *url.URL, body []byte, header http.Header, query string) (*http.Request, *http.Response, error) {
+	policy := retryPolicyFor(ctx.Client)
+
+	for attempt := 1; ; attempt++ {
+		// the body is read by each attempt
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+
+		req, err := http.NewRequestWithContext(reqCtx, method, u.String(), reqBody)
+		if err != nil {
+			return nil, nil, err
+		}
+		setHeaders(req, header)
+
+		// Set QueryContext name if non empty
+		if ctx.name != "" {
+			req = httputil.SetName(req, ctx.name)
+		}
+		req = httputil.SetQuery(req, query)
+
+		// the per-query headers override the context ones, which override the client ones
+		setHeaders(req, ctx.headers)
+		setHeaders(req, queryHeaders(reqCtx))
+		// the client ones are set here, so the returned request holds the headers which are sent, e.g.
+		// the tenant reported to the error collector
+		setDefaultHeaders(req, headersFor(ctx.Client))
+
+		// The warnings are parsed out of the response body when it is decoded. The client is passed
+		// a copy of the request, as it may still modify it after reqCtx is done.
+		resp, err := doStream(ctx.Client, reqCtx, req.Clone(req.Context()))
+
+		delay, retry := policy.next(attempt, resp, err)
+		if !retry || reqCtx.Err() != nil {
+			return req, resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		var cause string
+		if err != nil {
+			cause = err.Error()
+		} else {
+			cause = fmt.Sprintf("%d (%s)", resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+		ctx.errorCollector.ReportTenant(req.Header.Get(TenantHeader), query, []string{fmt.Sprintf("attempt %d/%d failed: %s, retrying in %s", attempt, policy.MaxAttempts, cause, delay)}, nil, nil)
+
+		if err := sleepContext(reqCtx, delay); err != nil {
+			return req, nil, err
+		}
+	}
+}
+
+// query runs the query and decodes the response body, the tenant the query was sent to is returned
+// with the results. The results of a request error hold the request error, so it is returned by
+// QueryResultsChan.Await.
+func (ctx *Context) query(reqCtx context.Context, query string, handler SeriesHandler) (*QueryResults, string, error) {
+	tenant, resp, err := ctx.rawQuery(reqCtx, query)
+	if err == nil {
+		var results *QueryResults
+		if results, err = ctx.decodeResponse(reqCtx, query, resp, handler); err == nil {
+			return results, tenant, nil
+		}
+		err = queryRequestError(query, resp, err)
 	}
 
-	return body, err
+	return &QueryResults{Query: query, Error: err}, tenant, err
 }
 
-func (ctx *Context) query(query string) (interface{}, error) {
-	body, err := ctx.RawQuery(query)
+// decodeResponse decodes the response body while it is received and closes it, the series are passed
+// to the handler if not nil. The error of a failed read of the body is returned as a request error.
+func (ctx *Context) decodeResponse(reqCtx context.Context, query string, resp *http.Response, handler SeriesHandler) (*QueryResults, error) {
+	defer resp.Body.Close()
+
+	body := &errorReader{r: resp.Body}
+	var results *QueryResults
+	if handler != nil {
+		results = StreamQueryResults(query, body, ctx.precision, handler)
+	} else {
+		results = DecodeQueryResults(query, body, ctx.precision)
+	}
+
+	if body.err != nil {
+		if reqCtx.Err() != nil {
+			return nil, reqCtx.Err()
+		}
+		return nil, body.err
+	}
+
+	return results, nil
+}
+
+// reportResults reports all warnings, request, and parse errors (nils will be ignored) of the
+// asynchronous queries. The results of a request error hold the request error, which is reported once.
+func (ctx *Context) reportResults(tenant string, results *QueryResults, requestError error) {
+	if requestError != nil {
+		ctx.errorCollector.ReportTenant(tenant, results.Query, nil, requestError, nil)
+		return
+	}
+
+	ctx.errorCollector.ReportTenant(tenant, results.Query, results.Warnings, nil, results.Error)
+}
+
+// syncResults reports the warnings of the results, and returns the request or results error
+func (ctx *Context) syncResults(tenant string, results *QueryResults, err error) (*QueryResults, error) {
 	if err != nil {
 		return nil, err
 	}
 
-	var toReturn interface{}
-	err = json.Unmarshal(body, &toReturn)
-	if err != nil {
-		return nil, fmt.Errorf("Unmarshal Error: %s\nQuery: %s", err, query)
+	ctx.errorCollector.ReportTenant(tenant, results.Query, results.Warnings, nil, nil)
+	if results.Error != nil {
+		return nil, results.Error
 	}
 
-	return toReturn, nil
+	return results, nil
 }
 
 func (ctx *Context) QueryRange(query string, start, end time.Time, step time.Duration) QueryResultsChan {
+	return ctx.QueryRangeWithContext(context.Background(), query, start, end, step)
+}
+
+// QueryRangeWithContext is the same as QueryRange, but the request is cancelled when reqCtx is done.
+func (ctx *Context) QueryRangeWithContext(reqCtx context.Context, query string, start, end time.Time, step time.Duration) QueryResultsChan {
 	resCh := make(QueryResultsChan)
 
-	go runQueryRange(query, start, end, step, ctx, resCh, "")
+	go runQueryRange(reqCtx, query, start, end, step, ctx, resCh, "")
 
 	return resCh
 }
@@ -231,25 +446,34 @@ func (ctx *Context) QueryRange(query string, start, end time.Time, step time.Dur
 func (ctx *Context) ProfileQueryRange(query string, start, end time.Time, step time.Duration, profileLabel string) QueryResultsChan {
 	resCh := make(QueryResultsChan)
 
-	go runQueryRange(query, start, end, step, ctx, resCh, profileLabel)
+	go runQueryRange(context.Background(), query, start, end, step, ctx, resCh, profileLabel)
 
 	return resCh
 }
 
 func (ctx *Context) QueryRangeSync(query string, start, end time.Time, step time.Duration) ([]*QueryResult, error) {
-	raw, err := ctx.queryRange(query, start, end, step)
+	return ctx.QueryRangeSyncWithContext(context.Background(), query, start, end, step)
+}
+
+// QueryRangeSyncWithContext is the same as QueryRangeSync, but the request is cancelled when reqCtx is done.
+func (ctx *Context) QueryRangeSyncWithContext(reqCtx context.Context, query string, start, end time.Time, step time.Duration) ([]*QueryResult, error) {
+	results, tenant, err := ctx.queryRange(reqCtx, query, start, end, step, nil)
+	results, err = ctx.syncResults(tenant, results, err)
 	if err != nil {
 		return nil, err
 	}
 
-	results := NewQueryResults(query, raw)
-	if results.Error != nil {
-		return nil, results.Error
-	}
-
 	return results.Results, nil
 }
 
+// QueryRangeStream runs the range query and passes each series of the result to the handler instead
+// of collecting them, see StreamQueryResults. The returned results hold the result type and warnings.
+// The response body is decoded as for QueryStream.
+func (ctx *Context) QueryRangeStream(reqCtx context.Context, query string, start, end time.Time, step time.Duration, handler SeriesHandler) (*QueryResults, error) {
+	results, tenant, err := ctx.queryRange(reqCtx, query, start, end, step, handler)
+	return ctx.syncResults(tenant, results, err)
+}
+
 // QueryRangeURL returns the URL used to query_range Prometheus
 func (ctx *Context) QueryRangeURL() *url.URL {
 	return ctx.Client.URL(ctxQueryRange, nil)
@@ -257,15 +481,12 @@ func (ctx *Context) QueryRangeURL() *url.URL {
 
 // runQueryRange executes the prometheus queryRange asynchronously, collects results and
 // errors, and passes them through the results channel.
-func runQueryRange(query string, start, end time.Time, step time.Duration, ctx *Context, resCh QueryResultsChan, profileLabel string) {
+func runQueryRange(reqCtx context.Context, query string, start, end time.Time, step time.Duration, ctx *Context, resCh QueryResultsChan, profileLabel string) {
 	//defer errors.HandlePanic()
 	//startQuery := time.Now()
 
-	raw, requestError := ctx.queryRange(query, start, end, step)
-	results := NewQueryResults(query, raw)
-
-	// report all warnings, request, and parse errors (nils will be ignored)
-	ctx.errorCollector.Report(query, []string{}, requestError, results.Error)
+	results, tenant, requestError := ctx.queryRange(reqCtx, query, start, end, step, nil)
+	ctx.reportResults(tenant, results, requestError)
 
 	if profileLabel != "" {
 		//log.Profile(startQuery, profileLabel)
@@ -274,8 +495,29 @@ func runQueryRange(query string, start, end time.Time, step time.Duration, ctx *
 	resCh <- results
 }
 
-// RawQuery is a direct query to the prometheus client and returns the body of the response
+// RawQueryRange is a direct query_range to the prometheus client and returns the body of the response
 func (ctx *Context) RawQueryRange(query string, start, end time.Time, step time.Duration) ([]byte, error) {
+	return ctx.RawQueryRangeWithContext(context.Background(), query, start, end, step)
+}
+
+// RawQueryRangeWithContext is the same as RawQueryRange, but the request is cancelled when reqCtx is done.
+func (ctx *Context) RawQueryRangeWithContext(reqCtx context.Context, query string, start, end time.Time, step time.Duration) ([]byte, error) {
+	_, resp, err := ctx.rawQueryRange(reqCtx, query, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := readBody(reqCtx, resp)
+	if err != nil {
+		return nil, queryRangeRequestError(query, resp, body, err)
+	}
+
+	return body, nil
+}
+
+// rawQueryRange sends the range query, and returns the tenant it was sent to and the successful
+// response before its body is read. The caller must close the body of the response.
+func (ctx *Context) rawQueryRange(reqCtx context.Context, query string, start, end time.Time, step time.Duration) (string, *http.Response, error) {
 	u := ctx.Client.URL(ctxQueryRange, nil)
 	q := u.Query()
 	q.Set("query", query)
@@ -284,50 +526,46 @@ func (ctx *Context) RawQueryRange(query string, start, end time.Time, step time.
 	q.Set("step", strconv.FormatFloat(step.Seconds(), 'f', 3, 64))
 	u.RawQuery = q.Encode()
 
-	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	req, resp, err := ctx.doStream(reqCtx, http.MethodPost, u, nil, nil, query)
+	tenant := requestTenant(req)
 	if err != nil {
-		return nil, err
-	}
-
-	// Set QueryContext name if non empty
-	if ctx.name != "" {
-		req = httputil.SetName(req, ctx.name)
-	}
-	req = httputil.SetQuery(req, query)
-
-	// Note that the warnings return value from client.Do() is always nil using this
-	// version of the prometheus client library. We parse the warnings out of the response
-	// body after json decodidng completes.
-	resp, body, err := ctx.Client.Do(context.Background(), req)
-	if err != nil {
-		if resp == nil {
-			return nil, fmt.Errorf("Error: %s, Body: %s Query: %s", err.Error(), body, query)
-		}
-
-		return nil, fmt.Errorf("%d (%s) Headers: %s Error: %s Body: %s Query: %s", resp.StatusCode, http.StatusText(resp.StatusCode), httputil.HeaderString(resp.Header), body, err.Error(), query)
+		body, _ := readBody(reqCtx, resp)
+		return tenant, nil, queryRangeRequestError(query, resp, body, err)
 	}
 
 	// Unsuccessful Status Code, log body and status
 	statusCode := resp.StatusCode
 	statusText := http.StatusText(statusCode)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, CommErrorf("%d (%s) Headers: %s, Body: %s Query: %s", statusCode, statusText, httputil.HeaderString(resp.Header), body, query)
+		body, _ := readBody(reqCtx, resp)
+		return tenant, nil, parseErrorBody(query, body, CommErrorf("%d (%s) Headers: %s, Body: %s Query: %s", statusCode, statusText, httputil.HeaderString(resp.Header), body, query))
 	}
 
-	return body, err
+	return tenant, resp, nil
 }
 
-func (ctx *Context) queryRange(query string, start, end time.Time, step time.Duration) (interface{}, error) {
-	body, err := ctx.RawQueryRange(query, start, end, step)
-	if err != nil {
-		return nil, err
+// queryRangeRequestError returns the error of the request of the range query with the body read, resp
+// is nil if there is no response
+func queryRangeRequestError(query string, resp *http.Response, body []byte, err error) error {
+	if resp == nil {
+		return fmt.Errorf("Error: %w, Body: %s Query: %s", err, body, query)
 	}
 
-	var toReturn interface{}
-	err = json.Unmarshal(body, &toReturn)
-	if err != nil {
-		return nil, fmt.Errorf("Unmarshal Error: %s\nQuery: %s", err, query)
+	return fmt.Errorf("%d (%s) Headers: %s Error: %w Body: %s Query: %s", resp.StatusCode, http.StatusText(resp.StatusCode), httputil.HeaderString(resp.Header), err, body, query)
+}
+
+// queryRange runs the range query and decodes the response body, the tenant the query was sent to
+// is returned with the results. The results of a request error
+// hold the request error, so it is returned by QueryResultsChan.Await.
+func (ctx *Context) queryRange(reqCtx context.Context, query string, start, end time.Time, step time.Duration, handler SeriesHandler) (*QueryResults, string, error) {
+	tenant, resp, err := ctx.rawQueryRange(reqCtx, query, start, end, step)
+	if err == nil {
+		var results *QueryResults
+		if results, err = ctx.decodeResponse(reqCtx, query, resp, handler); err == nil {
+			return results, tenant, nil
+		}
+		err = queryRangeRequestError(query, resp, nil, err)
 	}
 
-	return toReturn, nil
+	return &QueryResults{Query: query, Error: err}, tenant, err
 }
@@ -0,0 +1,322 @@
+package prom
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/prom/prompb"
+	"github.com/open-resource-management/metricsclient/pkg/util"
+	"github.com/open-resource-management/metricsclient/pkg/util/httputil"
+
+	"github.com/golang/snappy"
+)
+
+const (
+	ctxRemoteRead = apiPrefix + "/read"
+
+	// RemoteReadVersion is the version of the remote read protocol sent in the request header
+	RemoteReadVersion = "0.1.0"
+
+	// DefaultRemoteReadMaxFrameSize is the maximum size of a frame of the streamed responses
+	DefaultRemoteReadMaxFrameSize = 50 * 1024 * 1024
+
+	// streamedMediaType is the media type of the streamed responses of ChunkedReadResponse frames
+	streamedMediaType = "application/x-streamed-protobuf"
+)
+
+// castagnoliTable is the table of the checksums of the frames of the streamed responses
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// RemoteReadConfig is the configuration of the remote reads of a Context
+type RemoteReadConfig struct {
+	// Path is the path of the remote read endpoint
+	Path string
+	// ResponseTypes are the response types accepted in order of preference, the servers which do
+	// not support the streamed XOR chunks reply with the samples
+	ResponseTypes []prompb.ResponseType
+	// MaxFrameSize is the maximum size in bytes of a frame of the streamed responses, the
+	// DefaultRemoteReadMaxFrameSize if <= 0
+	MaxFrameSize int
+}
+
+// DefaultRemoteReadConfig returns the RemoteReadConfig which prefers the streamed XOR chunks
+func DefaultRemoteReadConfig() *RemoteReadConfig {
+	return &RemoteReadConfig{
+		Path:          ctxRemoteRead,
+		ResponseTypes: []prompb.ResponseType{prompb.ResponseTypeStreamedXORChunks, prompb.ResponseTypeSamples},
+		MaxFrameSize:  DefaultRemoteReadMaxFrameSize,
+	}
+}
+
+// SetRemoteReadConfig sets the configuration of the remote reads, the DefaultRemoteReadConfig by
+// default. It must not be called while the context is reading.
+func (ctx *Context) SetRemoteReadConfig(config *RemoteReadConfig) {
+	ctx.remoteRead = config
+}
+
+// NewRemoteReadQuery returns the query of the raw samples of the series matched by all the
+// matchers in [start, end]
+func NewRemoteReadQuery(start, end time.Time, matchers ...*prompb.LabelMatcher) *prompb.Query {
+	return &prompb.Query{
+		StartTimestampMs: timestampMs(start),
+		EndTimestampMs:   timestampMs(end),
+		Matchers:         matchers,
+	}
+}
+
+// RemoteRead reads the raw samples of the queries from the remote read endpoint, without the
+// evaluation of PromQL by the server. The results are in the order of the queries, and their
+// timestamps are rounded to the precision of the context as for the queries. The streamed
+// responses are decoded frame by frame while they are received.
+func (ctx *Context) RemoteRead(reqCtx context.Context, queries ...*prompb.Query) ([][]*QueryResult, error) {
+	config := ctx.remoteRead
+	if config == nil {
+		config = DefaultRemoteReadConfig()
+	}
+
+	query := remoteReadQuery(queries)
+	data, err := (&prompb.ReadRequest{Queries: queries, AcceptedResponseTypes: config.ResponseTypes}).Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("Marshal Error: %s\nQuery: %s", err, query)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Encoding", "snappy")
+	header.Set("Content-Type", "application/x-protobuf")
+	header.Set("X-Prometheus-Remote-Read-Version", RemoteReadVersion)
+
+	u := ctx.Client.URL(config.Path, nil)
+	req, resp, err := ctx.doStream(reqCtx, http.MethodPost, u, snappy.Encode(nil, data), header, query)
+	if err != nil {
+		_, _ = readBody(reqCtx, resp)
+		return nil, queryRequestError(query, resp, err)
+	}
+	defer resp.Body.Close()
+
+	// Unsuccessful Status Code, log body and status
+	statusCode := resp.StatusCode
+	statusText := http.StatusText(statusCode)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := readBody(reqCtx, resp)
+		return nil, CommErrorf("%d (%s) URL: '%s', Request Headers: '%s', Headers: '%s', Body: '%s' Query: '%s'", statusCode, statusText, req.URL, req.Header, httputil.HeaderString(resp.Header), body, query)
+	}
+
+	maxFrameSize := config.MaxFrameSize
+	if maxFrameSize <= 0 {
+		maxFrameSize = DefaultRemoteReadMaxFrameSize
+	}
+	d := &remoteReadDecoder{
+		query:        query,
+		queries:      queries,
+		precision:    ctx.precision,
+		maxFrameSize: maxFrameSize,
+		results:      make([][]*QueryResult, len(queries)),
+		last:         make([]string, len(queries)),
+	}
+
+	body := &errorReader{r: resp.Body}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), streamedMediaType) {
+		err = d.decodeChunked(bufio.NewReader(body))
+	} else {
+		var data []byte
+		if data, err = readBody(reqCtx, resp); err != nil {
+			return nil, queryRequestError(query, resp, err)
+		}
+		err = d.decodeSamples(data)
+	}
+	if body.err != nil {
+		if reqCtx.Err() != nil {
+			return nil, queryRequestError(query, resp, reqCtx.Err())
+		}
+		return nil, queryRequestError(query, resp, body.err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return d.results, nil
+}
+
+// remoteReadDecoder decodes the sampled and streamed responses into the results of the queries
+type remoteReadDecoder struct {
+	query        string
+	queries      []*prompb.Query
+	precision    time.Duration
+	maxFrameSize int
+
+	results [][]*QueryResult
+	// last is the labels of the last series of each query, the series split across frames are merged
+	last []string
+}
+
+// decodeSamples decodes the snappy compressed ReadResponse
+func (d *remoteReadDecoder) decodeSamples(body []byte) error {
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return fmt.Errorf("Snappy Error: %s\nQuery: %s", err, d.query)
+	}
+
+	var resp prompb.ReadResponse
+	if err := resp.Unmarshal(data); err != nil {
+		return fmt.Errorf("Unmarshal Error: %s\nQuery: %s", err, d.query)
+	}
+	if len(resp.Results) != len(d.queries) {
+		return fmt.Errorf("Unexpected %d results of %d queries from Prometheus fetching query '%s'", len(resp.Results), len(d.queries), d.query)
+	}
+
+	for i, result := range resp.Results {
+		for _, ts := range result.Timeseries {
+			d.add(i, ts.Labels, ts.Samples)
+		}
+	}
+
+	return nil
+}
+
+// decodeChunked decodes the frames of the streamed response, each frame is the uvarint size and the
+// big endian CRC32 Castagnoli checksum of the ChunkedReadResponse which follows. The size is checked
+// against the limit before the frame is allocated.
+func (d *remoteReadDecoder) decodeChunked(r *bufio.Reader) error {
+	var header [4]byte
+	for {
+		size, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Frame Error: invalid frame size\nQuery: %s", d.query)
+		}
+		if size > uint64(d.maxFrameSize) {
+			return fmt.Errorf("Frame Error: frame of %d bytes exceeds the limit of %d bytes\nQuery: %s", size, d.maxFrameSize, d.query)
+		}
+
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return fmt.Errorf("Frame Error: truncated frame of %d bytes\nQuery: %s", size, d.query)
+		}
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return fmt.Errorf("Frame Error: truncated frame of %d bytes\nQuery: %s", size, d.query)
+		}
+
+		checksum := binary.BigEndian.Uint32(header[:])
+		if crc32.Checksum(frame, castagnoliTable) != checksum {
+			return fmt.Errorf("Frame Error: checksum mismatch\nQuery: %s", d.query)
+		}
+
+		var resp prompb.ChunkedReadResponse
+		if err := resp.Unmarshal(frame); err != nil {
+			return fmt.Errorf("Unmarshal Error: %s\nQuery: %s", err, d.query)
+		}
+		if resp.QueryIndex < 0 || resp.QueryIndex >= int64(len(d.queries)) {
+			return fmt.Errorf("Frame Error: query index %d of %d queries\nQuery: %s", resp.QueryIndex, len(d.queries), d.query)
+		}
+
+		// the chunks are not cut at the range of the query, so the samples outside are dropped
+		q := d.queries[resp.QueryIndex]
+		for _, series := range resp.ChunkedSeries {
+			var samples []prompb.Sample
+			for i := range series.Chunks {
+				chunkSamples, err := series.Chunks[i].Samples()
+				if err != nil {
+					return fmt.Errorf("Chunk Error: %s\nQuery: %s", err, d.query)
+				}
+				for _, s := range chunkSamples {
+					if s.Timestamp >= q.StartTimestampMs && s.Timestamp <= q.EndTimestampMs {
+						samples = append(samples, s)
+					}
+				}
+			}
+			d.add(int(resp.QueryIndex), series.Labels, samples)
+		}
+	}
+}
+
+// add adds the samples of the series to the results of the query, the samples are appended to the
+// last series of the query if it has the same labels
+func (d *remoteReadDecoder) add(index int, labels []prompb.Label, samples []prompb.Sample) {
+	var sb strings.Builder
+	for _, l := range labels {
+		sb.WriteString(l.Name)
+		sb.WriteByte(0xff)
+		sb.WriteString(l.Value)
+		sb.WriteByte(0xff)
+	}
+	key := sb.String()
+
+	results := d.results[index]
+	var result *QueryResult
+	if len(results) > 0 && d.last[index] == key {
+		result = results[len(results)-1]
+	} else {
+		metric := make(map[string]interface{}, len(labels))
+		for _, l := range labels {
+			metric[l.Name] = l.Value
+		}
+		result = &QueryResult{Metric: metric}
+		d.results[index] = append(results, result)
+		d.last[index] = key
+	}
+
+	if len(samples) == 0 {
+		return
+	}
+
+	// the vectors of the samples share a single allocation
+	backing := make([]util.Vector, len(samples))
+	for i, s := range samples {
+		backing[i] = util.Vector{
+			Timestamp: util.RoundTimestamp(float64(s.Timestamp)/1000, d.precision.Seconds()),
+			Value:     s.Value,
+		}
+		result.Values = append(result.Values, &backing[i])
+	}
+}
+
+// remoteReadQuery returns the description of the queries in the errors, e.g.
+// {__name__="up"}[1600000000000,1600003600000]
+func remoteReadQuery(queries []*prompb.Query) string {
+	var sb strings.Builder
+	for i, q := range queries {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteByte('{')
+		for j, m := range q.Matchers {
+			if j > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(m.Name)
+			sb.WriteString(matchTypeOperator(m.Type))
+			sb.WriteString(strconv.Quote(m.Value))
+		}
+		fmt.Fprintf(&sb, "}[%d,%d]", q.StartTimestampMs, q.EndTimestampMs)
+	}
+
+	return sb.String()
+}
+
+func matchTypeOperator(t prompb.MatchType) string {
+	switch t {
+	case prompb.MatchNotEqual:
+		return "!="
+	case prompb.MatchRegexp:
+		return "=~"
+	case prompb.MatchNotRegexp:
+		return "!~"
+	}
+
+	return "="
+}
+
+// timestampMs returns the unix timestamp in milliseconds of the time
+func timestampMs(t time.Time) int64 {
+	return t.Unix()*1000 + int64(t.Nanosecond())/int64(time.Millisecond)
+}
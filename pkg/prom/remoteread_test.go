@@ -0,0 +1,232 @@
+package prom
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"flag"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/prom/prompb"
+
+	"github.com/golang/snappy"
+)
+
+var updateFixtures = flag.Bool("update", false, "update the remote read fixtures in testdata")
+
+const (
+	samplesFixture = "testdata/remote_read_samples.pb"
+	chunksFixture  = "testdata/remote_read_chunks.pb"
+)
+
+var (
+	remoteReadStart = time.Unix(1600000000, 0)
+	remoteReadEnd   = time.Unix(1600000060, 0)
+)
+
+// remoteReadQueries are the queries of the fixtures
+func remoteReadQueries() []*prompb.Query {
+	return []*prompb.Query{
+		NewRemoteReadQuery(remoteReadStart, remoteReadEnd,
+			&prompb.LabelMatcher{Type: prompb.MatchEqual, Name: "__name__", Value: "container_cpu_usage_seconds_total"},
+			&prompb.LabelMatcher{Type: prompb.MatchEqual, Name: "pod", Value: "pod-0"}),
+		NewRemoteReadQuery(remoteReadStart, remoteReadEnd,
+			&prompb.LabelMatcher{Type: prompb.MatchEqual, Name: "__name__", Value: "container_memory_working_set_bytes"},
+			&prompb.LabelMatcher{Type: prompb.MatchEqual, Name: "pod", Value: "pod-0"}),
+	}
+}
+
+// writeRemoteReadFixtures writes the sampled response and the streamed response of the queries, the
+// cpu series of the streamed response is split across two frames, and its first chunk starts
+// before the range of the query
+func writeRemoteReadFixtures(t *testing.T) {
+	cpuLabels := []prompb.Label{{Name: "__name__", Value: "container_cpu_usage_seconds_total"}, {Name: "pod", Value: "pod-0"}}
+	memoryLabels := []prompb.Label{{Name: "__name__", Value: "container_memory_working_set_bytes"}, {Name: "pod", Value: "pod-0"}}
+	cpu := []prompb.Sample{{Timestamp: 1600000000000, Value: 10}, {Timestamp: 1600000015250, Value: 10.5}, {Timestamp: 1600000030000, Value: 11.25}}
+	memory := []prompb.Sample{{Timestamp: 1600000000000, Value: 2048}, {Timestamp: 1600000030000, Value: 4096}}
+
+	samples, err := (&prompb.ReadResponse{Results: []*prompb.QueryResult{
+		{Timeseries: []*prompb.TimeSeries{{Labels: cpuLabels, Samples: cpu}}},
+		{Timeseries: []*prompb.TimeSeries{{Labels: memoryLabels, Samples: memory}}},
+	}}).Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed %s", err.Error())
+	}
+
+	chunk := func(samples ...prompb.Sample) prompb.Chunk {
+		c, err := prompb.NewXORChunk(samples)
+		if err != nil {
+			t.Fatalf("NewXORChunk failed %s", err.Error())
+		}
+		return c
+	}
+	frames := []*prompb.ChunkedReadResponse{
+		{ChunkedSeries: []*prompb.ChunkedSeries{{Labels: cpuLabels, Chunks: []prompb.Chunk{chunk(prompb.Sample{Timestamp: 1599999985000, Value: 9}, cpu[0], cpu[1])}}}},
+		{ChunkedSeries: []*prompb.ChunkedSeries{{Labels: cpuLabels, Chunks: []prompb.Chunk{chunk(cpu[2])}}}},
+		{ChunkedSeries: []*prompb.ChunkedSeries{{Labels: memoryLabels, Chunks: []prompb.Chunk{chunk(memory...)}}}, QueryIndex: 1},
+	}
+
+	var chunks bytes.Buffer
+	for _, frame := range frames {
+		b, err := frame.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal failed %s", err.Error())
+		}
+
+		var header [binary.MaxVarintLen64 + 4]byte
+		n := binary.PutUvarint(header[:], uint64(len(b)))
+		binary.BigEndian.PutUint32(header[n:], crc32.Checksum(b, castagnoliTable))
+		chunks.Write(header[:n+4])
+		chunks.Write(b)
+	}
+
+	if err := ioutil.WriteFile(filepath.FromSlash(samplesFixture), snappy.Encode(nil, samples), 0644); err != nil {
+		t.Fatalf("WriteFile failed %s", err.Error())
+	}
+	if err := ioutil.WriteFile(filepath.FromSlash(chunksFixture), chunks.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile failed %s", err.Error())
+	}
+}
+
+// newRemoteReadServer serves the streamed fixture if the request accepts it first, and the sampled
+// fixture otherwise
+func newRemoteReadServer(t *testing.T) *httptest.Server {
+	samples, err := ioutil.ReadFile(filepath.FromSlash(samplesFixture))
+	if err != nil {
+		t.Fatalf("ReadFile failed %s", err.Error())
+	}
+	chunks, err := ioutil.ReadFile(filepath.FromSlash(chunksFixture))
+	if err != nil {
+		t.Fatalf("ReadFile failed %s", err.Error())
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/read" || r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("X-Prometheus-Remote-Read-Version") == "" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+
+		compressed, _ := ioutil.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("snappy Decode failed %s", err.Error())
+		}
+		var req prompb.ReadRequest
+		if err := req.Unmarshal(data); err != nil {
+			t.Errorf("Unmarshal failed %s", err.Error())
+		}
+		if !reflect.DeepEqual(req.Queries, remoteReadQueries()) {
+			t.Errorf("unexpected queries %v", req.Queries)
+		}
+
+		if len(req.AcceptedResponseTypes) > 0 && req.AcceptedResponseTypes[0] == prompb.ResponseTypeStreamedXORChunks {
+			w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+			_, _ = w.Write(chunks)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Header().Set("Content-Encoding", "snappy")
+		_, _ = w.Write(samples)
+	}))
+}
+
+func TestRemoteRead(t *testing.T) {
+	if *updateFixtures {
+		writeRemoteReadFixtures(t)
+	}
+
+	server := newRemoteReadServer(t)
+	defer server.Close()
+
+	for _, rateLimit := range []bool{false, true} {
+		client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, rateLimit, nil)
+		if err != nil {
+			t.Fatalf("NewPrometheusClient failed %s", err.Error())
+		}
+
+		for _, responseType := range []prompb.ResponseType{prompb.ResponseTypeStreamedXORChunks, prompb.ResponseTypeSamples} {
+			ctx := NewContext(client)
+			ctx.SetTimestampPrecision(0)
+			config := DefaultRemoteReadConfig()
+			config.ResponseTypes = []prompb.ResponseType{responseType}
+			ctx.SetRemoteReadConfig(config)
+
+			results, err := ctx.RemoteRead(context.Background(), remoteReadQueries()...)
+			if err != nil {
+				t.Fatalf("RemoteRead of response type %d failed %s", responseType, err.Error())
+			}
+			if len(results) != 2 || len(results[0]) != 1 || len(results[1]) != 1 {
+				t.Fatalf("expected a series of each query, got %v", results)
+			}
+
+			cpu := results[0][0]
+			if cpu.Metric["pod"] != "pod-0" || len(cpu.Values) != 3 {
+				t.Fatalf("expected the 3 samples of the cpu series, got %v %v", cpu.Metric, cpu.Values)
+			}
+			if v := cpu.Values[1]; v.Timestamp != 1600000015.25 || v.Value != 10.5 {
+				t.Errorf("expected the sub-second sample, got %v", v)
+			}
+			if memory := results[1][0]; len(memory.Values) != 2 || memory.Values[1].Value != 4096 {
+				t.Errorf("expected the 2 samples of the memory series, got %v", memory.Values)
+			}
+		}
+	}
+}
+
+func TestRemoteRead_Errors(t *testing.T) {
+	chunks, err := ioutil.ReadFile(filepath.FromSlash(chunksFixture))
+	if err != nil {
+		t.Fatalf("ReadFile failed %s", err.Error())
+	}
+	// the last byte of the last frame is corrupted
+	corrupted := append([]byte(nil), chunks...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	// the frame claims more bytes than the limit, and is rejected before it is allocated or read
+	oversized := make([]byte, binary.MaxVarintLen64)
+	oversized = oversized[:binary.PutUvarint(oversized, 1<<40)]
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/corrupted/api/v1/read":
+			w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+			_, _ = w.Write(corrupted)
+		case "/oversized/api/v1/read":
+			w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+			_, _ = w.Write(oversized)
+		case "/snappy/api/v1/read":
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			_, _ = w.Write([]byte("not snappy"))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("remote read is disabled"))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, false, nil)
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+
+	for _, c := range []string{"corrupted", "oversized", "snappy", "disabled"} {
+		ctx := NewContext(client)
+		config := DefaultRemoteReadConfig()
+		config.Path = "/" + c + "/api/v1/read"
+		ctx.SetRemoteReadConfig(config)
+
+		if _, err := ctx.RemoteRead(context.Background(), remoteReadQueries()...); err == nil {
+			t.Errorf("%s: expected an error", c)
+		} else if c == "disabled" && !IsCommError(err) {
+			t.Errorf("%s: expected a CommError, got %v", c, err)
+		} else if c == "oversized" && !strings.Contains(err.Error(), "exceeds the limit") {
+			t.Errorf("%s: expected the frame size rejected, got %v", c, err)
+		}
+	}
+}
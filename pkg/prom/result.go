@@ -1,11 +1,13 @@
 package prom
 
 import (
+	"encoding/json"
 	"fmt"
 	"k8s.io/klog"
 	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/open-resource-management/metricsclient/pkg/util"
 )
@@ -80,11 +82,29 @@ func (qrc QueryResultsChan) Await() ([]*QueryResult, error) {
 	return results.Results, nil
 }
 
+// ResultType is the data.resultType of the prometheus query responses
+type ResultType string
+
+const (
+	ResultTypeMatrix ResultType = "matrix"
+	ResultTypeVector ResultType = "vector"
+	ResultTypeScalar ResultType = "scalar"
+	ResultTypeString ResultType = "string"
+)
+
 // QueryResults contains all of the query results and the source query string.
 type QueryResults struct {
 	Query   string
 	Error   error
 	Results []*QueryResult
+	// Warnings are the warnings of the prometheus response
+	Warnings []string
+	// ResultType is the type of the results. The matrix and vector results are in Results, the
+	// scalar result is in ScalarValue, and also in Results as a single result without labels,
+	// the string result is in StringValue.
+	ResultType  ResultType
+	ScalarValue *util.Vector
+	StringValue *StringResult
 }
 
 // QueryResult contains a single result from a prometheus query. It's common
@@ -94,9 +114,72 @@ type QueryResult struct {
 	Values []*util.Vector         `json:"values"`
 }
 
+// StringResult is the result of a query with the string result type
+type StringResult struct {
+	Timestamp float64 `json:"timestamp"`
+	Value     string  `json:"value"`
+}
+
+// AsMatrix returns the results of a range query, or an error if the result type is not matrix
+func (qrs *QueryResults) AsMatrix() ([]*QueryResult, error) {
+	if err := qrs.expect(ResultTypeMatrix); err != nil {
+		return nil, err
+	}
+
+	return qrs.Results, nil
+}
+
+// AsVector returns the results of an instant query, or an error if the result type is not vector
+func (qrs *QueryResults) AsVector() ([]*QueryResult, error) {
+	if err := qrs.expect(ResultTypeVector); err != nil {
+		return nil, err
+	}
+
+	return qrs.Results, nil
+}
+
+// AsScalar returns the scalar result, or an error if the result type is not scalar
+func (qrs *QueryResults) AsScalar() (util.Vector, error) {
+	if err := qrs.expect(ResultTypeScalar); err != nil {
+		return util.Vector{}, err
+	}
+
+	return *qrs.ScalarValue, nil
+}
+
+// AsString returns the string result, or an error if the result type is not string
+func (qrs *QueryResults) AsString() (StringResult, error) {
+	if err := qrs.expect(ResultTypeString); err != nil {
+		return StringResult{}, err
+	}
+
+	return *qrs.StringValue, nil
+}
+
+// expect returns the error of the results, or an error if the result type is not t
+func (qrs *QueryResults) expect(t ResultType) error {
+	if qrs.Error != nil {
+		return qrs.Error
+	}
+	if qrs.ResultType != t {
+		return fmt.Errorf("expected %s result, got %s result fetching query '%s'", t, qrs.ResultType, qrs.Query)
+	}
+
+	return nil
+}
+
+// DefaultTimestampPrecision is the precision the timestamps of the results are rounded to
+const DefaultTimestampPrecision = 10 * time.Second
+
 // NewQueryResults accepts the raw prometheus query result and returns an array of
 // QueryResult objects
 func NewQueryResults(query string, queryResult interface{}) *QueryResults {
+	return NewQueryResultsWithPrecision(query, queryResult, DefaultTimestampPrecision)
+}
+
+// NewQueryResultsWithPrecision is the same as NewQueryResults, but the timestamps are rounded to
+// the precision, or kept as returned by prometheus if precision <= 0.
+func NewQueryResultsWithPrecision(query string, queryResult interface{}, precision time.Duration) *QueryResults {
 	qrs := &QueryResults{Query: query}
 
 	if queryResult == nil {
@@ -104,14 +187,27 @@ func NewQueryResults(query string, queryResult interface{}) *QueryResults {
 		return qrs
 	}
 
-	data, ok := queryResult.(map[string]interface{})["data"]
+	response, ok := queryResult.(map[string]interface{})
 	if !ok {
-		e, err := wrapPrometheusError(query, queryResult)
-		if err != nil {
-			qrs.Error = err
-			return qrs
+		qrs.Error = PromUnexpectedResponseErr(query)
+		return qrs
+	}
+
+	// the NoStoreAPIWarning means the data is partial, so it is promoted to an error
+	for _, w := range parseWarnings(response) {
+		if IsNoStoreAPIWarning(w) {
+			qrs.Error = NewNoStoreAPIError(query)
+			continue
 		}
-		qrs.Error = fmt.Errorf(e)
+		qrs.Warnings = append(qrs.Warnings, w)
+	}
+	if qrs.Error != nil {
+		return qrs
+	}
+
+	data, ok := response["data"]
+	if !ok || response["status"] == "error" {
+		qrs.Error = wrapPrometheusError(query, response, nil)
 		return qrs
 	}
 
@@ -126,6 +222,36 @@ func NewQueryResults(query string, queryResult interface{}) *QueryResults {
 		qrs.Error = ResultFieldDoesNotExistErr(query)
 		return qrs
 	}
+
+	resultType, _ := d["resultType"].(string)
+	qrs.ResultType = ResultType(resultType)
+
+	switch qrs.ResultType {
+	case ResultTypeScalar:
+		v, warn, err := parseDataPoint(query, resultData, precision)
+		if err != nil {
+			qrs.Error = err
+			return qrs
+		}
+		if warn != nil {
+			klog.Warningf("%s\nQuery: %s", warn.Message(), query)
+		}
+
+		qrs.ScalarValue = v
+		qrs.Results = []*QueryResult{{Metric: map[string]interface{}{}, Values: []*util.Vector{v}}}
+		return qrs
+
+	case ResultTypeString:
+		sr, err := parseString(query, resultData)
+		if err != nil {
+			qrs.Error = err
+			return qrs
+		}
+
+		qrs.StringValue = sr
+		return qrs
+	}
+
 	resultsData, ok := resultData.([]interface{})
 	if !ok {
 		qrs.Error = ResultFieldFormatErr(query)
@@ -158,8 +284,12 @@ func NewQueryResults(query string, queryResult interface{}) *QueryResults {
 		// if we receive multiple warnings.
 		var labelString string = ""
 
-		// Determine if the result is a ranged data set or single value
-		_, isRange := resultInterface["values"]
+		// Determine if the result is a ranged data set or single value, responses without
+		// resultType are guessed from the values field
+		isRange := qrs.ResultType == ResultTypeMatrix
+		if qrs.ResultType == "" {
+			_, isRange = resultInterface["values"]
+		}
 
 		var vectors []*util.Vector
 		if !isRange {
@@ -170,7 +300,7 @@ func NewQueryResults(query string, queryResult interface{}) *QueryResults {
 			}
 
 			// Append new data point, log warnings
-			v, warn, err := parseDataPoint(query, dataPoint)
+			v, warn, err := parseDataPoint(query, dataPoint, precision)
 			if err != nil {
 				qrs.Error = err
 				return qrs
@@ -183,13 +313,13 @@ func NewQueryResults(query string, queryResult interface{}) *QueryResults {
 		} else {
 			values, ok := resultInterface["values"].([]interface{})
 			if !ok {
-				qrs.Error = fmt.Errorf("Values field is improperly formatted")
+				qrs.Error = ValueFieldFormatErr(query)
 				return qrs
 			}
 
 			// Append new data points, log warnings
 			for _, value := range values {
-				v, warn, err := parseDataPoint(query, value)
+				v, warn, err := parseDataPoint(query, value, precision)
 				if err != nil {
 					qrs.Error = err
 					return qrs
@@ -299,7 +429,7 @@ func (qr *QueryResult) GetAnnotations() map[string]string {
 
 // parseDataPoint parses a data point from raw prometheus query results and returns
 // a new Vector instance containing the parsed data along with any warnings or errors.
-func parseDataPoint(query string, dataPoint interface{}) (*util.Vector, warning, error) {
+func parseDataPoint(query string, dataPoint interface{}, precision time.Duration) (*util.Vector, warning, error) {
 	var w warning = nil
 
 	value, ok := dataPoint.([]interface{})
@@ -307,12 +437,33 @@ func parseDataPoint(query string, dataPoint interface{}) (*util.Vector, warning,
 		return nil, w, DataPointFormatErr(query)
 	}
 
-	strVal := value[1].(string)
-	v, err := strconv.ParseFloat(strVal, 64)
+	timestamp, ok := value[0].(float64)
+	if !ok {
+		return nil, w, DataPointFormatErr(query)
+	}
+	strVal, ok := value[1].(string)
+	if !ok {
+		return nil, w, DataPointFormatErr(query)
+	}
+
+	v, w, err := newDataPoint(timestamp, strVal, precision)
 	if err != nil {
 		return nil, w, err
 	}
 
+	return &v, w, nil
+}
+
+// newDataPoint parses the value of a data point and returns the Vector with the timestamp rounded to
+// the precision, along with any warnings or errors.
+func newDataPoint(timestamp float64, strVal string, precision time.Duration) (util.Vector, warning, error) {
+	var w warning = nil
+
+	v, err := strconv.ParseFloat(strVal, 64)
+	if err != nil {
+		return util.Vector{}, w, err
+	}
+
 	// Test for +Inf and -Inf (sign: 0), Test for NaN
 	if math.IsInf(v, 0) {
 		w = InfWarning
@@ -322,12 +473,31 @@ func parseDataPoint(query string, dataPoint interface{}) (*util.Vector, warning,
 		v = 0.0
 	}
 
-	return &util.Vector{
-		Timestamp: math.Round(value[0].(float64)/10) * 10,
+	return util.Vector{
+		Timestamp: util.RoundTimestamp(timestamp, precision.Seconds()),
 		Value:     v,
 	}, w, nil
 }
 
+// parseString parses the [timestamp, "value"] result of a string query
+func parseString(query string, result interface{}) (*StringResult, error) {
+	value, ok := result.([]interface{})
+	if !ok || len(value) != 2 {
+		return nil, DataPointFormatErr(query)
+	}
+
+	timestamp, ok := value[0].(float64)
+	if !ok {
+		return nil, DataPointFormatErr(query)
+	}
+	str, ok := value[1].(string)
+	if !ok {
+		return nil, DataPointFormatErr(query)
+	}
+
+	return &StringResult{Timestamp: timestamp, Value: str}, nil
+}
+
 func labelsForMetric(metricMap map[string]interface{}) string {
 	var pairs []string
 	for k, v := range metricMap {
@@ -337,11 +507,45 @@ func labelsForMetric(metricMap map[string]interface{}) string {
 	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
 }
 
-func wrapPrometheusError(query string, qr interface{}) (string, error) {
-	e, ok := qr.(map[string]interface{})["error"]
+// parseWarnings returns the warnings of the prometheus response
+func parseWarnings(response map[string]interface{}) []string {
+	ws, ok := response["warnings"].([]interface{})
 	if !ok {
-		return "", PromUnexpectedResponseErr(query)
+		return nil
+	}
+
+	var warnings []string
+	for _, w := range ws {
+		if str, ok := w.(string); ok {
+			warnings = append(warnings, str)
+		}
 	}
-	eStr, ok := e.(string)
-	return fmt.Sprintf("'%s' parsing query '%s'", eStr, query), nil
+
+	return warnings
+}
+
+// wrapPrometheusError returns the PrometheusError of the errorType and error fields of the
+// response, err is the communication error of the response if its status was unsuccessful
+func wrapPrometheusError(query string, response map[string]interface{}, err error) error {
+	e, ok := response["error"].(string)
+	if !ok {
+		if err != nil {
+			return err
+		}
+		return PromUnexpectedResponseErr(query)
+	}
+
+	errorType, _ := response["errorType"].(string)
+	return NewPrometheusError(ErrorType(errorType), e, query, err)
+}
+
+// parseErrorBody returns the PrometheusError of an unsuccessful response body, or err if the body
+// is not a prometheus error
+func parseErrorBody(query string, body []byte, err error) error {
+	var response map[string]interface{}
+	if json.Unmarshal(body, &response) != nil {
+		return err
+	}
+
+	return wrapPrometheusError(query, response, err)
 }
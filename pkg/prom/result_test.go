@@ -0,0 +1,186 @@
+package prom
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeResponse(t *testing.T, body string) interface{} {
+	var response interface{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatalf("unmarshal response failed %s", err.Error())
+	}
+	return response
+}
+
+func TestNewQueryResults_Warnings(t *testing.T) {
+	results := NewQueryResults("up", decodeResponse(t, `{"status":"success","warnings":["partial data"],
+		"data":{"resultType":"vector","result":[{"metric":{"job":"prometheus"},"value":[1600000000,"1"]}]}}`))
+	if results.Error != nil {
+		t.Fatalf("unexpected error %s", results.Error)
+	}
+	if len(results.Results) != 1 || len(results.Warnings) != 1 || results.Warnings[0] != "partial data" {
+		t.Errorf("expected the result and the warning, got %d results, warnings %v", len(results.Results), results.Warnings)
+	}
+
+	// the data of a response without StoreAPIs is partial
+	results = NewQueryResults("up", decodeResponse(t, `{"status":"success","warnings":["No StoreAPIs matched for this query"],
+		"data":{"resultType":"vector","result":[]}}`))
+	if !IsNoStoreAPIError(results.Error) || len(results.Warnings) != 0 {
+		t.Errorf("expected the warning promoted to an error, got %v, warnings %v", results.Error, results.Warnings)
+	}
+}
+
+func TestNewQueryResults_Error(t *testing.T) {
+	results := NewQueryResults("up[", decodeResponse(t, `{"status":"error","errorType":"bad_data","error":"parse error"}`))
+
+	var pe PrometheusError
+	if !errors.As(results.Error, &pe) || pe.Type != ErrorTypeBadData || pe.Message != "parse error" || pe.Query != "up[" {
+		t.Errorf("expected a bad_data PrometheusError, got %v", results.Error)
+	}
+
+	results = NewQueryResults("up", decodeResponse(t, `{"status":"success"}`))
+	if results.Error == nil || IsPrometheusError(results.Error) {
+		t.Errorf("expected an unexpected response error, got %v", results.Error)
+	}
+}
+
+func TestQueryResponseErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("query") {
+		case "timeout":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"status":"error","errorType":"timeout","error":"query timed out in expression evaluation"}`))
+		case "partial":
+			_, _ = w.Write([]byte(`{"status":"success","warnings":["No StoreAPIs matched for this query"],"data":{"resultType":"vector","result":[]}}`))
+		default:
+			_, _ = w.Write([]byte(`{"status":"success","warnings":["partial data"],"data":{"resultType":"vector","result":[]}}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, false, nil)
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+	ctx := NewContext(client)
+
+	// the error body of an unsuccessful response is a PrometheusError, which wraps the CommError
+	_, err = ctx.QuerySync("timeout")
+	if !IsPrometheusError(err) || !IsCommError(err) || !strings.Contains(err.Error(), "Prometheus timeout error") {
+		t.Errorf("expected a timeout PrometheusError, got %v", err)
+	}
+
+	if _, err := ctx.QuerySync("partial"); !IsNoStoreAPIError(err) {
+		t.Errorf("expected a NoStoreAPIError, got %v", err)
+	}
+
+	if _, err := ctx.Query("up").Await(); err != nil {
+		t.Fatalf("query failed %s", err.Error())
+	}
+	warnings := ctx.Warnings()
+	if len(warnings) != 1 || len(warnings[0].Warnings) != 1 || warnings[0].Warnings[0] != "partial data" {
+		t.Errorf("expected the warning reported, got %v", warnings)
+	}
+}
+
+func TestNewQueryResults_ResultTypes(t *testing.T) {
+	results := NewQueryResults("up[5m]", decodeResponse(t, `{"status":"success","data":{"resultType":"matrix",
+		"result":[{"metric":{"job":"prometheus"},"values":[[1600000000,"1"],[1600000060,"2"]]}]}}`))
+	matrix, err := results.AsMatrix()
+	if err != nil || len(matrix) != 1 || len(matrix[0].Values) != 2 || matrix[0].Values[1].Value != 2 {
+		t.Errorf("expected the matrix result, got %v %v", matrix, err)
+	}
+	if _, err := results.AsVector(); err == nil {
+		t.Errorf("expected an error for the vector of a matrix result")
+	}
+
+	// a vector result with a single sample is not mistaken for a range
+	results = NewQueryResults("up", decodeResponse(t, `{"status":"success","data":{"resultType":"vector",
+		"result":[{"metric":{"job":"prometheus"},"value":[1600000000,"1"]}]}}`))
+	if vector, err := results.AsVector(); err != nil || len(vector) != 1 || vector[0].Values[0].Value != 1 {
+		t.Errorf("expected the vector result, got %v %v", vector, err)
+	}
+
+	results = NewQueryResults("scalar(up)", decodeResponse(t, `{"status":"success","data":{"resultType":"scalar","result":[1600000000,"42"]}}`))
+	if scalar, err := results.AsScalar(); err != nil || scalar.Value != 42 || scalar.Timestamp != 1600000000 {
+		t.Errorf("expected the scalar result, got %v %v", scalar, err)
+	}
+	if len(results.Results) != 1 || results.Results[0].Values[0].Value != 42 {
+		t.Errorf("expected the scalar in the results, got %v", results.Results)
+	}
+
+	results = NewQueryResults(`"foo"`, decodeResponse(t, `{"status":"success","data":{"resultType":"string","result":[1600000000,"foo"]}}`))
+	if str, err := results.AsString(); err != nil || str.Value != "foo" || str.Timestamp != 1600000000 {
+		t.Errorf("expected the string result, got %v %v", str, err)
+	}
+}
+
+func TestNewQueryResults_MalformedDataPoints(t *testing.T) {
+	responses := []string{
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":["1600000000","1"]}]}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1600000000,1]}]}}`,
+		`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1600000000]]}]}}`,
+		`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"value":[1600000000,"1"]}]}}`,
+		`{"status":"success","data":{"resultType":"scalar","result":[1600000000,null]}}`,
+		`{"status":"success","data":{"resultType":"string","result":"foo"}}`,
+	}
+
+	for _, response := range responses {
+		if results := NewQueryResults("up", decodeResponse(t, response)); results.Error == nil {
+			t.Errorf("expected an error for %s", response)
+		}
+	}
+}
+
+func TestNewQueryResultsWithPrecision(t *testing.T) {
+	response := `{"status":"success","data":{"resultType":"matrix",
+		"result":[{"metric":{},"values":[[1600000001.25,"1"],[1600000006,"2"]]}]}}`
+
+	for precision, expected := range map[time.Duration][]float64{
+		DefaultTimestampPrecision: {1600000000, 1600000010},
+		5 * time.Second:           {1600000000, 1600000005},
+		0:                         {1600000001.25, 1600000006},
+	} {
+		results := NewQueryResultsWithPrecision("up[5m]", decodeResponse(t, response), precision)
+		if results.Error != nil {
+			t.Fatalf("unexpected error %s", results.Error)
+		}
+		values := results.Results[0].Values
+		if values[0].Timestamp != expected[0] || values[1].Timestamp != expected[1] {
+			t.Errorf("expected the timestamps %v with precision %s, got %v %v", expected, precision, values[0], values[1])
+		}
+	}
+}
+
+func TestTimestampPrecision(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1600000001.25,"1"]}]}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, false, nil)
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+	ctx := NewContext(client)
+	if ctx.TimestampPrecision() != DefaultTimestampPrecision {
+		t.Errorf("expected the default precision, got %s", ctx.TimestampPrecision())
+	}
+
+	ctx.SetTimestampPrecision(0)
+	results, err := ctx.QuerySync("up")
+	if err != nil {
+		t.Fatalf("query failed %s", err.Error())
+	}
+	if ts := results[0].Values[0].Timestamp; ts != 1600000001.25 {
+		t.Errorf("expected the sub-second timestamp, got %f", ts)
+	}
+}
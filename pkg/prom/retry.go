@@ -0,0 +1,162 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseBackoff = 200 * time.Millisecond
+	defaultRetryMaxBackoff  = 5 * time.Second
+	defaultRetryJitter      = 0.2
+)
+
+// RetryPolicy describes how queries are retried on transient failures, e.g. while prometheus
+// is restarting. Failed attempts are retried with exponential backoff: BaseBackoff * 2^(attempt-1),
+// capped at MaxBackoff, or the Retry-After header of the response if it is set.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one, values < 2 disable retries
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Jitter is the fraction in [0, 1] of the backoff which is randomly subtracted from it
+	Jitter float64
+	// RetryableStatusCodes are the response status codes which are retried
+	RetryableStatusCodes []int
+	// RetryableErrnos are the network errors which are retried
+	RetryableErrnos []syscall.Errno
+}
+
+// DefaultRetryPolicy returns a RetryPolicy which retries 503, 429 and connection reset/refused
+// up to 3 attempts.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:          defaultRetryMaxAttempts,
+		BaseBackoff:          defaultRetryBaseBackoff,
+		MaxBackoff:           defaultRetryMaxBackoff,
+		Jitter:               defaultRetryJitter,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests},
+		RetryableErrnos:      []syscall.Errno{syscall.ECONNRESET, syscall.ECONNREFUSED},
+	}
+}
+
+// retryPolicyClient is used to determine if the prometheus client retries failed queries
+type retryPolicyClient interface {
+	RetryPolicy() *RetryPolicy
+}
+
+// retryPolicyFor returns the RetryPolicy of the client, nil if the client doesn't retry
+func retryPolicyFor(client interface{}) *RetryPolicy {
+	if rc, ok := client.(retryPolicyClient); ok {
+		return rc.RetryPolicy()
+	}
+
+	return nil
+}
+
+// IsRetryable returns true if the response or error of an attempt is a transient failure
+func (rp *RetryPolicy) IsRetryable(resp *http.Response, err error) bool {
+	if rp == nil {
+		return false
+	}
+
+	if err != nil {
+		for _, errno := range rp.RetryableErrnos {
+			if errors.Is(err, errno) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if resp == nil {
+		return false
+	}
+	for _, code := range rp.RetryableStatusCodes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// next returns the delay before the next attempt, and false if the attempt shouldn't be retried
+func (rp *RetryPolicy) next(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if rp == nil || attempt >= rp.MaxAttempts || !rp.IsRetryable(resp, err) {
+		return 0, false
+	}
+
+	if resp != nil {
+		if delay, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return rp.capBackoff(delay), true
+		}
+	}
+
+	return rp.backoff(attempt), true
+}
+
+// backoff returns the jittered exponential backoff after the given attempt
+func (rp *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := rp.BaseBackoff
+	for i := 1; i < attempt && delay < rp.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = rp.capBackoff(delay)
+
+	if rp.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * rp.Jitter * float64(delay))
+	}
+
+	return delay
+}
+
+func (rp *RetryPolicy) capBackoff(delay time.Duration) time.Duration {
+	if rp.MaxBackoff > 0 && delay > rp.MaxBackoff {
+		return rp.MaxBackoff
+	}
+
+	return delay
+}
+
+// retryAfter parses the Retry-After header, which is either the delay in seconds or a http date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if delay := t.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// sleepContext waits for the given duration, and returns the error of ctx if it is done before
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
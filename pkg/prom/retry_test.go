@@ -0,0 +1,139 @@
+package prom
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{now.Add(5 * time.Second).Format(http.TimeFormat), 5 * time.Second, true},
+		{now.Add(-5 * time.Second).Format(http.TimeFormat), 0, true},
+	}
+
+	for _, c := range cases {
+		delay, ok := retryAfter(c.value, now)
+		if delay != c.delay || ok != c.ok {
+			t.Errorf("retryAfter(%q) = %s, %v, expected %s, %v", c.value, delay, ok, c.delay, c.ok)
+		}
+	}
+}
+
+func TestRetryPolicy_Next(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = 5
+	policy.BaseBackoff = 100 * time.Millisecond
+	policy.MaxBackoff = 300 * time.Millisecond
+	policy.Jitter = 0
+
+	unavailable := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	for attempt, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond} {
+		delay, ok := policy.next(attempt+1, unavailable, nil)
+		if !ok || delay != expected {
+			t.Errorf("attempt %d: got %s, %v, expected %s", attempt+1, delay, ok, expected)
+		}
+	}
+	if _, ok := policy.next(5, unavailable, nil); ok {
+		t.Errorf("expected no retry after max attempts")
+	}
+
+	throttled := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"1"}}}
+	if delay, ok := policy.next(1, throttled, nil); !ok || delay != policy.MaxBackoff {
+		t.Errorf("expected Retry-After capped to max backoff, got %s, %v", delay, ok)
+	}
+
+	if _, ok := policy.next(1, &http.Response{StatusCode: http.StatusBadRequest}, nil); ok {
+		t.Errorf("expected no retry for bad request")
+	}
+
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	if _, ok := policy.next(1, nil, reset); !ok {
+		t.Errorf("expected retry for connection reset")
+	}
+	if _, ok := policy.next(1, nil, errors.New("boom")); ok {
+		t.Errorf("expected no retry for unknown error")
+	}
+
+	var none *RetryPolicy
+	if _, ok := none.next(1, unavailable, nil); ok {
+		t.Errorf("expected no retry for nil policy")
+	}
+}
+
+// newFlakyPromServer returns a server which fails the first failures requests with the given
+// status code, and counts the requests it received
+func newFlakyPromServer(failures int32, statusCode int, count *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(count, 1) <= failures {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(statusCode)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+}
+
+func TestQuerySync_Retry(t *testing.T) {
+	for _, rateLimit := range []bool{false, true} {
+		var count int32
+		server := newFlakyPromServer(2, http.StatusServiceUnavailable, &count)
+
+		client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, rateLimit, &ClientAuth{},
+			WithRetryPolicy(DefaultRetryPolicy()))
+		if err != nil {
+			t.Fatalf("NewPrometheusClient failed %s", err.Error())
+		}
+		ctx := NewNamedContext(client, ClusterContextName)
+
+		if _, err := ctx.QuerySync("up"); err != nil {
+			t.Errorf("rate limit %v: query failed %s", rateLimit, err.Error())
+		}
+		if count := atomic.LoadInt32(&count); count != 3 {
+			t.Errorf("rate limit %v: expected 3 attempts, got %d", rateLimit, count)
+		}
+		if warnings := ctx.Warnings(); len(warnings) != 2 {
+			t.Errorf("rate limit %v: expected 2 failed attempts recorded, got %d", rateLimit, len(warnings))
+		}
+
+		server.Close()
+	}
+}
+
+func TestQuerySync_NoRetry(t *testing.T) {
+	var count int32
+	server := newFlakyPromServer(1, http.StatusInternalServerError, &count)
+	defer server.Close()
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, false, &ClientAuth{},
+		WithRetryPolicy(DefaultRetryPolicy()))
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+	ctx := NewNamedContext(client, ClusterContextName)
+
+	_, err = ctx.QuerySync("up")
+	if !IsCommError(err) {
+		t.Errorf("expected CommError, got %v", err)
+	}
+	if count := atomic.LoadInt32(&count); count != 1 {
+		t.Errorf("expected 1 attempt, got %d", count)
+	}
+}
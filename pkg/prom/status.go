@@ -0,0 +1,344 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ctxTargets           = apiPrefix + "/targets"
+	ctxRules             = apiPrefix + "/rules"
+	ctxAlerts            = apiPrefix + "/alerts"
+	ctxStatusBuildInfo   = apiPrefix + "/status/buildinfo"
+	ctxStatusFlags       = apiPrefix + "/status/flags"
+	ctxStatusTSDB        = apiPrefix + "/status/tsdb"
+	ctxStatusRuntimeInfo = apiPrefix + "/status/runtimeinfo"
+)
+
+// SubqueryMinVersion is the first prometheus version which supports the subqueries
+const SubqueryMinVersion = "2.7.0"
+
+// subqueryProbe is the query run to check the subqueries if the version is unknown
+const subqueryProbe = "vector(1)[1m:1m]"
+
+//--------------------------------------------------------------------------
+//  Targets
+//--------------------------------------------------------------------------
+
+// TargetState filters the targets by their state
+type TargetState string
+
+const (
+	TargetStateActive  TargetState = "active"
+	TargetStateDropped TargetState = "dropped"
+	TargetStateAny     TargetState = "any"
+)
+
+// TargetHealth is the health of the last scrape of a target
+type TargetHealth string
+
+const (
+	TargetHealthUp      TargetHealth = "up"
+	TargetHealthDown    TargetHealth = "down"
+	TargetHealthUnknown TargetHealth = "unknown"
+)
+
+// TargetsResult is the result of the targets API
+type TargetsResult struct {
+	Active  []ActiveTarget  `json:"activeTargets"`
+	Dropped []DroppedTarget `json:"droppedTargets"`
+}
+
+// ActiveTarget is a target scraped by prometheus
+type ActiveTarget struct {
+	DiscoveredLabels   map[string]string `json:"discoveredLabels"`
+	Labels             map[string]string `json:"labels"`
+	ScrapePool         string            `json:"scrapePool"`
+	ScrapeURL          string            `json:"scrapeUrl"`
+	GlobalURL          string            `json:"globalUrl"`
+	LastError          string            `json:"lastError"`
+	LastScrape         time.Time         `json:"lastScrape"`
+	LastScrapeDuration float64           `json:"lastScrapeDuration"`
+	Health             TargetHealth      `json:"health"`
+}
+
+// DroppedTarget is a target dropped by the relabeling
+type DroppedTarget struct {
+	DiscoveredLabels map[string]string `json:"discoveredLabels"`
+}
+
+// Healthy returns the active targets of the job which are up, and the ones which are not
+func (tr *TargetsResult) Healthy(job string) (up []ActiveTarget, down []ActiveTarget) {
+	for _, target := range tr.Active {
+		if target.Labels["job"] != job {
+			continue
+		}
+		if target.Health == TargetHealthUp {
+			up = append(up, target)
+		} else {
+			down = append(down, target)
+		}
+	}
+
+	return up, down
+}
+
+// Targets returns the targets of the state, the empty state returns the active and dropped targets
+// as the default of prometheus.
+func (ctx *Context) Targets(reqCtx context.Context, state TargetState) (*TargetsResult, error) {
+	params := url.Values{}
+	if state != "" {
+		params.Set("state", string(state))
+	}
+
+	var targets TargetsResult
+	if err := ctx.api(reqCtx, http.MethodGet, ctxTargets, nil, params, &targets); err != nil {
+		return nil, err
+	}
+
+	return &targets, nil
+}
+
+//--------------------------------------------------------------------------
+//  Rules and Alerts
+//--------------------------------------------------------------------------
+
+// RuleType filters the rules by their type
+type RuleType string
+
+const (
+	RuleTypeAlerting  RuleType = "alerting"
+	RuleTypeRecording RuleType = "recording"
+)
+
+// RulesResult is the result of the rules API
+type RulesResult struct {
+	Groups []RuleGroup `json:"groups"`
+}
+
+// RuleGroup is a group of rules evaluated together
+type RuleGroup struct {
+	Name     string  `json:"name"`
+	File     string  `json:"file"`
+	Interval float64 `json:"interval"`
+	Rules    []Rule  `json:"rules"`
+}
+
+// Rule is an alerting or recording rule, the Duration, Annotations, Alerts and State are only set
+// for the alerting rules
+type Rule struct {
+	Type           RuleType          `json:"type"`
+	Name           string            `json:"name"`
+	Query          string            `json:"query"`
+	Labels         map[string]string `json:"labels"`
+	Health         string            `json:"health"`
+	LastError      string            `json:"lastError"`
+	EvaluationTime float64           `json:"evaluationTime"`
+	LastEvaluation time.Time         `json:"lastEvaluation"`
+	Duration       float64           `json:"duration"`
+	Annotations    map[string]string `json:"annotations"`
+	Alerts         []Alert           `json:"alerts"`
+	State          string            `json:"state"`
+}
+
+// Alert is an active alert
+type Alert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	// State is pending or firing
+	State    string     `json:"state"`
+	ActiveAt *time.Time `json:"activeAt"`
+	Value    string     `json:"value"`
+}
+
+// AlertsResult is the result of the alerts API
+type AlertsResult struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+// Rules returns the rule groups, the empty type returns both the alerting and recording rules
+func (ctx *Context) Rules(reqCtx context.Context, ruleType RuleType) (*RulesResult, error) {
+	params := url.Values{}
+	if ruleType != "" {
+		params.Set("type", string(ruleType))
+	}
+
+	var rules RulesResult
+	if err := ctx.api(reqCtx, http.MethodGet, ctxRules, nil, params, &rules); err != nil {
+		return nil, err
+	}
+
+	return &rules, nil
+}
+
+// Alerts returns the active alerts
+func (ctx *Context) Alerts(reqCtx context.Context) (*AlertsResult, error) {
+	var alerts AlertsResult
+	if err := ctx.api(reqCtx, http.MethodGet, ctxAlerts, nil, nil, &alerts); err != nil {
+		return nil, err
+	}
+
+	return &alerts, nil
+}
+
+//--------------------------------------------------------------------------
+//  Status
+//--------------------------------------------------------------------------
+
+// BuildInfo is the build information of prometheus
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Branch    string `json:"branch"`
+	BuildUser string `json:"buildUser"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// TSDBResult is the cardinality statistics of the head block of the TSDB
+type TSDBResult struct {
+	HeadStats                   TSDBHeadStats `json:"headStats"`
+	SeriesCountByMetricName     []TSDBStat    `json:"seriesCountByMetricName"`
+	LabelValueCountByLabelName  []TSDBStat    `json:"labelValueCountByLabelName"`
+	MemoryInBytesByLabelName    []TSDBStat    `json:"memoryInBytesByLabelName"`
+	SeriesCountByLabelValuePair []TSDBStat    `json:"seriesCountByLabelValuePair"`
+}
+
+// TSDBHeadStats is the statistics of the head block, the times are in milliseconds
+type TSDBHeadStats struct {
+	NumSeries     uint64 `json:"numSeries"`
+	NumLabelPairs int    `json:"numLabelPairs"`
+	ChunkCount    int64  `json:"chunkCount"`
+	MinTime       int64  `json:"minTime"`
+	MaxTime       int64  `json:"maxTime"`
+}
+
+// TSDBStat is the count of a metric name, label name or label pair
+type TSDBStat struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+// RuntimeInfo is the runtime information of prometheus
+type RuntimeInfo struct {
+	StartTime           time.Time `json:"startTime"`
+	CWD                 string    `json:"CWD"`
+	ReloadConfigSuccess bool      `json:"reloadConfigSuccess"`
+	LastConfigTime      time.Time `json:"lastConfigTime"`
+	CorruptionCount     int       `json:"corruptionCount"`
+	GoroutineCount      int       `json:"goroutineCount"`
+	GOMAXPROCS          int       `json:"GOMAXPROCS"`
+	GOGC                string    `json:"GOGC"`
+	GODEBUG             string    `json:"GODEBUG"`
+	StorageRetention    string    `json:"storageRetention"`
+}
+
+// BuildInfo returns the build information of prometheus, which is not served by all the
+// prometheus compatible APIs
+func (ctx *Context) BuildInfo(reqCtx context.Context) (*BuildInfo, error) {
+	var info BuildInfo
+	if err := ctx.api(reqCtx, http.MethodGet, ctxStatusBuildInfo, nil, nil, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// Flags returns the command line flags of prometheus by name
+func (ctx *Context) Flags(reqCtx context.Context) (map[string]string, error) {
+	var flags map[string]string
+	if err := ctx.api(reqCtx, http.MethodGet, ctxStatusFlags, nil, nil, &flags); err != nil {
+		return nil, err
+	}
+
+	return flags, nil
+}
+
+// TSDB returns the cardinality statistics of the TSDB
+func (ctx *Context) TSDB(reqCtx context.Context) (*TSDBResult, error) {
+	var tsdb TSDBResult
+	if err := ctx.api(reqCtx, http.MethodGet, ctxStatusTSDB, nil, nil, &tsdb); err != nil {
+		return nil, err
+	}
+
+	return &tsdb, nil
+}
+
+// RuntimeInfo returns the runtime information of prometheus
+func (ctx *Context) RuntimeInfo(reqCtx context.Context) (*RuntimeInfo, error) {
+	var info RuntimeInfo
+	if err := ctx.api(reqCtx, http.MethodGet, ctxStatusRuntimeInfo, nil, nil, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// SupportsSubqueries returns true if prometheus supports the subqueries, i.e. its version is at
+// least SubqueryMinVersion. The version of the prometheus compatible APIs without the build
+// information, or with their own versioning as Thanos, is unknown, so a subquery is run instead
+// and its bad_data error means the subqueries are not supported.
+func (ctx *Context) SupportsSubqueries(reqCtx context.Context) (bool, error) {
+	if info, err := ctx.BuildInfo(reqCtx); err == nil {
+		if version, ok := parseVersion(info.Version); ok && version[0] >= 2 {
+			min, _ := parseVersion(SubqueryMinVersion)
+			return compareVersions(version, min) >= 0, nil
+		}
+	}
+
+	_, err := ctx.QuerySyncWithContext(reqCtx, subqueryProbe)
+	if err == nil {
+		return true, nil
+	}
+
+	var pe PrometheusError
+	if errors.As(err, &pe) && pe.Type == ErrorTypeBadData {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("checking the subqueries of prometheus: %w", err)
+}
+
+// parseVersion parses the major, minor and patch of the version, e.g. 2.30.3 or v2.7.0-rc.0
+func parseVersion(version string) ([3]int, bool) {
+	var v [3]int
+
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return v, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v[i] = n
+	}
+
+	return v, true
+}
+
+// compareVersions returns -1, 0 or 1 if x is lower than, equal to or greater than y
+func compareVersions(x, y [3]int) int {
+	for i := range x {
+		if x[i] < y[i] {
+			return -1
+		}
+		if x[i] > y[i] {
+			return 1
+		}
+	}
+
+	return 0
+}
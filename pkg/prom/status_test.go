@@ -0,0 +1,153 @@
+package prom
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStatusAPIs(t *testing.T) {
+	responses := map[string]string{
+		"/api/v1/targets": `{"status":"success","data":{"activeTargets":[
+			{"labels":{"job":"kubelet","instance":"node-0"},"scrapeUrl":"https://node-0:10250/metrics","health":"up","lastScrape":"2021-10-01T00:00:00Z"},
+			{"labels":{"job":"kubelet","instance":"node-1"},"scrapeUrl":"https://node-1:10250/metrics","health":"down","lastError":"connection refused"}],
+			"droppedTargets":[]}}`,
+		"/api/v1/rules": `{"status":"success","data":{"groups":[{"name":"node","file":"node.yaml","interval":30,"rules":[
+			{"type":"recording","name":"instance:node_cpu:rate5m","query":"rate(node_cpu_seconds_total[5m])","health":"ok"},
+			{"type":"alerting","name":"NodeDown","query":"up == 0","duration":300,"state":"firing","alerts":[{"labels":{"instance":"node-1"},"state":"firing","value":"0e+00"}]}]}]}}`,
+		"/api/v1/alerts":             `{"status":"success","data":{"alerts":[{"labels":{"alertname":"NodeDown"},"state":"firing","activeAt":"2021-10-01T00:00:00Z","value":"0e+00"}]}}`,
+		"/api/v1/status/buildinfo":   `{"status":"success","data":{"version":"2.30.3","revision":"f29caccc","branch":"HEAD","goVersion":"go1.17.1"}}`,
+		"/api/v1/status/flags":       `{"status":"success","data":{"query.timeout":"2m","storage.tsdb.retention.time":"15d"}}`,
+		"/api/v1/status/tsdb":        `{"status":"success","data":{"headStats":{"numSeries":508,"chunkCount":937},"seriesCountByMetricName":[{"name":"up","value":3}]}}`,
+		"/api/v1/status/runtimeinfo": `{"status":"success","data":{"startTime":"2021-10-01T00:00:00Z","reloadConfigSuccess":true,"goroutineCount":48,"GOMAXPROCS":4,"storageRetention":"15d"}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(responses[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, false, nil)
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+	ctx := NewContext(client)
+	reqCtx := context.Background()
+
+	targets, err := ctx.Targets(reqCtx, TargetStateActive)
+	if err != nil || len(targets.Active) != 2 || targets.Active[0].LastScrape.IsZero() {
+		t.Fatalf("expected the targets, got %v %v", targets, err)
+	}
+	if up, down := targets.Healthy("kubelet"); len(up) != 1 || len(down) != 1 || down[0].LastError != "connection refused" {
+		t.Errorf("expected 1 target up and 1 down, got %v %v", up, down)
+	}
+
+	rules, err := ctx.Rules(reqCtx, "")
+	if err != nil || len(rules.Groups) != 1 || len(rules.Groups[0].Rules) != 2 {
+		t.Fatalf("expected the rules, got %v %v", rules, err)
+	}
+	if rule := rules.Groups[0].Rules[1]; rule.Type != RuleTypeAlerting || rule.Duration != 300 || len(rule.Alerts) != 1 {
+		t.Errorf("expected the alerting rule, got %+v", rule)
+	}
+
+	alerts, err := ctx.Alerts(reqCtx)
+	if err != nil || len(alerts.Alerts) != 1 || alerts.Alerts[0].ActiveAt == nil {
+		t.Errorf("expected the alerts, got %v %v", alerts, err)
+	}
+
+	info, err := ctx.BuildInfo(reqCtx)
+	if err != nil || info.Version != "2.30.3" {
+		t.Errorf("expected the build info, got %v %v", info, err)
+	}
+
+	flags, err := ctx.Flags(reqCtx)
+	if err != nil || flags["query.timeout"] != "2m" {
+		t.Errorf("expected the flags, got %v %v", flags, err)
+	}
+
+	tsdb, err := ctx.TSDB(reqCtx)
+	if err != nil || tsdb.HeadStats.NumSeries != 508 || len(tsdb.SeriesCountByMetricName) != 1 {
+		t.Errorf("expected the tsdb status, got %v %v", tsdb, err)
+	}
+
+	runtime, err := ctx.RuntimeInfo(reqCtx)
+	if err != nil || !runtime.ReloadConfigSuccess || runtime.GOMAXPROCS != 4 {
+		t.Errorf("expected the runtime info, got %v %v", runtime, err)
+	}
+}
+
+func TestSupportsSubqueries(t *testing.T) {
+	testCases := map[string]struct {
+		buildInfo string
+		probe     string
+		expected  bool
+	}{
+		"prometheus 2.30": {
+			buildInfo: `{"status":"success","data":{"version":"2.30.3"}}`,
+			expected:  true,
+		},
+		"prometheus 2.6": {
+			buildInfo: `{"status":"success","data":{"version":"2.6.1"}}`,
+			expected:  false,
+		},
+		"thanos": {
+			buildInfo: `{"status":"success","data":{"version":"0.23.1"}}`,
+			probe:     `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+			expected:  true,
+		},
+		"no build info": {
+			probe:    `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+			expected: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.URL.Path == "/api/v1/status/buildinfo" && tc.buildInfo != "":
+					_, _ = w.Write([]byte(tc.buildInfo))
+				case r.URL.Path == "/api/v1/query" && tc.probe != "":
+					_, _ = w.Write([]byte(tc.probe))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, false, nil)
+			if err != nil {
+				t.Fatalf("NewPrometheusClient failed %s", err.Error())
+			}
+
+			ok, err := NewContext(client).SupportsSubqueries(context.Background())
+			if err != nil || ok != tc.expected {
+				t.Errorf("expected %v, got %v %v", tc.expected, ok, err)
+			}
+		})
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	testCases := map[string]struct {
+		version  string
+		expected [3]int
+		ok       bool
+	}{
+		"release":    {version: "2.30.3", expected: [3]int{2, 30, 3}, ok: true},
+		"prefix":     {version: "v2.7.0-rc.0", expected: [3]int{2, 7, 0}, ok: true},
+		"build":      {version: "2.7.0+build", expected: [3]int{2, 7, 0}, ok: true},
+		"incomplete": {version: "2.7"},
+		"invalid":    {version: "main"},
+	}
+
+	for name, tc := range testCases {
+		version, ok := parseVersion(tc.version)
+		if ok != tc.ok || (ok && version != tc.expected) {
+			t.Errorf("%s: expected %v %v, got %v %v", name, tc.expected, tc.ok, version, ok)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package prom
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	prometheusapi "github.com/prometheus/client_golang/api"
+)
+
+// streamClient is implemented by the clients which return the response before its body is read, so
+// the body is decoded while it is received. The caller must close the body of the response.
+type streamClient interface {
+	DoStream(ctx context.Context, req *http.Request) (*http.Response, error)
+}
+
+// doStream sends the request with DoStream if the client supports it, otherwise the body read by Do
+// is returned as the body of the response. The caller must close the body of the response.
+func doStream(client prometheusapi.Client, ctx context.Context, req *http.Request) (*http.Response, error) {
+	if sc, ok := client.(streamClient); ok {
+		return sc.DoStream(ctx, req)
+	}
+
+	res, body, err := client.Do(ctx, req)
+	if res != nil {
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	return res, err
+}
+
+// httpClient returns the http client of the config as built by prometheusapi.NewClient
+func httpClient(config prometheusapi.Config) *http.Client {
+	rt := config.RoundTripper
+	if rt == nil {
+		rt = prometheusapi.DefaultRoundTripper
+	}
+
+	return &http.Client{Transport: rt}
+}
+
+// hookedBody is a response body which calls onClose once it is closed
+type hookedBody struct {
+	io.ReadCloser
+
+	once    sync.Once
+	onClose func()
+}
+
+func (b *hookedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.onClose)
+	return err
+}
+
+// onBodyClose calls onClose once the body of the response is closed
+func onBodyClose(res *http.Response, onClose func()) {
+	res.Body = &hookedBody{ReadCloser: res.Body, onClose: onClose}
+}
+
+// readBody reads and closes the body of the response, nil if there is no response. The read fails
+// with the error of reqCtx once it is done, as for the body read by prometheusapi.Client.
+func readBody(reqCtx context.Context, res *http.Response) ([]byte, error) {
+	if res == nil {
+		return nil, nil
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil && reqCtx.Err() != nil {
+		err = reqCtx.Err()
+	}
+
+	return body, err
+}
+
+// errorReader records the last error of the reads other than io.EOF, so a response body which fails
+// to be read while it is decoded is told apart from an invalid one
+type errorReader struct {
+	r   io.Reader
+	err error
+}
+
+func (er *errorReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+	if err != nil && err != io.EOF {
+		er.err = err
+	}
+
+	return n, err
+}
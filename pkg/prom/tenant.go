@@ -0,0 +1,85 @@
+package prom
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const (
+	// TenantHeader is the header used by Cortex, Mimir and Thanos to select the tenant of a request
+	TenantHeader = "X-Scope-OrgID"
+	// TenantSeparator separates the tenants of a request which queries several tenants
+	TenantSeparator = "|"
+)
+
+// TenantID returns the tenant header value which queries all the tenants
+func TenantID(tenants ...string) string {
+	return strings.Join(tenants, TenantSeparator)
+}
+
+// queryHeadersKey is the context key of the per-query headers
+type queryHeadersKey struct{}
+
+// WithQueryTenant returns a copy of reqCtx which sends the queries made with it to the tenants,
+// overriding the tenant of the prom.Context and of the client.
+func WithQueryTenant(reqCtx context.Context, tenants ...string) context.Context {
+	return WithQueryHeader(reqCtx, TenantHeader, TenantID(tenants...))
+}
+
+// WithQueryHeader returns a copy of reqCtx which sets the header on the queries made with it,
+// overriding the headers of the prom.Context and of the client.
+func WithQueryHeader(reqCtx context.Context, key, value string) context.Context {
+	headers := queryHeaders(reqCtx).Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set(key, value)
+
+	return context.WithValue(reqCtx, queryHeadersKey{}, headers)
+}
+
+// queryHeaders returns the per-query headers of reqCtx, nil if there are none
+func queryHeaders(reqCtx context.Context) http.Header {
+	headers, _ := reqCtx.Value(queryHeadersKey{}).(http.Header)
+	return headers
+}
+
+// setHeaders sets the headers on the request, replacing the existing values
+func setHeaders(req *http.Request, headers http.Header) {
+	for k, vs := range headers {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+}
+
+// setDefaultHeaders sets the headers which are not already set on the request
+func setDefaultHeaders(req *http.Request, headers http.Header) {
+	for k, vs := range headers {
+		if _, ok := req.Header[k]; !ok {
+			req.Header[k] = append([]string(nil), vs...)
+		}
+	}
+}
+
+type headersClient interface {
+	Headers() http.Header
+}
+
+// headersFor returns the headers the client sets on the requests which don't set them already, nil
+// if the client doesn't set headers
+func headersFor(client interface{}) http.Header {
+	if hc, ok := client.(headersClient); ok {
+		return hc.Headers()
+	}
+
+	return nil
+}
+
+// requestTenant returns the tenant header sent with the request, empty if the request is nil
+func requestTenant(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+
+	return req.Header.Get(TenantHeader)
+}
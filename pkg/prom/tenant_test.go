@@ -0,0 +1,114 @@
+package prom
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	prometheusapi "github.com/prometheus/client_golang/api"
+)
+
+func TestTenantHeaders(t *testing.T) {
+	// the server records the tenant and extra header of every query, and rejects the "bad" tenant
+	var m sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		requests = append(requests, r.Header.Get(TenantHeader)+" "+r.Header.Get("X-Extra"))
+		m.Unlock()
+
+		if r.Header.Get(TenantHeader) == "bad" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("no org id"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer server.Close()
+
+	for _, rateLimit := range []bool{false, true} {
+		requests = nil
+
+		client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, rateLimit, nil,
+			WithTenant("default"), WithHeaders(map[string]string{"X-Extra": "client"}))
+		if err != nil {
+			t.Fatalf("NewPrometheusClient failed %s", err.Error())
+		}
+
+		if _, err := NewContext(client).QuerySync("up"); err != nil {
+			t.Fatalf("query failed %s", err.Error())
+		}
+
+		ctx := NewContext(client)
+		ctx.SetTenant("tenant1", "tenant2")
+		ctx.SetHeader("X-Extra", "context")
+		if _, err := ctx.QuerySync("up"); err != nil {
+			t.Fatalf("query failed %s", err.Error())
+		}
+
+		reqCtx := WithQueryHeader(WithQueryTenant(context.Background(), "tenant3"), "X-Extra", "query")
+		if _, err := ctx.QuerySyncWithContext(reqCtx, "up"); err != nil {
+			t.Fatalf("query failed %s", err.Error())
+		}
+
+		// the context is not changed by the per-query headers
+		if _, err := ctx.QuerySync("up"); err != nil {
+			t.Fatalf("query failed %s", err.Error())
+		}
+
+		expected := []string{"default client", "tenant1|tenant2 context", "tenant3 query", "tenant1|tenant2 context"}
+		if strings.Join(requests, ",") != strings.Join(expected, ",") {
+			t.Errorf("expected requests %v, got %v", expected, requests)
+		}
+
+		// the errors of one tenant are collected with the tenant
+		_, _ = ctx.QueryWithContext(WithQueryTenant(context.Background(), "bad"), "up").Await()
+		errs := ctx.Errors()
+		if len(errs) != 1 || errs[0].Tenant != "bad" || !strings.Contains(errs[0].String(), "for Tenant: bad") {
+			t.Errorf("expected the error of the bad tenant, got %v", errs)
+		}
+	}
+}
+
+func TestTenantHeaders_ClientTenantErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(TenantHeader) != "bad" {
+			t.Errorf("unexpected tenant %q", r.Header.Get(TenantHeader))
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("no org id"))
+	}))
+	defer server.Close()
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, true, nil, WithTenant("bad"))
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+	failover, err := NewFailoverClient([]prometheusapi.Client{client}, &FailoverConfig{})
+	if err != nil {
+		t.Fatalf("NewFailoverClient failed %s", err.Error())
+	}
+	defer failover.Close()
+
+	// the errors are collected with the tenant of the client, which is sent through the wrappers
+	for name, c := range map[string]prometheusapi.Client{"client": client, "failover": NewCircuitBreakerClient(failover, nil)} {
+		ctx := NewContext(c)
+		if _, err := ctx.QuerySync("up"); err == nil {
+			t.Errorf("%s: expected the query to fail", name)
+		}
+		_, _ = ctx.QueryRange("up", time.Unix(0, 0), time.Unix(60, 0), time.Minute).Await()
+
+		errs := ctx.Errors()
+		if len(errs) != 1 || errs[0].Tenant != "bad" {
+			t.Errorf("%s: expected the error of the bad tenant, got %v", name, errs)
+		}
+		if ctx.Tenant(context.Background()) != "bad" {
+			t.Errorf("%s: expected the bad tenant, got %q", name, ctx.Tenant(context.Background()))
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package prom
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// TLSConfig configures the TLS connections to prometheus. The certificate files are read again
+// when they change on disk, so rotated certificates are used for new connections without
+// rebuilding the client.
+type TLSConfig struct {
+	// CAFile is the PEM bundle of the CAs which verify the server, the system roots are used if empty
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key for mTLS
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the host name used to verify the server certificate, and sent for SNI
+	ServerName         string
+	InsecureSkipVerify bool
+	// MinVersion is the minimum TLS version, e.g. tls.VersionTLS12, the crypto/tls default if 0
+	MinVersion uint16
+}
+
+// newTLSConfig creates the tls.Config for the address, insecureSkipVerify skips the verification
+// in addition to the TLSConfig one.
+func newTLSConfig(config *TLSConfig, address string, insecureSkipVerify bool) (*tls.Config, error) {
+	if config == nil {
+		return &tls.Config{InsecureSkipVerify: insecureSkipVerify}, nil
+	}
+
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, fmt.Errorf("client certificate needs both cert file and key file")
+	}
+
+	serverName := config.ServerName
+	if serverName == "" {
+		if u, err := url.Parse(address); err == nil {
+			serverName = u.Hostname()
+		}
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecureSkipVerify || config.InsecureSkipVerify,
+		MinVersion:         config.MinVersion,
+	}
+
+	if config.CertFile != "" {
+		cert := &reloadingFile{paths: []string{config.CertFile, config.KeyFile}, load: loadKeyPair}
+		if _, err := cert.Get(); err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			v, err := cert.Get()
+			if err != nil {
+				return nil, err
+			}
+			return v.(*tls.Certificate), nil
+		}
+	}
+
+	if config.CAFile != "" && !tlsConfig.InsecureSkipVerify {
+		ca := &reloadingFile{paths: []string{config.CAFile}, load: loadCertPool}
+		if _, err := ca.Get(); err != nil {
+			return nil, err
+		}
+
+		// the default verification can't reload the CAs, so it is replaced by the same verification
+		// against the current CA pool
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			v, err := ca.Get()
+			if err != nil {
+				return err
+			}
+			return verifyPeerCertificate(rawCerts, v.(*x509.CertPool), serverName)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// verifyPeerCertificate verifies the server certificate chain against the roots and the server name
+func verifyPeerCertificate(rawCerts [][]byte, roots *x509.CertPool, serverName string) error {
+	if len(rawCerts) == 0 {
+		return errors.New("tls: server didn't provide a certificate")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("tls: failed to parse certificate from server: %w", err)
+		}
+		certs[i] = cert
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       serverName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+func loadKeyPair(paths []string) (interface{}, error) {
+	cert, err := tls.LoadX509KeyPair(paths[0], paths[1])
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate %s failed: %w", paths[0], err)
+	}
+
+	return &cert, nil
+}
+
+func loadCertPool(paths []string) (interface{}, error) {
+	pem, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		return nil, fmt.Errorf("read CA file failed: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificate found in %s", paths[0])
+	}
+
+	return pool, nil
+}
+
+// reloadingFile caches the value loaded from the files, and loads it again when the modification
+// time of any of the files changes
+type reloadingFile struct {
+	paths []string
+	load  func(paths []string) (interface{}, error)
+
+	m       sync.Mutex
+	modTime []time.Time
+	value   interface{}
+}
+
+// Get returns the value loaded from the current files. The previous value is kept if the files
+// can't be loaded, e.g. while the cert and key files are replaced one by one.
+func (rf *reloadingFile) Get() (interface{}, error) {
+	rf.m.Lock()
+	defer rf.m.Unlock()
+
+	modTime := make([]time.Time, len(rf.paths))
+	for i, path := range rf.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			if rf.value != nil {
+				return rf.value, nil
+			}
+			return nil, err
+		}
+		modTime[i] = info.ModTime()
+	}
+
+	if rf.value != nil && timesEqual(modTime, rf.modTime) {
+		return rf.value, nil
+	}
+
+	value, err := rf.load(rf.paths)
+	if err != nil {
+		if rf.value != nil {
+			klog.Warningf("reload %v failed, keep the previous one, err %s", rf.paths, err.Error())
+			return rf.value, nil
+		}
+		return nil, err
+	}
+
+	rf.value = value
+	rf.modTime = modTime
+	return value, nil
+}
+
+func timesEqual(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
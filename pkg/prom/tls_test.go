@@ -0,0 +1,219 @@
+package prom
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCA issues the certificates of the tls tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed %s", err.Error())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create ca failed %s", err.Error())
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key for the common name, a server certificate if dnsName is set
+func (ca *testCA) issue(t *testing.T, commonName string, dnsName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed %s", err.Error())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if dnsName != "" {
+		template.DNSNames = []string{dnsName}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate failed %s", err.Error())
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key failed %s", err.Error())
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func writeTestFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write %s failed %s", path, err.Error())
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes %s failed %s", path, err.Error())
+	}
+}
+
+func TestTLSConfig_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "prometheus", "prometheus.test")
+	keyPair, err := tls.X509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatalf("load server key pair failed %s", err.Error())
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	// the server records the client certificates, and closes the connections so every request handshakes
+	var m sync.Mutex
+	var clients []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		clients = append(clients, r.TLS.PeerCertificates[0].Subject.CommonName)
+		m.Unlock()
+		w.Header().Set("Connection", "close")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "prom-tls")
+	if err != nil {
+		t.Fatalf("create temp dir failed %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	config := &TLSConfig{
+		CAFile:     filepath.Join(dir, "ca.pem"),
+		CertFile:   filepath.Join(dir, "client.pem"),
+		KeyFile:    filepath.Join(dir, "client-key.pem"),
+		ServerName: "prometheus.test",
+		MinVersion: tls.VersionTLS12,
+	}
+	modTime := time.Now().Add(-time.Minute)
+	clientCert, clientKey := ca.issue(t, "client-1", "")
+	writeTestFile(t, config.CAFile, ca.pem, modTime)
+	writeTestFile(t, config.CertFile, clientCert, modTime)
+	writeTestFile(t, config.KeyFile, clientKey, modTime)
+
+	query := func(config *TLSConfig) error {
+		client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, false, &ClientAuth{}, WithTLSConfig(config))
+		if err != nil {
+			return err
+		}
+		_, err = NewContext(client).QuerySync("up")
+		return err
+	}
+
+	client, err := NewPrometheusClient(server.URL, 10*time.Second, 10*time.Second, 1, false, false, &ClientAuth{}, WithTLSConfig(config))
+	if err != nil {
+		t.Fatalf("NewPrometheusClient failed %s", err.Error())
+	}
+	ctx := NewContext(client)
+	if _, err := ctx.QuerySync("up"); err != nil {
+		t.Fatalf("mTLS query failed %s", err.Error())
+	}
+
+	// rotate the client certificate without rebuilding the client
+	clientCert, clientKey = ca.issue(t, "client-2", "")
+	writeTestFile(t, config.CertFile, clientCert, modTime.Add(time.Second))
+	writeTestFile(t, config.KeyFile, clientKey, modTime.Add(time.Second))
+	if _, err := ctx.QuerySync("up"); err != nil {
+		t.Fatalf("mTLS query after rotation failed %s", err.Error())
+	}
+
+	m.Lock()
+	if len(clients) != 2 || clients[0] != "client-1" || clients[1] != "client-2" {
+		t.Errorf("expected the rotated client certificate, got %v", clients)
+	}
+	m.Unlock()
+
+	// the server name must match the server certificate
+	wrongName := *config
+	wrongName.ServerName = "other.test"
+	if err := query(&wrongName); err == nil {
+		t.Errorf("expected the verification to fail for the wrong server name")
+	}
+
+	// the server must be verified by the CA
+	otherCA := newTestCA(t)
+	wrongCA := *config
+	wrongCA.CAFile = filepath.Join(dir, "other-ca.pem")
+	writeTestFile(t, wrongCA.CAFile, otherCA.pem, modTime)
+	if err := query(&wrongCA); err == nil {
+		t.Errorf("expected the verification to fail for the wrong CA")
+	}
+
+	// the server requires a client certificate
+	noCert := *config
+	noCert.CertFile, noCert.KeyFile = "", ""
+	if err := query(&noCert); err == nil {
+		t.Errorf("expected the handshake to fail without client certificate")
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	config, err := newTLSConfig(&TLSConfig{}, "https://prometheus.monitoring:9090", false)
+	if err != nil {
+		t.Fatalf("newTLSConfig failed %s", err.Error())
+	}
+	if config.ServerName != "prometheus.monitoring" || config.InsecureSkipVerify {
+		t.Errorf("expected the server name from the address, got %+v", config)
+	}
+
+	if _, err := newTLSConfig(&TLSConfig{CertFile: "client.pem"}, "https://prometheus", false); err == nil {
+		t.Errorf("expected an error for a cert file without key file")
+	}
+	if _, err := newTLSConfig(&TLSConfig{CAFile: "missing.pem"}, "https://prometheus", false); err == nil {
+		t.Errorf("expected an error for a missing CA file")
+	}
+
+	// the legacy insecureSkipVerify argument still applies, and skips the CA verification
+	config, err = newTLSConfig(&TLSConfig{CAFile: "missing.pem"}, "https://prometheus", true)
+	if err != nil || !config.InsecureSkipVerify || config.VerifyPeerCertificate != nil {
+		t.Errorf("expected the verification skipped, got %v", err)
+	}
+}
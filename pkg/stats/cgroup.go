@@ -0,0 +1,208 @@
+package stats
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultCgroupRoot = "/sys/fs/cgroup"
+)
+
+// cgroupMode is the way the cgroup hierarchies are mounted on the node
+type cgroupMode string
+
+const (
+	// cgroupModeLegacy is cgroup v1 only, each controller has its own hierarchy
+	cgroupModeLegacy cgroupMode = "legacy"
+	// cgroupModeHybrid is cgroup v1 for the controllers, with a cgroup v2 hierarchy without
+	// controllers mounted under unified
+	cgroupModeHybrid cgroupMode = "hybrid"
+	// cgroupModeUnified is cgroup v2 only, all the controllers are in the single hierarchy
+	cgroupModeUnified cgroupMode = "unified"
+)
+
+var (
+	// defaultPodCgroupParents are the cgroups pods are created under by the kubelet, for the
+	// cgroupfs and systemd drivers respectively
+	defaultPodCgroupParents = []string{"/kubepods", "/kubepods.slice"}
+
+	// containerScopePrefixes are the prefixes the container runtimes add to the container
+	// cgroup name when using the systemd driver
+	containerScopePrefixes = []string{"docker-", "cri-containerd-", "crio-"}
+)
+
+// cgroupReader reads the resource usage of a cgroup, hiding the differences between cgroup versions
+type cgroupReader interface {
+	// Exists returns true if the cgroup exists
+	Exists(cgroup string) bool
+
+	// CpuUsage returns the cumulative cpu time consumed by the cgroup, in nanoseconds
+	CpuUsage(cgroup string) (uint64, error)
+
+	// MemoryUsage returns the memory usage of the cgroup
+	MemoryUsage(cgroup string) (*ContainerMemory, error)
+
+	// IOUsage returns the cumulative block io of the cgroup
+	IOUsage(cgroup string) (*ContainerIO, error)
+
+	// CpuPressure returns the cpu pressure stall information of the cgroup, an error is returned if
+	// the cgroup version has no pressure stall information
+	CpuPressure(cgroup string) (*ContainerCpuPressure, error)
+}
+
+// detectCgroupMode detects the cgroup mode by the files under the cgroup mount root
+func detectCgroupMode(root string) cgroupMode {
+	if fileExists(filepath.Join(root, "cgroup.controllers")) {
+		return cgroupModeUnified
+	}
+
+	if fileExists(filepath.Join(root, "unified", "cgroup.controllers")) {
+		return cgroupModeHybrid
+	}
+
+	return cgroupModeLegacy
+}
+
+// newCgroupReader creates the cgroupReader for the cgroup mode of the node. The controllers are
+// still in the cgroup v1 hierarchies in hybrid mode, so the v1 reader is used.
+func newCgroupReader(root string) (cgroupReader, cgroupMode) {
+	mode := detectCgroupMode(root)
+	if mode == cgroupModeUnified {
+		return &cgroupV2{root: root}, mode
+	}
+
+	return &cgroupV1{root: root}, mode
+}
+
+// podCgroupCandidates returns the possible cgroups of the pod under the given parent, the
+// naming follows the kubelet cgroupfs or systemd driver depending on the parent name
+func podCgroupCandidates(parent string, pod *v1.Pod) []string {
+	qos := strings.ToLower(string(pod.Status.QOSClass))
+	if pod.Status.QOSClass == v1.PodQOSGuaranteed {
+		qos = ""
+	}
+
+	if !strings.HasSuffix(parent, ".slice") {
+		podName := "pod" + string(pod.UID)
+		if qos == "" {
+			return []string{path.Join(parent, podName)}
+		}
+		return []string{path.Join(parent, qos, podName)}
+	}
+
+	// systemd slices are nested, and each level repeats the names of the parents
+	prefix := strings.TrimSuffix(path.Base(parent), ".slice")
+	podName := "pod" + strings.Replace(string(pod.UID), "-", "_", -1)
+	if qos == "" {
+		return []string{path.Join(parent, fmt.Sprintf("%s-%s.slice", prefix, podName))}
+	}
+	return []string{path.Join(parent, fmt.Sprintf("%s-%s.slice", prefix, qos),
+		fmt.Sprintf("%s-%s-%s.slice", prefix, qos, podName))}
+}
+
+// containerCgroupCandidates returns the possible cgroups of the container under the pod cgroup
+func containerCgroupCandidates(podCgroup string, containerID string) []string {
+	// container id is in the format of <runtime>://<id>
+	if i := strings.Index(containerID, "://"); i >= 0 {
+		containerID = containerID[i+3:]
+	}
+	if containerID == "" {
+		return nil
+	}
+
+	candidates := []string{path.Join(podCgroup, containerID)}
+	for _, prefix := range containerScopePrefixes {
+		candidates = append(candidates, path.Join(podCgroup, prefix+containerID+".scope"))
+	}
+	return candidates
+}
+
+// workingSet returns the memory usage excluding the inactive file cache
+func workingSet(usage, inactiveFile uint64) uint64 {
+	if inactiveFile >= usage {
+		return 0
+	}
+
+	return usage - inactiveFile
+}
+
+func fileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// readUint64 reads a file containing a single unsigned integer
+func readUint64(file string) (uint64, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+}
+
+// readKeyValues reads a file with a "key value" pair on each line, such as memory.stat
+func readKeyValues(file string) (map[string]uint64, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s of %s failed: %s", fields[0], file, err.Error())
+		}
+		values[fields[0]] = v
+	}
+
+	return values, nil
+}
+
+// readNestedKeyed reads a file with a key followed by "subkey=value" pairs on each line, such as
+// io.stat and cpu.pressure
+func readNestedKeyed(file string) (map[string]map[string]float64, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]map[string]float64)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		nested := make(map[string]float64, len(fields)-1)
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("parse %s of %s failed: invalid field %q", fields[0], file, field)
+			}
+
+			v, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s %s of %s failed: %s", fields[0], kv[0], file, err.Error())
+			}
+			nested[kv[0]] = v
+		}
+		values[fields[0]] = nested
+	}
+
+	return values, nil
+}
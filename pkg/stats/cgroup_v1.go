@@ -0,0 +1,111 @@
+package stats
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	cgroupCpuacctSubsystem = "cpuacct"
+	cgroupMemorySubsystem  = "memory"
+	cgroupBlkioSubsystem   = "blkio"
+)
+
+// cgroupV1 reads the cgroup v1 hierarchies mounted under root, one for each subsystem
+type cgroupV1 struct {
+	root string
+}
+
+// subsystemPath returns the absolute path of the cgroup in the given subsystem
+func (c *cgroupV1) subsystemPath(subsystem, cgroup string) string {
+	return filepath.Join(c.root, subsystem, cgroup)
+}
+
+// Exists returns true if the cgroup exists in the cpuacct hierarchy
+func (c *cgroupV1) Exists(cgroup string) bool {
+	return fileExists(c.subsystemPath(cgroupCpuacctSubsystem, cgroup))
+}
+
+// CpuUsage returns the cumulative cpu time consumed by the cgroup, in nanoseconds
+func (c *cgroupV1) CpuUsage(cgroup string) (uint64, error) {
+	return readUint64(filepath.Join(c.subsystemPath(cgroupCpuacctSubsystem, cgroup), "cpuacct.usage"))
+}
+
+// MemoryUsage returns the memory usage of the cgroup
+func (c *cgroupV1) MemoryUsage(cgroup string) (*ContainerMemory, error) {
+	dir := c.subsystemPath(cgroupMemorySubsystem, cgroup)
+
+	usage, err := readUint64(filepath.Join(dir, "memory.usage_in_bytes"))
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := readKeyValues(filepath.Join(dir, "memory.stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContainerMemory{
+		UsageTotal: float64(usage),
+		WorkingSet: float64(workingSet(usage, stat["total_inactive_file"])),
+		UsageRss:   float64(stat["total_rss"]),
+		UsageCache: float64(stat["total_cache"]),
+	}, nil
+}
+
+// IOUsage returns the cumulative block io of the cgroup, summed over the devices of the blkio
+// throttle stats, which are accounted for all the io schedulers
+func (c *cgroupV1) IOUsage(cgroup string) (*ContainerIO, error) {
+	dir := c.subsystemPath(cgroupBlkioSubsystem, cgroup)
+
+	bytes, err := readBlkioStats(filepath.Join(dir, "blkio.throttle.io_service_bytes"))
+	if err != nil {
+		return nil, err
+	}
+
+	ios, err := readBlkioStats(filepath.Join(dir, "blkio.throttle.io_serviced"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContainerIO{
+		ReadBytes:  bytes["Read"],
+		WriteBytes: bytes["Write"],
+		ReadIOs:    ios["Read"],
+		WriteIOs:   ios["Write"],
+	}, nil
+}
+
+// CpuPressure returns an error, the pressure stall information is only available with cgroup v2
+func (c *cgroupV1) CpuPressure(cgroup string) (*ContainerCpuPressure, error) {
+	return nil, fmt.Errorf("cpu pressure of %s not supported by cgroup v1", cgroup)
+}
+
+// readBlkioStats reads a blkio stats file with a "major:minor operation value" line for each device
+// and operation, and returns the values of each operation summed over the devices
+func readBlkioStats(file string) (map[string]float64, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]float64)
+	for _, line := range strings.Split(string(content), "\n") {
+		// the last line is the total of all the devices and operations
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+
+		v, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s %s of %s failed: %s", fields[0], fields[1], file, err.Error())
+		}
+		values[fields[1]] += float64(v)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,101 @@
+package stats
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// cgroupV2 reads the cgroup v2 unified hierarchy mounted under root
+type cgroupV2 struct {
+	root string
+}
+
+// Exists returns true if the cgroup exists
+func (c *cgroupV2) Exists(cgroup string) bool {
+	return fileExists(filepath.Join(c.root, cgroup))
+}
+
+// CpuUsage returns the cumulative cpu time consumed by the cgroup, in nanoseconds
+func (c *cgroupV2) CpuUsage(cgroup string) (uint64, error) {
+	file := filepath.Join(c.root, cgroup, "cpu.stat")
+	stat, err := readKeyValues(file)
+	if err != nil {
+		return 0, err
+	}
+
+	usage, ok := stat["usage_usec"]
+	if !ok {
+		return 0, fmt.Errorf("usage_usec not found in %s", file)
+	}
+
+	return usage * 1000, nil
+}
+
+// MemoryUsage returns the memory usage of the cgroup
+func (c *cgroupV2) MemoryUsage(cgroup string) (*ContainerMemory, error) {
+	dir := filepath.Join(c.root, cgroup)
+
+	usage, err := readUint64(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := readKeyValues(filepath.Join(dir, "memory.stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContainerMemory{
+		UsageTotal: float64(usage),
+		WorkingSet: float64(workingSet(usage, stat["inactive_file"])),
+		UsageRss:   float64(stat["anon"]),
+		UsageCache: float64(stat["file"]),
+	}, nil
+}
+
+// IOUsage returns the cumulative block io of the cgroup, summed over the devices of io.stat
+func (c *cgroupV2) IOUsage(cgroup string) (*ContainerIO, error) {
+	stat, err := readNestedKeyed(filepath.Join(c.root, cgroup, "io.stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	io := &ContainerIO{}
+	for _, device := range stat {
+		io.ReadBytes += device["rbytes"]
+		io.WriteBytes += device["wbytes"]
+		io.ReadIOs += device["rios"]
+		io.WriteIOs += device["wios"]
+	}
+
+	return io, nil
+}
+
+// CpuPressure returns the cpu pressure stall information of the cgroup
+func (c *cgroupV2) CpuPressure(cgroup string) (*ContainerCpuPressure, error) {
+	file := filepath.Join(c.root, cgroup, "cpu.pressure")
+	pressure, err := readNestedKeyed(file)
+	if err != nil {
+		return nil, err
+	}
+
+	some, ok := pressure["some"]
+	if !ok {
+		return nil, fmt.Errorf("some not found in %s", file)
+	}
+
+	// full is only reported for cpu since linux 5.13
+	return &ContainerCpuPressure{
+		Some: pressureStats(some),
+		Full: pressureStats(pressure["full"]),
+	}, nil
+}
+
+func pressureStats(values map[string]float64) PressureStats {
+	return PressureStats{
+		Avg10:  values["avg10"],
+		Avg60:  values["avg60"],
+		Avg300: values["avg300"],
+		Total:  values["total"],
+	}
+}
@@ -0,0 +1,215 @@
+package stats
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/types"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// cgroupEntry keeps the samples of a pod or container cgroup, along with the last cpu usage
+// used to calculate the cpu rate
+type cgroupEntry struct {
+	cgroup   string
+	lastCpu  uint64
+	lastTime time.Time
+	stats    *statsStore
+}
+
+// containerCollector samples the cpu and memory usage of the pods on the node, and the containers
+// in them, from the cgroup hierarchy
+type containerCollector struct {
+	reader        cgroupReader
+	parents       []string
+	collectCpu    bool
+	collectMemory bool
+	collectIO     bool
+	// collectCpuPressure is only supported by cgroup v2
+	collectCpuPressure bool
+	ttl                time.Duration
+
+	m       sync.RWMutex
+	entries map[string]*cgroupEntry
+}
+
+// newContainerCollector creates a containerCollector. config.Cgroups are the parent cgroups the
+// pods are created under, and config.Resources are the resources to collect, both of which fall
+// back to the defaults if empty. All the resources supported by the cgroup mode are collected by
+// default.
+func newContainerCollector(root string, config types.MetricsContainerConfig, ttl time.Duration) *containerCollector {
+	reader, mode := newCgroupReader(root)
+	klog.Infof("cgroup mode of %s is %s", root, mode)
+
+	cc := &containerCollector{
+		reader:  reader,
+		parents: config.Cgroups,
+		ttl:     ttl,
+		entries: make(map[string]*cgroupEntry),
+	}
+	if len(cc.parents) == 0 {
+		cc.parents = defaultPodCgroupParents
+	}
+
+	if len(config.Resources) == 0 {
+		cc.collectCpu, cc.collectMemory, cc.collectIO = true, true, true
+		cc.collectCpuPressure = mode == cgroupModeUnified
+	}
+	for _, r := range config.Resources {
+		switch types.MetricKind(r) {
+		case types.CpuUsageMetrics:
+			cc.collectCpu = true
+		case types.MemoryUsageMetrics:
+			cc.collectMemory = true
+		case types.IOUsageMetrics:
+			cc.collectIO = true
+		case types.CpuPressureMetrics:
+			if mode != cgroupModeUnified {
+				klog.Warningf("container stats not support resource %s in cgroup mode %s, ignored", r, mode)
+				continue
+			}
+			cc.collectCpuPressure = true
+		default:
+			klog.Warningf("container stats not support resource %s, ignored", r)
+		}
+	}
+
+	return cc
+}
+
+// Collect samples the cgroups of the given pods, the samples of the pods not in the list are dropped
+func (cc *containerCollector) Collect(now time.Time, pods []*v1.Pod) {
+	cc.m.RLock()
+	last := cc.entries
+	cc.m.RUnlock()
+
+	entries := make(map[string]*cgroupEntry)
+	for _, pod := range pods {
+		podCgroup, ok := cc.findPodCgroup(pod)
+		if !ok {
+			klog.V(4).Infof("cgroup of pod %s/%s not found", pod.Namespace, pod.Name)
+			continue
+		}
+
+		key := podKey(pod.Namespace, pod.Name)
+		entries[key] = cc.collectEntry(now, last[key], key, podCgroup)
+
+		for _, status := range pod.Status.ContainerStatuses {
+			containerCgroup, ok := cc.findCgroup(containerCgroupCandidates(podCgroup, status.ContainerID))
+			if !ok {
+				continue
+			}
+
+			key := containerKey(pod.Namespace, pod.Name, status.Name)
+			entries[key] = cc.collectEntry(now, last[key], key, containerCgroup)
+		}
+	}
+
+	cc.m.Lock()
+	cc.entries = entries
+	cc.m.Unlock()
+}
+
+// Get returns the stats of the pod or container with the given key
+func (cc *containerCollector) Get(key string) (ContainerStats, error) {
+	cc.m.RLock()
+	defer cc.m.RUnlock()
+
+	entry, ok := cc.entries[key]
+	if !ok {
+		return nil, fmt.Errorf("no stats collected for %s", key)
+	}
+
+	return entry.stats, nil
+}
+
+// collectEntry samples the cgroup, reusing the last entry if the cgroup has not changed
+func (cc *containerCollector) collectEntry(now time.Time, entry *cgroupEntry, key, cgroup string) *cgroupEntry {
+	// the container may be restarted with the same name, start over in that case
+	if entry == nil || entry.cgroup != cgroup {
+		entry = &cgroupEntry{
+			cgroup: cgroup,
+			stats:  newStatsStore(key, cc.ttl),
+		}
+	}
+
+	if cc.collectCpu {
+		usage, err := cc.reader.CpuUsage(cgroup)
+		if err != nil {
+			klog.Errorf("collect cpu of %s failed, err %s", key, err.Error())
+		} else {
+			if !entry.lastTime.IsZero() && usage >= entry.lastCpu && now.After(entry.lastTime) {
+				entry.stats.cpu.Add(now, &ContainerCpu{
+					CpuUsage:  float64(usage-entry.lastCpu) / float64(now.Sub(entry.lastTime).Nanoseconds()),
+					Timestamp: now,
+				})
+			}
+			entry.lastCpu, entry.lastTime = usage, now
+		}
+	}
+
+	if cc.collectMemory {
+		memory, err := cc.reader.MemoryUsage(cgroup)
+		if err != nil {
+			klog.Errorf("collect memory of %s failed, err %s", key, err.Error())
+		} else {
+			memory.Timestamp = now
+			entry.stats.memory.Add(now, memory)
+		}
+	}
+
+	if cc.collectIO {
+		io, err := cc.reader.IOUsage(cgroup)
+		if err != nil {
+			klog.Errorf("collect io of %s failed, err %s", key, err.Error())
+		} else {
+			io.Timestamp = now
+			entry.stats.io.Add(now, io)
+		}
+	}
+
+	if cc.collectCpuPressure {
+		pressure, err := cc.reader.CpuPressure(cgroup)
+		if err != nil {
+			klog.Errorf("collect cpu pressure of %s failed, err %s", key, err.Error())
+		} else {
+			pressure.Timestamp = now
+			entry.stats.cpuPressure.Add(now, pressure)
+		}
+	}
+
+	return entry
+}
+
+// findPodCgroup returns the cgroup of the pod under the first parent it exists in
+func (cc *containerCollector) findPodCgroup(pod *v1.Pod) (string, bool) {
+	for _, parent := range cc.parents {
+		if cgroup, ok := cc.findCgroup(podCgroupCandidates(parent, pod)); ok {
+			return cgroup, true
+		}
+	}
+
+	return "", false
+}
+
+// findCgroup returns the first existing cgroup of the candidates
+func (cc *containerCollector) findCgroup(candidates []string) (string, bool) {
+	for _, cgroup := range candidates {
+		if cc.reader.Exists(cgroup) {
+			return cgroup, true
+		}
+	}
+
+	return "", false
+}
+
+func podKey(namespace, podName string) string {
+	return namespace + "/" + podName
+}
+
+func containerKey(namespace, podName, containerName string) string {
+	return namespace + "/" + podName + "/" + containerName
+}
@@ -0,0 +1,276 @@
+package stats
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/types"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// copyFixture copies the fixture directory to a temporary directory, so the test can modify it
+func copyFixture(t *testing.T, fixture string) string {
+	dir, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatalf("create temp dir failed %s", err.Error())
+	}
+
+	err = filepath.Walk(fixture, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(fixture, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, rel), 0755)
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dir, rel), content, 0644)
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("copy fixture %s failed %s", fixture, err.Error())
+	}
+
+	return dir
+}
+
+func writeFixtureFile(t *testing.T, root, file, content string) {
+	if err := ioutil.WriteFile(filepath.Join(root, file), []byte(content), 0644); err != nil {
+		t.Fatalf("write %s failed %s", file, err.Error())
+	}
+}
+
+func newTestPods() []*v1.Pod {
+	return []*v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "burstable", UID: "1b2c3d4e-0000-0000-0000-000000000001"},
+			Status: v1.PodStatus{
+				QOSClass:          v1.PodQOSBurstable,
+				ContainerStatuses: []v1.ContainerStatus{{Name: "app", ContainerID: "docker://abc123"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "guaranteed", UID: "1b2c3d4e-0000-0000-0000-000000000002"},
+			Status: v1.PodStatus{
+				QOSClass:          v1.PodQOSGuaranteed,
+				ContainerStatuses: []v1.ContainerStatus{{Name: "app", ContainerID: "containerd://def456"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "missing", UID: "1b2c3d4e-0000-0000-0000-000000000003"},
+			Status:     v1.PodStatus{QOSClass: v1.PodQOSBestEffort},
+		},
+	}
+}
+
+func getContainerCpu(t *testing.T, cc *containerCollector, key string) float64 {
+	cs, err := cc.Get(key)
+	if err != nil {
+		t.Fatalf("Get %s failed %s", key, err.Error())
+	}
+
+	result, err := cs.GetResourceStats(types.CpuUsageMetrics)
+	if err != nil {
+		t.Fatalf("GetResourceStats cpu of %s failed %s", key, err.Error())
+	}
+
+	return result.(*ContainerCpu).CpuUsage
+}
+
+func getContainerMemory(t *testing.T, cc *containerCollector, key string) *ContainerMemory {
+	cs, err := cc.Get(key)
+	if err != nil {
+		t.Fatalf("Get %s failed %s", key, err.Error())
+	}
+
+	result, err := cs.GetResourceStats(types.MemoryUsageMetrics)
+	if err != nil {
+		t.Fatalf("GetResourceStats memory of %s failed %s", key, err.Error())
+	}
+
+	return result.(*ContainerMemory)
+}
+
+func TestDetectCgroupMode(t *testing.T) {
+	testCases := map[string]cgroupMode{
+		"testdata/cgroupv1":      cgroupModeLegacy,
+		"testdata/cgroup-hybrid": cgroupModeHybrid,
+		"testdata/cgroupv2":      cgroupModeUnified,
+	}
+
+	for root, expected := range testCases {
+		t.Run(root, func(t *testing.T) {
+			if mode := detectCgroupMode(root); mode != expected {
+				t.Fatalf("detectCgroupMode: exp (%s); act (%s)", expected, mode)
+			}
+		})
+	}
+}
+
+func TestContainerCollector_Collect(t *testing.T) {
+	burstable := "kubepods/burstable/pod1b2c3d4e-0000-0000-0000-000000000001"
+	v1CpuUsage := func(root, cgroup string, usage uint64) {
+		writeFixtureFile(t, root, fmt.Sprintf("cpuacct/%s/cpuacct.usage", cgroup), fmt.Sprintf("%d\n", usage))
+	}
+	v2CpuUsage := func(root, cgroup string, usage uint64) {
+		writeFixtureFile(t, root, fmt.Sprintf("%s/cpu.stat", cgroup), fmt.Sprintf("usage_usec %d\n", usage/1000))
+	}
+
+	layouts := map[string]func(root, cgroup string, usage uint64){
+		"testdata/cgroupv1":      v1CpuUsage,
+		"testdata/cgroup-hybrid": v1CpuUsage,
+		"testdata/cgroupv2":      v2CpuUsage,
+	}
+
+	for fixture, writeCpuUsage := range layouts {
+		t.Run(fixture, func(t *testing.T) {
+			root := copyFixture(t, fixture)
+			defer os.RemoveAll(root)
+
+			cc := newContainerCollector(root, types.MetricsContainerConfig{}, time.Minute)
+			pods := newTestPods()
+
+			now := time.Now()
+			cc.Collect(now, pods)
+
+			if _, err := cc.Get(podKey("default", "missing")); err == nil {
+				t.Fatalf("Get expected error for pod without cgroup")
+			}
+
+			writeCpuUsage(root, burstable, 15000000000)
+			writeCpuUsage(root, burstable+"/abc123", 8000000000)
+			cc.Collect(now.Add(10*time.Second), pods)
+
+			testContainerStats(t, cc)
+
+			// the samples of deleted pods are dropped
+			cc.Collect(now.Add(20*time.Second), pods[1:])
+			if _, err := cc.Get(podKey("default", "burstable")); err == nil {
+				t.Fatalf("Get expected error for deleted pod")
+			}
+		})
+	}
+}
+
+func testContainerStats(t *testing.T, cc *containerCollector) {
+	testCases := map[string]struct {
+		key        string
+		cpu        float64
+		workingSet float64
+		rss        float64
+	}{
+		"burstable pod": {
+			key:        podKey("default", "burstable"),
+			cpu:        1,
+			workingSet: 262144000,
+			rss:        209715200,
+		},
+		"burstable container": {
+			key:        containerKey("default", "burstable", "app"),
+			cpu:        0.5,
+			workingSet: 188743680,
+			rss:        157286400,
+		},
+		"guaranteed systemd pod": {
+			key:        podKey("default", "guaranteed"),
+			cpu:        0,
+			workingSet: 104857600,
+			rss:        104857600,
+		},
+		"guaranteed systemd container": {
+			key:        containerKey("default", "guaranteed", "app"),
+			cpu:        0,
+			workingSet: 104857600,
+			rss:        104857600,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if cpu := getContainerCpu(t, cc, test.key); cpu != test.cpu {
+				t.Fatalf("cpu: exp (%f); act (%f)", test.cpu, cpu)
+			}
+
+			memory := getContainerMemory(t, cc, test.key)
+			if memory.WorkingSet != test.workingSet || memory.UsageRss != test.rss {
+				t.Fatalf("memory: exp (%f, %f); act (%f, %f)", test.workingSet, test.rss, memory.WorkingSet, memory.UsageRss)
+			}
+		})
+	}
+}
+
+func TestContainerCollector_IOAndCpuPressure(t *testing.T) {
+	expectedIO := ContainerIO{ReadBytes: 2097152, WriteBytes: 2097152, ReadIOs: 32, WriteIOs: 32}
+	expectedPressure := ContainerCpuPressure{
+		Some: PressureStats{Avg10: 1.5, Avg60: 0.75, Avg300: 0.25, Total: 123456},
+		Full: PressureStats{Avg10: 0.5, Avg60: 0.25, Avg300: 0.1, Total: 45678},
+	}
+
+	// the cpu pressure is only collected with cgroup v2
+	layouts := map[string]bool{
+		"testdata/cgroupv1":      false,
+		"testdata/cgroup-hybrid": false,
+		"testdata/cgroupv2":      true,
+	}
+	keys := []string{
+		podKey("default", "burstable"),
+		containerKey("default", "burstable", "app"),
+		podKey("default", "guaranteed"),
+		containerKey("default", "guaranteed", "app"),
+	}
+
+	for fixture, hasPressure := range layouts {
+		t.Run(fixture, func(t *testing.T) {
+			cc := newContainerCollector(fixture, types.MetricsContainerConfig{}, time.Minute)
+			now := time.Now()
+			cc.Collect(now, newTestPods())
+
+			for _, key := range keys {
+				cs, err := cc.Get(key)
+				if err != nil {
+					t.Fatalf("Get %s failed %s", key, err.Error())
+				}
+
+				result, err := cs.GetResourceStats(types.IOUsageMetrics)
+				if err != nil {
+					t.Fatalf("GetResourceStats io of %s failed %s", key, err.Error())
+				}
+				io := *result.(*ContainerIO)
+				io.Timestamp = time.Time{}
+				if io != expectedIO {
+					t.Fatalf("io of %s: exp (%+v); act (%+v)", key, expectedIO, io)
+				}
+
+				result, err = cs.GetResourceStats(types.CpuPressureMetrics)
+				if !hasPressure {
+					if err == nil {
+						t.Fatalf("GetResourceStats expected no cpu pressure of %s", key)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("GetResourceStats cpu pressure of %s failed %s", key, err.Error())
+				}
+				pressure := *result.(*ContainerCpuPressure)
+				pressure.Timestamp = time.Time{}
+				if pressure != expectedPressure {
+					t.Fatalf("cpu pressure of %s: exp (%+v); act (%+v)", key, expectedPressure, pressure)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/types"
+)
+
+// ResourceStatsInterface collects resource usage on the local node periodically, and keeps
+// the samples in memory until they expire
+type ResourceStatsInterface interface {
+	// GetNodeStats returns the node level resource stats
+	GetNodeStats() NodeStats
+
+	// GetPodStats returns the resource stats of the pod cgroup
+	GetPodStats(namespace, podName string) (ContainerStats, error)
+
+	// GetContainerStats returns the resource stats of the container cgroup
+	GetContainerStats(namespace, podName, containerName string) (ContainerStats, error)
+
+	// Stop stops the collection goroutine
+	Stop()
+}
+
+// NodeStats is used to read node level resource stats
+type NodeStats interface {
+	// GetResourceStats returns the latest sample of the given metric kind, the type of which
+	// is *NodeCpu for types.CpuUsageMetrics and *NodeMemory for types.MemoryUsageMetrics
+	GetResourceStats(kind types.MetricKind) (interface{}, error)
+
+	// GetResourceStatsRange returns the samples of the given metric kind collected in [start, end],
+	// ordered by time
+	GetResourceStatsRange(kind types.MetricKind, start, end time.Time) ([]interface{}, error)
+}
+
+// ContainerStats is used to read pod or container level resource stats
+type ContainerStats interface {
+	// GetResourceStats returns the latest sample of the given metric kind, the type of which
+	// is *ContainerCpu for types.CpuUsageMetrics, *ContainerMemory for types.MemoryUsageMetrics,
+	// *ContainerIO for types.IOUsageMetrics and *ContainerCpuPressure for types.CpuPressureMetrics
+	GetResourceStats(kind types.MetricKind) (interface{}, error)
+
+	// GetResourceStatsRange returns the samples of the given metric kind collected in [start, end],
+	// ordered by time
+	GetResourceStatsRange(kind types.MetricKind, start, end time.Time) ([]interface{}, error)
+}
@@ -0,0 +1,110 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/mem"
+)
+
+// nodeCollector samples the node cpu and memory usage. The cpu usage is calculated from the
+// delta between the current and the previous cpu times, so the first collection returns no cpu stats.
+type nodeCollector struct {
+	cpuTimes      func(perCpu bool) ([]cpu.TimesStat, error)
+	virtualMemory func() (*mem.VirtualMemoryStat, error)
+
+	lastTotal   *cpu.TimesStat
+	lastPerCore []cpu.TimesStat
+}
+
+// newNodeCollector creates a nodeCollector reading from the host /proc
+func newNodeCollector() *nodeCollector {
+	return &nodeCollector{
+		cpuTimes:      cpu.Times,
+		virtualMemory: mem.VirtualMemory,
+	}
+}
+
+// CollectCpu returns the cpu usage since the last collection, or nil if this is the first collection
+func (nc *nodeCollector) CollectCpu(now time.Time) (*NodeCpu, error) {
+	totals, err := nc.cpuTimes(false)
+	if err != nil {
+		return nil, err
+	}
+	if len(totals) == 0 {
+		return nil, fmt.Errorf("cpu times empty")
+	}
+
+	perCore, err := nc.cpuTimes(true)
+	if err != nil {
+		return nil, err
+	}
+
+	total := totals[0]
+	lastTotal, lastPerCore := nc.lastTotal, nc.lastPerCore
+	nc.lastTotal, nc.lastPerCore = &total, perCore
+
+	// the number of cores may change with cpu hotplug, start over in that case
+	if lastTotal == nil || len(lastPerCore) != len(perCore) {
+		return nil, nil
+	}
+
+	nodeCpu := &NodeCpu{
+		CpuPerCore: make([]float64, len(perCore)),
+		Timestamp:  now,
+	}
+	for i := range perCore {
+		nodeCpu.CpuPerCore[i] = cpuUsage(lastPerCore[i], perCore[i])
+	}
+	nodeCpu.CpuTotal = cpuUsage(*lastTotal, total) * float64(len(perCore))
+
+	return nodeCpu, nil
+}
+
+// CollectMemory returns the current memory usage
+func (nc *nodeCollector) CollectMemory(now time.Time) (*NodeMemory, error) {
+	vm, err := nc.virtualMemory()
+	if err != nil {
+		return nil, err
+	}
+
+	usageTotal := float64(vm.Total - vm.Free)
+	usageCache := float64(vm.Buffers + vm.Cached)
+	usageRss := usageTotal - usageCache
+	if usageRss < 0 {
+		usageRss = 0
+	}
+
+	workingSet := float64(0)
+	if vm.Available < vm.Total {
+		workingSet = float64(vm.Total - vm.Available)
+	}
+
+	return &NodeMemory{
+		UsageTotal: usageTotal,
+		UsageRss:   usageRss,
+		UsageCache: usageCache,
+		WorkingSet: workingSet,
+		Timestamp:  now,
+	}, nil
+}
+
+// cpuUsage returns the busy ratio of the cpu between two samples, in the range [0, 1]
+func cpuUsage(last, cur cpu.TimesStat) float64 {
+	totalDelta := cur.Total() - last.Total()
+	if totalDelta <= 0 {
+		return 0
+	}
+
+	idleDelta := (cur.Idle + cur.Iowait) - (last.Idle + last.Iowait)
+	usage := (totalDelta - idleDelta) / totalDelta
+	if usage < 0 {
+		return 0
+	}
+	if usage > 1 {
+		return 1
+	}
+
+	return usage
+}
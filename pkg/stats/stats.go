@@ -0,0 +1,197 @@
+package stats
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/types"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+const (
+	defaultMetricsTTL      = time.Minute * 5
+	defaultCollectInterval = time.Second * 10
+)
+
+// resourceStats is the implementation of ResourceStatsInterface, which collects the node local
+// resource usage on every collect interval
+type resourceStats struct {
+	nodeConfig      types.MetricsNodeConfig
+	containerConfig types.MetricsContainerConfig
+	podInformer     cache.SharedIndexInformer
+
+	node      *nodeCollector
+	nodeStats *statsStore
+	container *containerCollector
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// NewResourceStats creates a ResourceStatsInterface and starts the collection goroutine, the
+// samples older than metricsTTL are dropped.
+func NewResourceStats(metricsTTL time.Duration, nodeConfig types.MetricsNodeConfig, containerConfig types.MetricsContainerConfig,
+	podInformer cache.SharedIndexInformer) (ResourceStatsInterface, error) {
+	if metricsTTL < 0 || nodeConfig.CollectInterval < 0 {
+		return nil, fmt.Errorf("invalid metrics ttl %s or collect interval %s", metricsTTL, nodeConfig.CollectInterval)
+	}
+
+	if metricsTTL == 0 {
+		metricsTTL = defaultMetricsTTL
+	}
+	if nodeConfig.CollectInterval == 0 {
+		nodeConfig.CollectInterval = defaultCollectInterval
+	}
+
+	rs := &resourceStats{
+		nodeConfig:      nodeConfig,
+		containerConfig: containerConfig,
+		podInformer:     podInformer,
+		node:            newNodeCollector(),
+		nodeStats:       newStatsStore("node", metricsTTL),
+		container:       newContainerCollector(defaultCgroupRoot, containerConfig, metricsTTL),
+		stopCh:          make(chan struct{}),
+	}
+
+	go rs.run()
+
+	return rs, nil
+}
+
+// GetNodeStats returns the node level resource stats
+func (rs *resourceStats) GetNodeStats() NodeStats {
+	return rs.nodeStats
+}
+
+// GetPodStats returns the resource stats of the pod cgroup
+func (rs *resourceStats) GetPodStats(namespace, podName string) (ContainerStats, error) {
+	return rs.container.Get(podKey(namespace, podName))
+}
+
+// GetContainerStats returns the resource stats of the container cgroup
+func (rs *resourceStats) GetContainerStats(namespace, podName, containerName string) (ContainerStats, error) {
+	return rs.container.Get(containerKey(namespace, podName, containerName))
+}
+
+// Stop stops the collection goroutine, it is safe to call multiple times
+func (rs *resourceStats) Stop() {
+	rs.stopOnce.Do(func() {
+		close(rs.stopCh)
+	})
+}
+
+// run collects the resource usage on every collect interval until stopped
+func (rs *resourceStats) run() {
+	ticker := time.NewTicker(rs.nodeConfig.CollectInterval)
+	defer ticker.Stop()
+
+	rs.collect()
+	for {
+		select {
+		case <-rs.stopCh:
+			return
+		case <-ticker.C:
+			rs.collect()
+		}
+	}
+}
+
+// collect samples all the resources once
+func (rs *resourceStats) collect() {
+	now := time.Now()
+
+	nodeCpu, err := rs.node.CollectCpu(now)
+	if err != nil {
+		klog.Errorf("collect node cpu failed, err %s", err.Error())
+	} else if nodeCpu != nil {
+		rs.nodeStats.cpu.Add(now, nodeCpu)
+	}
+
+	nodeMemory, err := rs.node.CollectMemory(now)
+	if err != nil {
+		klog.Errorf("collect node memory failed, err %s", err.Error())
+	} else {
+		rs.nodeStats.memory.Add(now, nodeMemory)
+	}
+
+	if rs.podInformer != nil {
+		rs.container.Collect(now, rs.listPods())
+	}
+}
+
+// listPods returns the pods in the informer cache
+func (rs *resourceStats) listPods() []*v1.Pod {
+	var pods []*v1.Pod
+	for _, obj := range rs.podInformer.GetStore().List() {
+		if pod, ok := obj.(*v1.Pod); ok {
+			pods = append(pods, pod)
+		}
+	}
+
+	return pods
+}
+
+// statsStore is the implementation of NodeStats and ContainerStats backed by sample stores
+type statsStore struct {
+	name   string
+	cpu    *sampleStore
+	memory *sampleStore
+	// io and cpuPressure are only collected for the pods and containers
+	io          *sampleStore
+	cpuPressure *sampleStore
+}
+
+func newStatsStore(name string, ttl time.Duration) *statsStore {
+	return &statsStore{
+		name:        name,
+		cpu:         newSampleStore(ttl),
+		memory:      newSampleStore(ttl),
+		io:          newSampleStore(ttl),
+		cpuPressure: newSampleStore(ttl),
+	}
+}
+
+// GetResourceStats returns the latest sample of the given metric kind
+func (ss *statsStore) GetResourceStats(kind types.MetricKind) (interface{}, error) {
+	store, err := ss.store(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := store.Latest()
+	if !ok {
+		return nil, fmt.Errorf("no %s stats collected for %s", kind, ss.name)
+	}
+
+	return value, nil
+}
+
+// GetResourceStatsRange returns the samples of the given metric kind collected in [start, end]
+func (ss *statsStore) GetResourceStatsRange(kind types.MetricKind, start, end time.Time) ([]interface{}, error) {
+	store, err := ss.store(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Range(start, end), nil
+}
+
+// store returns the sample store of the given metric kind
+func (ss *statsStore) store(kind types.MetricKind) (*sampleStore, error) {
+	switch kind {
+	case types.CpuUsageMetrics:
+		return ss.cpu, nil
+	case types.MemoryUsageMetrics:
+		return ss.memory, nil
+	case types.IOUsageMetrics:
+		return ss.io, nil
+	case types.CpuPressureMetrics:
+		return ss.cpuPressure, nil
+	}
+
+	return nil, fmt.Errorf("%s stats not support metric kind %s", ss.name, kind)
+}
@@ -0,0 +1,118 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/open-resource-management/metricsclient/pkg/types"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/mem"
+)
+
+func TestNodeCollector_CollectCpu(t *testing.T) {
+	samples := [][]cpu.TimesStat{
+		{
+			{CPU: "cpu0", User: 10, Idle: 90},
+			{CPU: "cpu1", User: 20, Idle: 80},
+		},
+		{
+			{CPU: "cpu0", User: 60, Idle: 140},
+			{CPU: "cpu1", User: 45, Idle: 155},
+		},
+	}
+
+	var index int
+	nc := &nodeCollector{
+		cpuTimes: func(perCpu bool) ([]cpu.TimesStat, error) {
+			perCore := samples[index]
+			if perCpu {
+				return perCore, nil
+			}
+
+			var total cpu.TimesStat
+			for _, c := range perCore {
+				total.User += c.User
+				total.Idle += c.Idle
+			}
+			return []cpu.TimesStat{total}, nil
+		},
+	}
+
+	nodeCpu, err := nc.CollectCpu(time.Now())
+	if err != nil {
+		t.Fatalf("CollectCpu failed %s", err.Error())
+	}
+	if nodeCpu != nil {
+		t.Fatalf("CollectCpu expected nil for the first collection, got %+v", nodeCpu)
+	}
+
+	index++
+	nodeCpu, err = nc.CollectCpu(time.Now())
+	if err != nil {
+		t.Fatalf("CollectCpu failed %s", err.Error())
+	}
+
+	expectedPerCore := []float64{0.5, 0.25}
+	for i, v := range expectedPerCore {
+		if math.Abs(nodeCpu.CpuPerCore[i]-v) > 1e-9 {
+			t.Fatalf("CpuPerCore[%d]: exp (%f); act (%f)", i, v, nodeCpu.CpuPerCore[i])
+		}
+	}
+	if math.Abs(nodeCpu.CpuTotal-0.75) > 1e-9 {
+		t.Fatalf("CpuTotal: exp (%f); act (%f)", 0.75, nodeCpu.CpuTotal)
+	}
+}
+
+func TestNodeCollector_CollectMemory(t *testing.T) {
+	nc := &nodeCollector{
+		virtualMemory: func() (*mem.VirtualMemoryStat, error) {
+			return &mem.VirtualMemoryStat{Total: 1000, Available: 550, Free: 200, Buffers: 100, Cached: 300}, nil
+		},
+	}
+
+	nodeMemory, err := nc.CollectMemory(time.Now())
+	if err != nil {
+		t.Fatalf("CollectMemory failed %s", err.Error())
+	}
+
+	if nodeMemory.UsageTotal != 800 || nodeMemory.UsageCache != 400 || nodeMemory.UsageRss != 400 || nodeMemory.WorkingSet != 450 {
+		t.Fatalf("CollectMemory unexpected result %+v", nodeMemory)
+	}
+}
+
+func TestStatsStore_GetResourceStats(t *testing.T) {
+	ns := newStatsStore("node", time.Minute)
+
+	if _, err := ns.GetResourceStats(types.CpuUsageMetrics); err == nil {
+		t.Fatalf("GetResourceStats expected error without samples")
+	}
+
+	now := time.Now()
+	ns.cpu.Add(now.Add(-2*time.Minute), &NodeCpu{CpuTotal: 1})
+	ns.cpu.Add(now, &NodeCpu{CpuTotal: 2})
+	if len(ns.cpu.samples) != 1 {
+		t.Fatalf("expired samples not dropped, length is %d", len(ns.cpu.samples))
+	}
+
+	result, err := ns.GetResourceStats(types.CpuUsageMetrics)
+	if err != nil {
+		t.Fatalf("GetResourceStats failed %s", err.Error())
+	}
+	if result.(*NodeCpu).CpuTotal != 2 {
+		t.Fatalf("GetResourceStats: exp (%f); act (%f)", 2.0, result.(*NodeCpu).CpuTotal)
+	}
+
+	values, err := ns.GetResourceStatsRange(types.CpuUsageMetrics, now.Add(-time.Minute), now)
+	if err != nil {
+		t.Fatalf("GetResourceStatsRange failed %s", err.Error())
+	}
+	if len(values) != 1 || values[0].(*NodeCpu).CpuTotal != 2 {
+		t.Fatalf("GetResourceStatsRange unexpected result %v", values)
+	}
+
+	if _, err := ns.GetResourceStats(types.CpuLoadMetrics); err == nil {
+		t.Fatalf("GetResourceStats expected error for unsupported kind")
+	}
+}
@@ -0,0 +1,78 @@
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// sample is a single resource stats value with the time it was collected
+type sample struct {
+	timestamp time.Time
+	value     interface{}
+}
+
+// sampleStore keeps samples ordered by time, and drops the samples older than ttl
+type sampleStore struct {
+	m       sync.RWMutex
+	ttl     time.Duration
+	samples []sample
+}
+
+// newSampleStore creates a sampleStore which keeps samples for the given ttl
+func newSampleStore(ttl time.Duration) *sampleStore {
+	return &sampleStore{ttl: ttl}
+}
+
+// Add appends a new sample, and drops the expired ones
+func (s *sampleStore) Add(timestamp time.Time, value interface{}) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.samples = append(s.samples, sample{timestamp: timestamp, value: value})
+	s.expire(timestamp)
+}
+
+// Latest returns the most recent sample, or false if there are no unexpired samples
+func (s *sampleStore) Latest() (interface{}, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	if len(s.samples) == 0 {
+		return nil, false
+	}
+
+	last := s.samples[len(s.samples)-1]
+	if time.Since(last.timestamp) > s.ttl {
+		return nil, false
+	}
+
+	return last.value, true
+}
+
+// Range returns the unexpired samples with timestamp in [start, end], ordered by time
+func (s *sampleStore) Range(start, end time.Time) []interface{} {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	var values []interface{}
+	for _, sample := range s.samples {
+		if sample.timestamp.Before(start) || sample.timestamp.After(end) || time.Since(sample.timestamp) > s.ttl {
+			continue
+		}
+		values = append(values, sample.value)
+	}
+
+	return values
+}
+
+// expire drops the samples older than ttl relative to now. The lock must be held by the caller.
+func (s *sampleStore) expire(now time.Time) {
+	i := 0
+	for i < len(s.samples) && now.Sub(s.samples[i].timestamp) > s.ttl {
+		// nil the value to prevent leak
+		s.samples[i].value = nil
+		i++
+	}
+
+	s.samples = s.samples[i:]
+}
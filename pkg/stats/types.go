@@ -0,0 +1,79 @@
+package stats
+
+import (
+	"time"
+)
+
+// NodeCpu contains the cpu usage of the node, calculated from the delta between
+// two samples of /proc/stat
+type NodeCpu struct {
+	// CpuTotal is the number of cores in use across the whole node
+	CpuTotal float64
+	// CpuPerCore is the usage of each core, in the range [0, 1]
+	CpuPerCore []float64
+	Timestamp  time.Time
+}
+
+// NodeMemory contains the memory usage of the node, in bytes
+type NodeMemory struct {
+	// UsageTotal is the memory in use, including page cache and buffers
+	UsageTotal float64
+	// UsageRss is the memory in use, excluding page cache and buffers
+	UsageRss float64
+	// UsageCache is the memory used by page cache and buffers
+	UsageCache float64
+	// WorkingSet is the memory which can't be reclaimed without swapping, MemTotal - MemAvailable of
+	// /proc/meminfo as for node_exporter
+	WorkingSet float64
+	Timestamp  time.Time
+}
+
+// ContainerCpu contains the cpu usage of a pod or container cgroup, calculated from the delta
+// between two samples of the cgroup cpu accounting
+type ContainerCpu struct {
+	// CpuUsage is the number of cores in use
+	CpuUsage  float64
+	Timestamp time.Time
+}
+
+// ContainerMemory contains the memory usage of a pod or container cgroup, in bytes
+type ContainerMemory struct {
+	// UsageTotal is the memory charged to the cgroup, including page cache
+	UsageTotal float64
+	// WorkingSet is the memory usage excluding the inactive file cache, the same as cAdvisor
+	WorkingSet float64
+	// UsageRss is the anonymous memory usage
+	UsageRss float64
+	// UsageCache is the page cache usage
+	UsageCache float64
+	Timestamp  time.Time
+}
+
+// ContainerIO contains the cumulative block io of a pod or container cgroup, summed over the devices
+type ContainerIO struct {
+	ReadBytes  float64
+	WriteBytes float64
+	// ReadIOs and WriteIOs are the number of read and write operations
+	ReadIOs   float64
+	WriteIOs  float64
+	Timestamp time.Time
+}
+
+// PressureStats is a line of a pressure stall information file, the averages are the percentage of
+// the time some or all the tasks were stalled over the last 10, 60 and 300 seconds
+type PressureStats struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	// Total is the cumulative stall time, in microseconds
+	Total float64
+}
+
+// ContainerCpuPressure contains the cpu pressure stall information of a pod or container cgroup,
+// which is only available with cgroup v2
+type ContainerCpuPressure struct {
+	// Some is the stall of at least one task, Full of all the tasks
+	Some      PressureStats
+	Full      PressureStats
+	Timestamp time.Time
+}
@@ -11,7 +11,9 @@ type MetricsNodeConfig struct {
 
 // MetricsContainerConfig is the configuration for container metrics collection
 type MetricsContainerConfig struct {
-	Resources               []string      `json:"resources"`
+	// Resources are the resources to collect, such as "cpu" and "memory", all are collected if empty
+	Resources []string `json:"resources"`
+	// Cgroups are the parent cgroups the pods are created under, such as "/kubepods"
 	Cgroups                 []string      `json:"cgroups"`
 	MaxHousekeepingInterval time.Duration `json:"max_housekeeping_interval"`
 }
@@ -31,4 +33,6 @@ const (
 	CpuUsageMetrics    MetricKind = "cpu"
 	MemoryUsageMetrics MetricKind = "memory"
 	CpuLoadMetrics     MetricKind = "cpuLoad"
+	IOUsageMetrics     MetricKind = "io"
+	CpuPressureMetrics MetricKind = "cpuPressure"
 )
@@ -0,0 +1,178 @@
+package queue
+
+import (
+	"sync"
+)
+
+//--------------------------------------------------------------------------
+//  PriorityBlockingQueue
+//--------------------------------------------------------------------------
+
+// priorityBlockingQueue is an implementation of BlockingQueue which keeps a FIFO lane per priority
+// and dequeues from the lanes by smooth weighted round robin, so every non-empty lane is served at
+// least weight/total of the time and none is starved. Lanes with a zero weight are only served
+// once all the weighted lanes are empty.
+type priorityBlockingQueue struct {
+	lanes      [][]interface{}
+	weights    []int
+	current    []int
+	priorityOf func(interface{}) int
+	length     int
+	l          *sync.Mutex
+	nonEmpty   *sync.Cond
+}
+
+// NewPriorityBlockingQueue returns a new BlockingQueue implementation with a lane for each weight.
+// priorityOf returns the lane index of an item, indexes out of range go to the last lane. Negative
+// weights are treated as zero.
+func NewPriorityBlockingQueue(weights []int, priorityOf func(item interface{}) int) BlockingQueue {
+	l := new(sync.Mutex)
+
+	w := make([]int, len(weights))
+	for i, weight := range weights {
+		if weight > 0 {
+			w[i] = weight
+		}
+	}
+	if len(w) == 0 {
+		w = []int{1}
+	}
+
+	return &priorityBlockingQueue{
+		lanes:      make([][]interface{}, len(w)),
+		weights:    w,
+		current:    make([]int, len(w)),
+		priorityOf: priorityOf,
+		l:          l,
+		nonEmpty:   sync.NewCond(l),
+	}
+}
+
+// Enqueue pushes an item onto the lane of its priority
+func (q *priorityBlockingQueue) Enqueue(item interface{}) {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	lane := q.priorityOf(item)
+	if lane < 0 || lane >= len(q.lanes) {
+		lane = len(q.lanes) - 1
+	}
+
+	q.lanes[lane] = append(q.lanes[lane], item)
+	q.length++
+	q.nonEmpty.Broadcast()
+}
+
+// Dequeue removes the next item by weighted round robin and returns it.
+func (q *priorityBlockingQueue) Dequeue() interface{} {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	// need to tight loop here to ensure only one thread wins and
+	// others wait again
+	for q.length == 0 {
+		q.nonEmpty.Wait()
+	}
+
+	return q.pop(q.next())
+}
+
+// TryDequeue attempts to remove the next item from the queue and return it. This
+// method does not block, and instead, returns true if the item was available and false
+// otherwise
+func (q *priorityBlockingQueue) TryDequeue() (interface{}, bool) {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	if q.length == 0 {
+		return nil, false
+	}
+
+	return q.pop(q.next()), true
+}
+
+// next selects the lane to dequeue from, the queue must not be empty
+func (q *priorityBlockingQueue) next() int {
+	selected, total := -1, 0
+	for i, lane := range q.lanes {
+		if len(lane) == 0 || q.weights[i] == 0 {
+			continue
+		}
+
+		q.current[i] += q.weights[i]
+		total += q.weights[i]
+		if selected < 0 || q.current[i] > q.current[selected] {
+			selected = i
+		}
+	}
+
+	if selected >= 0 {
+		q.current[selected] -= total
+		return selected
+	}
+
+	// only zero weight lanes have items
+	for i, lane := range q.lanes {
+		if len(lane) > 0 {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// pop removes the first item of the lane
+func (q *priorityBlockingQueue) pop(lane int) interface{} {
+	e := q.lanes[lane][0]
+
+	// nil 0 index to prevent leak
+	q.lanes[lane][0] = nil
+	q.lanes[lane] = q.lanes[lane][1:]
+	q.length--
+
+	// a lane which runs empty doesn't keep credit for later
+	if len(q.lanes[lane]) == 0 {
+		q.current[lane] = 0
+	}
+
+	return e
+}
+
+// Each blocks modification and allows iteration of the queue, lane by lane.
+func (q *priorityBlockingQueue) Each(f func(int, interface{})) {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	i := 0
+	for _, lane := range q.lanes {
+		for _, entry := range lane {
+			f(i, entry)
+			i++
+		}
+	}
+}
+
+// Length returns the length of the queue
+func (q *priorityBlockingQueue) Length() int {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	return q.length
+}
+
+// IsEmpty returns true if the queue is empty
+func (q *priorityBlockingQueue) IsEmpty() bool {
+	return q.Length() == 0
+}
+
+// Clear empties the queue
+func (q *priorityBlockingQueue) Clear() {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	for i := range q.lanes {
+		q.lanes[i] = []interface{}{}
+		q.current[i] = 0
+	}
+	q.length = 0
+}
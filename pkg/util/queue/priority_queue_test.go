@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"testing"
+)
+
+type testItem struct {
+	lane int
+	seq  int
+}
+
+func newTestPriorityQueue(weights []int) BlockingQueue {
+	return NewPriorityBlockingQueue(weights, func(item interface{}) int {
+		return item.(testItem).lane
+	})
+}
+
+func TestPriorityBlockingQueue_WeightedFairness(t *testing.T) {
+	q := newTestPriorityQueue([]int{8, 4, 1})
+	for seq := 0; seq < 100; seq++ {
+		for lane := 0; lane < 3; lane++ {
+			q.Enqueue(testItem{lane: lane, seq: seq})
+		}
+	}
+
+	// every round of 13 items serves the lanes by their weights
+	counts := make([]int, 3)
+	next := make([]int, 3)
+	for i := 0; i < 13*5; i++ {
+		item := q.Dequeue().(testItem)
+		if item.seq != next[item.lane] {
+			t.Fatalf("lane %d is not FIFO, expected seq %d, got %d", item.lane, next[item.lane], item.seq)
+		}
+		next[item.lane]++
+		counts[item.lane]++
+	}
+
+	expected := []int{40, 20, 5}
+	for lane := range counts {
+		if counts[lane] != expected[lane] {
+			t.Errorf("lane %d: expected %d items, got %d", lane, expected[lane], counts[lane])
+		}
+	}
+
+	if q.Length() != 300-13*5 {
+		t.Errorf("expected %d items left, got %d", 300-13*5, q.Length())
+	}
+}
+
+func TestPriorityBlockingQueue_NoStarvation(t *testing.T) {
+	q := newTestPriorityQueue([]int{100, 1})
+	for seq := 0; seq < 1000; seq++ {
+		q.Enqueue(testItem{lane: 0, seq: seq})
+	}
+	q.Enqueue(testItem{lane: 1})
+
+	for i := 0; i < 101; i++ {
+		if q.Dequeue().(testItem).lane == 1 {
+			return
+		}
+	}
+	t.Fatalf("low priority lane starved")
+}
+
+func TestPriorityBlockingQueue_ZeroWeightLast(t *testing.T) {
+	q := newTestPriorityQueue([]int{1, 1, 0})
+	q.Enqueue(testItem{lane: 2})
+	q.Enqueue(testItem{lane: 0})
+	q.Enqueue(testItem{lane: 5})
+	q.Enqueue(testItem{lane: 1})
+
+	var lanes []int
+	for {
+		item, ok := q.TryDequeue()
+		if !ok {
+			break
+		}
+		lanes = append(lanes, item.(testItem).lane)
+	}
+
+	if len(lanes) != 4 || lanes[2] != 2 || lanes[3] != 5 {
+		t.Errorf("expected the zero weight lane to be served last, got %v", lanes)
+	}
+}
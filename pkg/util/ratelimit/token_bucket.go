@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//--------------------------------------------------------------------------
+//  TokenBucket
+//--------------------------------------------------------------------------
+
+// TokenBucket is a token bucket rate limiter, which refills at rate tokens per second up to burst
+// tokens. Each Wait takes one token, and blocks until the token is available.
+type TokenBucket struct {
+	m      sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a full TokenBucket with the given rate in tokens per second and burst,
+// a burst < 1 is treated as 1.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done, in which case the token is given back
+// and the error of ctx is returned.
+func (tb *TokenBucket) Wait(ctx context.Context) error {
+	delay := tb.reserve(time.Now())
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		tb.cancel()
+		return ctx.Err()
+	}
+}
+
+// Rate returns the current rate in tokens per second
+func (tb *TokenBucket) Rate() float64 {
+	tb.m.Lock()
+	defer tb.m.Unlock()
+
+	return tb.rate
+}
+
+// SetRate changes the rate, the tokens accumulated at the previous rate are kept
+func (tb *TokenBucket) SetRate(rate float64) {
+	tb.m.Lock()
+	defer tb.m.Unlock()
+
+	tb.advance(time.Now())
+	tb.rate = rate
+}
+
+// reserve takes a token, and returns how long to wait until the token is available. The tokens
+// go negative to queue the waiters in order.
+func (tb *TokenBucket) reserve(now time.Time) time.Duration {
+	tb.m.Lock()
+	defer tb.m.Unlock()
+
+	tb.advance(now)
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+	if tb.rate <= 0 {
+		// nothing refills the bucket, the waiter blocks until cancelled
+		return time.Duration(1<<63 - 1)
+	}
+
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// cancel gives back a reserved token
+func (tb *TokenBucket) cancel() {
+	tb.m.Lock()
+	defer tb.m.Unlock()
+
+	tb.tokens++
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+}
+
+// advance refills the tokens since the last advance
+func (tb *TokenBucket) advance(now time.Time) {
+	if elapsed := now.Sub(tb.last); elapsed > 0 {
+		tb.tokens += elapsed.Seconds() * tb.rate
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+		tb.last = now
+	}
+}
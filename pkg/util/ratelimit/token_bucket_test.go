@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Reserve(t *testing.T) {
+	tb := NewTokenBucket(10, 2)
+	now := tb.last
+
+	// the burst is available at once, then one token every 100ms
+	expected := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, e := range expected {
+		if d := tb.reserve(now); d != e {
+			t.Errorf("reserve %d: expected %s, got %s", i, e, d)
+		}
+	}
+
+	// the waiters are served after 300ms, then the bucket refills up to the burst
+	if d := tb.reserve(now.Add(time.Second)); d != 0 {
+		t.Errorf("expected a token after refill, got wait %s", d)
+	}
+	if tb.tokens != 1 {
+		t.Errorf("expected the bucket capped to the burst, got %f tokens left", tb.tokens)
+	}
+}
+
+func TestTokenBucket_WaitCancel(t *testing.T) {
+	tb := NewTokenBucket(0.001, 1)
+	if err := tb.Wait(context.Background()); err != nil {
+		t.Fatalf("expected the burst token, got %s", err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tb.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// the cancelled waiter gives its token back
+	if tb.tokens < -0.5 {
+		t.Errorf("expected the cancelled token given back, got %f tokens", tb.tokens)
+	}
+}
@@ -17,6 +17,9 @@ type Vector struct {
 
 const MapPoolSize = 4
 
+// DefaultTimestampPrecision is the precision in seconds the timestamps are rounded to by ApplyVectorOp
+const DefaultTimestampPrecision = 10.0
+
 type VectorSlice []*Vector
 
 func (p VectorSlice) Len() int           { return len(p) }
@@ -25,10 +28,15 @@ func (p VectorSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
 var mapPool VectorMapPool = NewFlexibleMapPool(MapPoolSize)
 
-// roundTimestamp rounds the given timestamp to the given precision; e.g. a
+// RoundTimestamp rounds the given timestamp to the given precision; e.g. a
 // timestamp given in seconds, rounded to precision 10, will be rounded
 // to the nearest value dividible by 10 (24 goes to 20, but 25 goes to 30).
-func roundTimestamp(ts float64, precision float64) float64 {
+// A precision <= 0 returns the timestamp unchanged.
+func RoundTimestamp(ts float64, precision float64) float64 {
+	if precision <= 0 {
+		return ts
+	}
+
 	return math.Round(ts/precision) * precision
 }
 
@@ -45,16 +53,24 @@ func capacityFor(xvs []*Vector, yvs []*Vector) int {
 }
 
 // ApplyVectorOp accepts two vectors, synchronizes timestamps, and executes an operation
-// on each vector. See VectorJoinOp for details.
+// on each vector. See VectorJoinOp for details. The timestamps are rounded to the
+// DefaultTimestampPrecision.
 func ApplyVectorOp(xvs []*Vector, yvs []*Vector, op VectorJoinOp) []*Vector {
-	// if xvs is empty, return yvs
+	return ApplyVectorOpWithPrecision(xvs, yvs, op, DefaultTimestampPrecision)
+}
+
+// ApplyVectorOpWithPrecision is the same as ApplyVectorOp, but the timestamps are synchronized
+// by rounding them to the precision in seconds, or by their exact value if precision <= 0. The
+// input vectors are not modified.
+func ApplyVectorOpWithPrecision(xvs []*Vector, yvs []*Vector, op VectorJoinOp, precision float64) []*Vector {
+	// if xvs is empty, return a copy of yvs
 	if xvs == nil || len(xvs) == 0 {
-		return yvs
+		return copyVectors(yvs)
 	}
 
-	// if yvs is empty, return xvs
+	// if yvs is empty, return a copy of xvs
 	if yvs == nil || len(yvs) == 0 {
-		return xvs
+		return copyVectors(xvs)
 	}
 
 	// timestamps contains the vector slice after joining xvs and yvs
@@ -70,12 +86,13 @@ func ApplyVectorOp(xvs []*Vector, yvs []*Vector, op VectorJoinOp) []*Vector {
 			continue
 		}
 
-		// round all non-zero timestamps to the nearest 10 second mark
-		xv.Timestamp = roundTimestamp(xv.Timestamp, 10.0)
+		// round all non-zero timestamps to the precision, the maps are keyed by the exact
+		// timestamp so the sub-second timestamps are kept apart without rounding
+		ts := RoundTimestamp(xv.Timestamp, precision)
 
-		xMap[uint64(xv.Timestamp)] = xv.Value
+		xMap[math.Float64bits(ts)] = xv.Value
 		timestamps = append(timestamps, &Vector{
-			Timestamp: xv.Timestamp,
+			Timestamp: ts,
 		})
 	}
 
@@ -87,14 +104,14 @@ func ApplyVectorOp(xvs []*Vector, yvs []*Vector, op VectorJoinOp) []*Vector {
 			continue
 		}
 
-		// round all non-zero timestamps to the nearest 10 second mark
-		yv.Timestamp = roundTimestamp(yv.Timestamp, 10.0)
+		// round all non-zero timestamps to the precision
+		ts := RoundTimestamp(yv.Timestamp, precision)
 
-		yMap[uint64(yv.Timestamp)] = yv.Value
-		if _, ok := xMap[uint64(yv.Timestamp)]; !ok {
+		yMap[math.Float64bits(ts)] = yv.Value
+		if _, ok := xMap[math.Float64bits(ts)]; !ok {
 			// no need to double add, since we'll range over sorted timestamps and check.
 			timestamps = append(timestamps, &Vector{
-				Timestamp: yv.Timestamp,
+				Timestamp: ts,
 			})
 		}
 	}
@@ -103,8 +120,8 @@ func ApplyVectorOp(xvs []*Vector, yvs []*Vector, op VectorJoinOp) []*Vector {
 	// reuse the existing slice to reduce allocations
 	result := timestamps[:0]
 	for _, sv := range timestamps {
-		x, okX := xMap[uint64(sv.Timestamp)]
-		y, okY := yMap[uint64(sv.Timestamp)]
+		x, okX := xMap[math.Float64bits(sv.Timestamp)]
+		y, okY := yMap[math.Float64bits(sv.Timestamp)]
 
 		if op(sv, VectorValue(x, okX), VectorValue(y, okY)) {
 			result = append(result, sv)
@@ -121,6 +138,24 @@ func ApplyVectorOp(xvs []*Vector, yvs []*Vector, op VectorJoinOp) []*Vector {
 	return result
 }
 
+// copyVectors returns a copy of the vectors, so the results of ApplyVectorOp never share the
+// vectors of the caller
+func copyVectors(vs []*Vector) []*Vector {
+	if vs == nil {
+		return nil
+	}
+
+	result := make([]*Vector, len(vs))
+	for i, v := range vs {
+		if v != nil {
+			c := *v
+			result[i] = &c
+		}
+	}
+
+	return result
+}
+
 // VectorJoinOp is an operation func that accepts a result vector pointer
 // for a specific timestamp and two float64 pointers representing the
 // input vectors for that timestamp. x or y inputs can be nil, but not
@@ -143,6 +178,12 @@ func VectorValue(v float64, ok bool) *float64 {
 // which has had its timestamps rounded and its values divided by the values
 // of the Vectors of yvs, such that yvs is the "unit" Vector slice.
 func NormalizeVectorByVector(xvs []*Vector, yvs []*Vector) []*Vector {
+	return NormalizeVectorByVectorWithPrecision(xvs, yvs, DefaultTimestampPrecision)
+}
+
+// NormalizeVectorByVectorWithPrecision is the same as NormalizeVectorByVector, but the timestamps
+// are rounded to the precision in seconds, see ApplyVectorOpWithPrecision.
+func NormalizeVectorByVectorWithPrecision(xvs []*Vector, yvs []*Vector, precision float64) []*Vector {
 	normalizeOp := func(result *Vector, x *float64, y *float64) bool {
 		if x != nil && y != nil && *y != 0 {
 			result.Value = *x / *y
@@ -155,7 +196,7 @@ func NormalizeVectorByVector(xvs []*Vector, yvs []*Vector) []*Vector {
 		return true
 	}
 
-	return ApplyVectorOp(xvs, yvs, normalizeOp)
+	return ApplyVectorOpWithPrecision(xvs, yvs, normalizeOp, precision)
 }
 
 func GetStringVerctor(v Vector) string {
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func addOp(result *Vector, x *float64, y *float64) bool {
+	if x != nil {
+		result.Value += *x
+	}
+	if y != nil {
+		result.Value += *y
+	}
+	return true
+}
+
+func TestApplyVectorOp_DoesNotModifyInputs(t *testing.T) {
+	xvs := []*Vector{{Timestamp: 1600000003, Value: 1}, {Timestamp: 1600000014, Value: 2}}
+	yvs := []*Vector{{Timestamp: 1600000001, Value: 10}}
+
+	result := ApplyVectorOp(xvs, yvs, addOp)
+	expected := []*Vector{{Timestamp: 1600000000, Value: 11}, {Timestamp: 1600000010, Value: 2}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+	if xvs[0].Timestamp != 1600000003 || xvs[1].Timestamp != 1600000014 || yvs[0].Timestamp != 1600000001 {
+		t.Errorf("expected the inputs not modified, got %v %v", xvs, yvs)
+	}
+
+	// the result of an empty side is a copy
+	result = ApplyVectorOp(nil, yvs, addOp)
+	result[0].Value = 0
+	if yvs[0].Value != 10 {
+		t.Errorf("expected a copy of the vectors, got %v", yvs)
+	}
+}
+
+func TestApplyVectorOpWithPrecision(t *testing.T) {
+	xvs := []*Vector{{Timestamp: 1600000000.25, Value: 1}, {Timestamp: 1600000000.75, Value: 2}}
+	yvs := []*Vector{{Timestamp: 1600000000.25, Value: 10}}
+
+	// the sub-second timestamps are kept without rounding
+	result := ApplyVectorOpWithPrecision(xvs, yvs, addOp, 0)
+	expected := []*Vector{{Timestamp: 1600000000.25, Value: 11}, {Timestamp: 1600000000.75, Value: 2}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+
+	xvs = []*Vector{{Timestamp: 1600000001, Value: 1}, {Timestamp: 1600000006, Value: 2}}
+	yvs = []*Vector{{Timestamp: 1600000004, Value: 10}}
+
+	result = ApplyVectorOpWithPrecision(xvs, yvs, addOp, 5)
+	expected = []*Vector{{Timestamp: 1600000000, Value: 1}, {Timestamp: 1600000005, Value: 12}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}